@@ -1,15 +1,56 @@
 package main
 
 import (
+	"log"
+	"os"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/giampier/super-app-api/internal/auth"
 	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/lyrics"
 	"github.com/giampier/super-app-api/internal/music"
+	"github.com/giampier/super-app-api/internal/storage"
+	"github.com/giampier/super-app-api/internal/transcode"
+	"github.com/giampier/super-app-api/internal/urlsign"
 )
 
 func main() {
 	db.Connect()
+	music.LoadSearchIndex()
+	// Claves normalizadas de los artistas creados antes de la deduplicación.
+	// Antes de atender peticiones: un sync concurrente no reconocería a esos
+	// artistas y crearía duplicados.
+	if _, err := music.BackfillArtistKeys(); err != nil {
+		log.Fatal("❌ No se pudieron calcular las claves de artistas: ", err)
+	}
+	// Letras en segundo plano (LRCLIB_URL permite apuntar a otro servidor compatible)
+	music.StartLyricsFetcher(lyrics.NewLRCLIB(os.Getenv("LRCLIB_URL")), 2)
+	// Masters y renditions HLS (STORAGE_DIR / STORAGE_URL, FFMPEG_PATH)
+	store := storage.FromEnv()
+	music.StartTranscoder(store, transcode.NewEncoder(), 1)
+	music.StartLoudnessAnalyzer(1)
+	// Proxy de portadas (IMAGE_ORIGIN para las relativas, IMAGE_ALLOWED_HOSTS)
+	if err := music.ConfigureImages(); err != nil {
+		log.Fatal("❌ Configuración de imágenes inválida: ", err)
+	}
+	// URLs de streaming firmadas (STREAM_SIGNING_KEYS="kid:secreto,..."; la primera firma)
+	keys, err := urlsign.FromEnv()
+	if err != nil {
+		log.Fatal("❌ Claves de firma de streaming inválidas: ", err)
+	}
+	music.ConfigureStreamSigning(keys)
 	r := gin.Default()
+	// ClientIP (firmas atadas a IP, registro de claves) solo cree X-Forwarded-For
+	// si viene de TRUSTED_PROXIES="10.0.0.0/8,..."; sin configurar, la IP directa
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("❌ TRUSTED_PROXIES inválido: ", err)
+	}
+
+	// El almacenamiento local se sirve desde el propio API, solo con URLs firmadas
+	if local, ok := store.(*storage.Local); ok && strings.HasPrefix(local.BaseURL, "/") {
+		r.Group(local.BaseURL, music.RequireStreamSignature()).Static("/", local.Dir)
+	}
 
 	// AUTH
 	authGroup := r.Group("/auth")
@@ -25,12 +66,61 @@ func main() {
 	musicGroup := r.Group("/music")
 	{
 		musicGroup.GET("/artists/trending", music.GetTrendingArtists)
-		musicGroup.GET("/recommendations/mix", music.GenerateWelcomeMix) // <--- NUEVO (1.3)
+		musicGroup.GET("/artists/:id", music.GetArtist)
+		musicGroup.POST("/artists/:id/merge", auth.RequireRole("admin"), music.MergeArtist)
+		musicGroup.GET("/recommendations/mix", auth.OptionalAuth(), music.GenerateWelcomeMix) // <--- NUEVO (1.3)
+		musicGroup.GET("/search/suggest", auth.OptionalAuth(), music.SearchSuggest)
+		musicGroup.POST("/search/history", auth.RequireAuth(), music.SaveSearch)
+		musicGroup.GET("/search/lyrics", music.SearchByLyrics)
 		
-		musicGroup.GET("/tracks/:id", music.GetTrackDetails)
+		musicGroup.GET("/tracks", auth.OptionalAuth(), music.GetTracksBatch)
+		musicGroup.GET("/tracks/:id", auth.OptionalAuth(), music.GetTrackDetails)
 		musicGroup.GET("/tracks/:id/lyrics", music.GetLyrics) // <--- NUEVO (3.3)
+		musicGroup.GET("/tracks/:id/features", music.GetTrackFeatures)
+		musicGroup.PUT("/tracks/:id/lyrics", auth.RequireRole("curator"), music.ImportLyrics)
+		musicGroup.GET("/tracks/:id/lyrics/variants", music.ListLyricsVariants)
+		musicGroup.GET("/tracks/:id/lyrics/revisions", auth.OptionalAuth(), music.GetLyricsHistory)
+		musicGroup.POST("/tracks/:id/lyrics/revisions", auth.RequireAuth(), music.SubmitLyricsRevision)
+		musicGroup.GET("/lyrics/revisions", auth.RequireRole("curator"), music.GetLyricsReviewQueue)
+		musicGroup.GET("/lyrics/revisions/:id", auth.OptionalAuth(), music.GetLyricsRevision)
+		musicGroup.POST("/lyrics/revisions/:id/approve", auth.RequireRole("curator"), music.ApproveLyricsRevision)
+		musicGroup.POST("/lyrics/revisions/:id/reject", auth.RequireRole("curator"), music.RejectLyricsRevision)
+		musicGroup.POST("/lyrics/revisions/:id/rollback", auth.RequireRole("curator"), music.RollbackLyricsRevision)
+		musicGroup.PUT("/tracks/:id/credits", auth.RequireRole("curator"), music.UpdateTrackCredits)
+		musicGroup.GET("/contributors/:id", music.GetContributor)
+		musicGroup.PATCH("/contributors/:id", auth.RequireRole("curator"), music.UpdateContributor)
+		musicGroup.GET("/lookup", music.Lookup)
 		musicGroup.POST("/sync/track", music.SyncTrack)
+		musicGroup.POST("/sync/batch", music.SyncBatch)
+		musicGroup.POST("/tracks/:id/master", auth.RequireRole("curator"), music.UploadMaster)
+		musicGroup.GET("/tracks/:id/transcode", auth.RequireRole("curator"), music.ListTrackTranscodeJobs)
+		musicGroup.GET("/transcode/jobs/:id", auth.RequireRole("curator"), music.GetTranscodeJob)
+		musicGroup.POST("/transcode/jobs/:id/retry", auth.RequireRole("curator"), music.RetryTranscodeJob)
+		musicGroup.POST("/tracks/:id/merge", auth.RequireRole("admin"), music.MergeTrack)
+	}
+
+	// IMÁGENES (portadas y fotos redimensionadas, con caché)
+	r.GET("/images/:kind/:id", music.GetImage)
+
+	// STREAMING (playlists HLS según el plan del usuario, con URLs firmadas)
+	r.GET("/stream/verify", music.VerifyStreamURL)
+	r.GET("/stream/keys/:id", music.GetContentKey)
+	streamGroup := r.Group("/stream", music.RequireStreamSignature())
+	{
+		streamGroup.GET("/:trackId/master.m3u8", music.StreamMaster)
+		streamGroup.GET("/:trackId/:quality/index.m3u8", music.StreamMediaPlaylist)
 	}
 
 	r.Run(":8080")
-}
\ No newline at end of file
+}
+
+// trustedProxies lee TRUSTED_PROXIES (IPs o CIDR separados por comas)
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
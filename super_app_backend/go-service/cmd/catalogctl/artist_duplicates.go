@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/music"
+)
+
+func runArtistDuplicates(args []string) int {
+	fs := flag.NewFlagSet("artist-duplicates", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Salida en JSON Lines (un grupo por línea)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: catalogctl artist-duplicates [--json]")
+		fmt.Fprintln(os.Stderr, "Lista los artistas que comparten nombre normalizado. El primero de cada grupo es el que conviene conservar;")
+		fmt.Fprintln(os.Stderr, "los demás se fusionan con POST /music/artists/:id/merge.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	db.Connect()
+	if n, err := music.BackfillArtistKeys(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ No se pudieron calcular las claves de artistas:", err)
+		return 1
+	} else if n > 0 {
+		fmt.Fprintf(os.Stderr, "… %d artistas sin clave normalizada actualizados\n", n)
+	}
+
+	groups, err := music.FindArtistDuplicates()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ No se pudieron buscar duplicados:", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, g := range groups {
+		if *asJSON {
+			enc.Encode(g)
+			continue
+		}
+		fmt.Printf("%q\n", g.NameKey)
+		for i, a := range g.Artists {
+			mark := " "
+			if i == 0 {
+				mark = "*"
+			}
+			fmt.Printf("  %s %s  %-30q  %3d álbumes  %4d canciones  popularidad %d\n",
+				mark, a.ID, a.Name, a.Albums, a.Tracks, a.Popularity)
+		}
+	}
+	if !*asJSON {
+		fmt.Printf("\n%d grupos de artistas duplicados (* = el que conviene conservar)\n", len(groups))
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/music"
+	"github.com/giampier/super-app-api/internal/storage"
+	"github.com/giampier/super-app-api/internal/transcode"
+)
+
+func runDuplicates(args []string) int {
+	fs := flag.NewFlagSet("duplicates", flag.ContinueOnError)
+	minConfidence := fs.Float64("min-confidence", 0.6, "Confianza mínima (0..1) para listar un par")
+	asJSON := fs.Bool("json", false, "Salida en JSON Lines (un par por línea)")
+	skipFingerprint := fs.Bool("skip-fingerprint", false, "No calcula las huellas que faltan (no necesita ffmpeg)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: catalogctl duplicates [--min-confidence 0.6] [--json] [--skip-fingerprint]")
+		fmt.Fprintln(os.Stderr, "Calcula las huellas que faltan y lista las canciones que parecen la misma grabación.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	db.Connect()
+
+	var failed []failedFile
+	if !*skipFingerprint {
+		enc := transcode.NewEncoder()
+		if err := enc.Available(); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err, "(usa --skip-fingerprint para comparar solo las huellas existentes)")
+			return 1
+		}
+		music.ConfigureTranscoding(storage.FromEnv(), enc)
+
+		ids, err := music.TracksPendingFingerprint()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ No se pudieron buscar las canciones:", err)
+			return 1
+		}
+		for i, id := range ids {
+			if err := music.FingerprintTrack(context.Background(), id); err != nil {
+				failed = append(failed, failedFile{id, err})
+			}
+			if (i+1)%progressEvery == 0 {
+				fmt.Fprintf(os.Stderr, "… %d de %d huellas calculadas\n", i+1, len(ids))
+			}
+		}
+	}
+
+	pairs, err := music.FindDuplicates(*minConfidence, func(done, total int) {
+		if done%progressEvery == 0 {
+			fmt.Fprintf(os.Stderr, "… %d de %d canciones comparadas\n", done, total)
+		}
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ No se pudieron comparar las huellas:", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, p := range pairs {
+		if *asJSON {
+			enc.Encode(p)
+			continue
+		}
+		fmt.Printf("%.0f%%  (desfase %.1f s)\n", p.Confidence*100, p.OffsetSeconds)
+		for _, t := range p.Tracks {
+			fmt.Printf("    %s  %s — %s [%s] %d:%02d\n", t.ID, t.Artist, t.Title, t.Album, t.DurationMs/60000, t.DurationMs/1000%60)
+		}
+	}
+
+	if !*asJSON {
+		fmt.Printf("\n%d posibles duplicados\n", len(pairs))
+	}
+	if len(failed) > 0 {
+		fmt.Fprintln(os.Stderr, "\nCanciones sin huella:")
+		for _, f := range failed {
+			fmt.Fprintf(os.Stderr, "  %s: %v\n", f.path, f.err)
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/giampier/super-app-api/internal/audiofeatures"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/music"
+	"github.com/giampier/super-app-api/internal/storage"
+	"github.com/giampier/super-app-api/internal/transcode"
+)
+
+func runFeatures(args []string) int {
+	fs := flag.NewFlagSet("features", flag.ContinueOnError)
+	all := fs.Bool("all", false, "Reanaliza también las canciones ya analizadas")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: catalogctl features [--all] [id...]")
+		fmt.Fprintln(os.Stderr, "Sin ids analiza las canciones con master que faltan (o todas con --all).")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	enc := transcode.NewEncoder()
+	if err := enc.Available(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	db.Connect()
+	music.ConfigureTranscoding(storage.FromEnv(), enc)
+
+	ids := fs.Args()
+	if len(ids) == 0 {
+		var err error
+		if ids, err = music.TracksPendingFeatures(*all); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ No se pudieron buscar las canciones:", err)
+			return 1
+		}
+	}
+
+	var failed []failedFile
+	for i, id := range ids {
+		f, err := music.AnalyzeTrackFeatures(context.Background(), id)
+		if err != nil {
+			failed = append(failed, failedFile{id, err})
+			continue
+		}
+		fmt.Printf("%s  %6.1f BPM  %-2s %-5s  energía %.2f  bailabilidad %.2f\n",
+			id, f.TempoBPM, audiofeatures.KeyNames[f.Key], f.Mode, f.Energy, f.Danceability)
+		if (i+1)%progressEvery == 0 {
+			fmt.Fprintf(os.Stderr, "… %d de %d canciones analizadas\n", i+1, len(ids))
+		}
+	}
+
+	fmt.Printf("\n%d canciones, %d con errores\n", len(ids), len(failed))
+	if len(failed) > 0 {
+		fmt.Println("\nCanciones que no se pudieron analizar:")
+		for _, f := range failed {
+			fmt.Printf("  %s: %v\n", f.path, f.err)
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/internal/music"
+)
+
+// Cada cuántos registros avisamos por dónde vamos
+const progressEvery = 500
+
+// Columnas CSV con listas: "Artista 1;Artista 2"
+var csvListColumns = map[string]bool{"featured_artists": true, "remixers": true}
+
+// Columnas CSV numéricas: en el JSON van como enteros, no como texto
+var csvIntColumns = map[string]bool{"duration": true, "track_number": true, "disc_number": true}
+
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Valida y muestra qué cambiaría, sin guardar nada")
+	format := fs.String("format", "", "jsonl o csv (por defecto, según la extensión del archivo)")
+	recordType := fs.String("type", "", "Tipo de los registros sin campo type: artist, album, track o lyrics")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: catalogctl import [--dry-run] [--format jsonl|csv] [--type track] archivo...")
+		fmt.Fprintln(os.Stderr, "En CSV la cabecera nombra los campos del JSON; duration, track_number y disc_number")
+		fmt.Fprintln(os.Stderr, "son enteros y featured_artists y remixers van separados por \";\".")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	db.Connect()
+	im, err := music.NewCatalogImporter(*dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ No se pudo iniciar la importación:", err)
+		return 1
+	}
+
+	var total, failed int
+	for _, path := range fs.Args() {
+		err := readRecords(path, *format, func(line int, rec models.CatalogRecord, err error) {
+			total++
+			if err == nil {
+				if rec.Type == "" {
+					rec.Type = *recordType
+				}
+				_, err = im.Import(rec)
+			}
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "%s:%d: %v\n", path, line, err)
+			}
+			if total%progressEvery == 0 {
+				fmt.Fprintf(os.Stderr, "… %d registros procesados\n", total)
+			}
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		}
+	}
+
+	if err := im.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error confirmando la importación:", err)
+		return 1
+	}
+
+	printSummary(im, total, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readRecords lee un archivo JSON Lines o CSV y llama a fn por cada registro con
+// su número de línea. Los errores de un registro se pasan a fn; solo se devuelve
+// error si no se pudo leer el archivo.
+func readRecords(path, format string, fn func(line int, rec models.CatalogRecord, err error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	switch format {
+	case "jsonl", "ndjson", "json":
+		return readJSONLines(f, fn)
+	case "csv":
+		return readCSV(f, fn)
+	}
+	return fmt.Errorf("formato desconocido %q (usa --format jsonl o csv)", format)
+}
+
+func readJSONLines(r io.Reader, fn func(int, models.CatalogRecord, error)) error {
+	scanner := bufio.NewScanner(r)
+	// Las letras pueden ocupar bastante en una sola línea
+	scanner.Buffer(make([]byte, 64*1024), 8*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		rec, err := decodeRecord(text)
+		fn(line, rec, err)
+	}
+	return scanner.Err()
+}
+
+func readCSV(r io.Reader, fn func(int, models.CatalogRecord, error)) error {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("no se pudo leer la cabecera: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			fn(parseErr.Line, models.CatalogRecord{}, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+
+		fields := map[string]interface{}{}
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			switch col := header[i]; {
+			case csvIntColumns[col]:
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					fields[col] = value // decodeRecord informará el tipo incorrecto
+				} else {
+					fields[col] = n
+				}
+			case csvListColumns[col]:
+				fields[col] = strings.Split(value, ";")
+			default:
+				fields[col] = value
+			}
+		}
+
+		data, _ := json.Marshal(fields)
+		rec, err := decodeRecord(data)
+		fn(line, rec, err)
+	}
+}
+
+// decodeRecord rechaza campos desconocidos para detectar erratas en los volcados
+func decodeRecord(data []byte) (models.CatalogRecord, error) {
+	var rec models.CatalogRecord
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rec); err != nil {
+		return rec, fmt.Errorf("registro inválido: %w", err)
+	}
+	for i, name := range rec.FeaturedArtists {
+		rec.FeaturedArtists[i] = strings.TrimSpace(name)
+	}
+	for i, name := range rec.Remixers {
+		rec.Remixers[i] = strings.TrimSpace(name)
+	}
+	return rec, nil
+}
+
+func printSummary(im *music.CatalogImporter, total, failed int) {
+	if im.DryRun {
+		fmt.Println("\nResumen (simulación: no se guardó nada)")
+	} else {
+		fmt.Println("\nResumen")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\tcreados\tactualizados\tsin cambios\t")
+	for _, entity := range []struct{ key, label string }{
+		{"artist", "artistas"}, {"album", "álbumes"}, {"track", "canciones"}, {"lyrics", "letras"},
+	} {
+		stats := im.Stats[entity.key]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", entity.label, stats["created"], stats["updated"], stats["unchanged"])
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d registros, %d con errores\n", total, failed)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/internal/music"
+	"github.com/giampier/super-app-api/internal/tags"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+// Extensiones que intentamos leer; el formato real se detecta por el contenido
+var audioExtensions = map[string]bool{
+	".mp3": true, ".flac": true, ".ogg": true, ".oga": true, ".opus": true, ".m4a": true, ".mp4": true,
+}
+
+// failedFile es un archivo que no pudimos ingerir y por qué
+type failedFile struct {
+	path string
+	err  error
+}
+
+func runIngest(args []string) int {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Lee las etiquetas y muestra qué cambiaría, sin guardar nada")
+	coversDir := fs.String("covers-dir", "covers", "Carpeta donde se guardan las portadas incrustadas")
+	coversURL := fs.String("covers-url", "/covers", "URL pública de esa carpeta")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: catalogctl ingest [--dry-run] [--covers-dir DIR] [--covers-url URL] carpeta...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	db.Connect()
+	im, err := music.NewCatalogImporter(*dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ No se pudo iniciar la ingesta:", err)
+		return 1
+	}
+
+	var total int
+	var failed []failedFile
+	for _, root := range fs.Args() {
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				failed = append(failed, failedFile{path, err})
+				return nil
+			}
+			if d.IsDir() || !audioExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+
+			total++
+			if err := ingestFile(im, path, *coversDir, *coversURL); err != nil {
+				failed = append(failed, failedFile{path, err})
+			}
+			if total%progressEvery == 0 {
+				fmt.Fprintf(os.Stderr, "… %d archivos procesados\n", total)
+			}
+			return nil
+		})
+		if err != nil {
+			failed = append(failed, failedFile{root, err})
+		}
+	}
+
+	if err := im.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error confirmando la ingesta:", err)
+		return 1
+	}
+
+	printSummary(im, total, len(failed))
+	if len(failed) > 0 {
+		fmt.Println("\nArchivos que no se pudieron ingerir:")
+		for _, f := range failed {
+			fmt.Printf("  %s: %v\n", f.path, f.err)
+		}
+		return 1
+	}
+	return 0
+}
+
+// ingestFile lee las etiquetas de un master y lo pasa por el mismo upsert que SyncTrack
+func ingestFile(im *music.CatalogImporter, path, coversDir, coversURL string) error {
+	meta, err := tags.Read(path)
+	if err != nil {
+		return err
+	}
+	if meta.Title == "" || len(meta.Artists) == 0 {
+		return fmt.Errorf("las etiquetas no traen título o artista")
+	}
+
+	artist, featured := ingestArtists(meta)
+	input := models.SyncTrackInput{
+		Title:           meta.Title,
+		Duration:        meta.DurationMs,
+		ArtistName:      artist,
+		FeaturedArtists: featured,
+		AlbumTitle:      meta.Album,
+		TrackNumber:     meta.TrackNumber,
+		DiscNumber:      meta.DiscNumber,
+		ISRC:            meta.ISRC,
+	}
+	// Sin álbum en las etiquetas lo tratamos como sencillo
+	if input.AlbumTitle == "" {
+		input.AlbumTitle = meta.Title
+	}
+
+	if meta.Cover != nil {
+		input.Cover, err = saveCover(meta.Cover, coversDir, coversURL, im.DryRun)
+		if err != nil {
+			return fmt.Errorf("no se pudo guardar la portada: %w", err)
+		}
+	}
+
+	_, err = im.Import(models.CatalogRecord{SyncBatchItem: models.SyncBatchItem{Type: "track", SyncTrackInput: input}})
+	return err
+}
+
+// saveCover guarda la portada con un nombre derivado de su contenido, así los
+// temas de un mismo álbum comparten archivo y reingerir no crea copias
+func saveCover(p *tags.Picture, dir, baseURL string, dryRun bool) (string, error) {
+	ext := ".jpg"
+	if p.MIMEType == "image/png" {
+		ext = ".png"
+	}
+	sum := sha1.Sum(p.Data)
+	name := hex.EncodeToString(sum[:])[:20] + ext
+	url := strings.TrimRight(baseURL, "/") + "/" + name
+	if dryRun {
+		return url, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return url, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	return url, os.WriteFile(path, p.Data, 0o644)
+}
+
+// ingestArtists elige el artista del álbum si la etiqueta existe, así todas las
+// pistas de un disco caen en el mismo álbum aunque cada una tenga sus invitados.
+// El resto de artistas de la pista quedan como colaboraciones.
+func ingestArtists(meta *tags.Metadata) (string, []string) {
+	if meta.AlbumArtist == "" {
+		return meta.Artists[0], meta.Artists[1:]
+	}
+	var featured []string
+	for _, name := range meta.Artists {
+		if utils.NameKey(name) != utils.NameKey(meta.AlbumArtist) {
+			featured = append(featured, name)
+		}
+	}
+	return meta.AlbumArtist, featured
+}
@@ -0,0 +1,56 @@
+// catalogctl es la herramienta de línea de comandos para administrar el catálogo.
+//
+//	catalogctl import [--dry-run] [--format jsonl|csv] [--type track] archivo...
+//	catalogctl ingest [--dry-run] [--covers-dir DIR] [--covers-url URL] carpeta...
+//	catalogctl features [--all] [id...]
+//	catalogctl duplicates [--min-confidence 0.6] [--json] [--skip-fingerprint]
+//	catalogctl artist-duplicates [--json]
+//	catalogctl reindex-lyrics
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Uso: catalogctl <comando> [opciones]
+
+Comandos:
+  import     Importa artistas, álbumes, canciones y letras desde JSON Lines o CSV
+  ingest     Recorre una carpeta de masters y los da de alta leyendo sus etiquetas
+  features   Analiza tempo, tonalidad, energía y bailabilidad de las canciones
+  duplicates Lista canciones que parecen la misma grabación (huella acústica)
+  artist-duplicates
+             Lista artistas con el mismo nombre normalizado ("Bad Bunny" / "bad bunny")
+  reindex-lyrics
+             Calcula el texto de búsqueda de las letras guardadas antes de tenerlo
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var code int
+	switch os.Args[1] {
+	case "import":
+		code = runImport(os.Args[2:])
+	case "ingest":
+		code = runIngest(os.Args[2:])
+	case "features":
+		code = runFeatures(os.Args[2:])
+	case "duplicates":
+		code = runDuplicates(os.Args[2:])
+	case "artist-duplicates":
+		code = runArtistDuplicates(os.Args[2:])
+	case "reindex-lyrics":
+		code = runReindexLyrics(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Comando desconocido: %s\n\n%s", os.Args[1], usage)
+		code = 2
+	}
+	os.Exit(code)
+}
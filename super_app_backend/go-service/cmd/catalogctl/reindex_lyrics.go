@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/music"
+)
+
+func runReindexLyrics(args []string) int {
+	fs := flag.NewFlagSet("reindex-lyrics", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: catalogctl reindex-lyrics")
+		fmt.Fprintln(os.Stderr, "Calcula el texto de búsqueda de las líneas de letra que no lo tienen (las anteriores a")
+		fmt.Fprintln(os.Stderr, "update_lyrics_search.sql). Para recalcular todo, poner search_text a NULL antes.")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	db.Connect()
+	n, err := music.ReindexLyricsSearch()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ No se pudo recalcular el texto de búsqueda:", err)
+		return 1
+	}
+	fmt.Printf("%d líneas actualizadas\n", n)
+	return 0
+}
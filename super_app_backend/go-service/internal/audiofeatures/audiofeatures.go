@@ -0,0 +1,312 @@
+// Package audiofeatures calcula cómo suena una canción a partir de su audio:
+// tempo (BPM), tonalidad y modo, energía y "bailabilidad".
+//
+// El Analyzer recibe audio mono float32 little-endian a 22050 Hz (lo que
+// produce "ffmpeg -ac 1 -ar 22050 -f f32le") como io.Writer y trabaja sobre
+// una STFT de 2048 muestras con saltos de 512, sin guardar el audio:
+//   - Tempo: autocorrelación de la envolvente de onsets (flujo espectral),
+//     con preferencia por tempos cercanos a 120 BPM para no caer en la mitad
+//     o el doble.
+//   - Tonalidad: cromagrama medio correlacionado con los perfiles de
+//     Krumhansl-Kessler mayor y menor en las 12 transposiciones.
+//   - Energía y bailabilidad: heurísticas 0..1 a partir del nivel RMS, la
+//     densidad de onsets y la regularidad del pulso.
+package audiofeatures
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+
+	"github.com/giampier/super-app-api/internal/dsp"
+)
+
+const (
+	// SampleRate es la frecuencia que espera el Analyzer
+	SampleRate = 22050
+	// Version cambia cuando cambian los algoritmos (para saber qué reanalizar)
+	Version = 1
+
+	frameSize = 2048
+	hopSize   = 512
+	minTempo  = 60.0
+	maxTempo  = 200.0
+	// Con menos de 10 s no hay pulso ni tonalidad fiables
+	minSeconds = 10
+)
+
+// ErrTooShort indica que no hubo audio suficiente para analizar
+var ErrTooShort = errors.New("audio demasiado corto para analizar")
+
+// KeyNames son las tonalidades por índice (0 = C)
+var KeyNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// Perfiles de Krumhansl-Kessler (desde la tónica)
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// Features es el resultado del análisis
+type Features struct {
+	TempoBPM      float64
+	Key           int    // 0 = C ... 11 = B
+	Mode          string // "major" o "minor"
+	KeyConfidence float64
+	Energy        float64 // 0..1
+	Danceability  float64 // 0..1
+}
+
+// Analyzer acumula la información de una canción mientras se decodifica
+type Analyzer struct {
+	frame   []float64 // Última ventana de frameSize muestras
+	hop     []float64 // Muestras nuevas desde el último salto
+	samples int64
+
+	window  []float64
+	fft     []complex128
+	binPC   []int // Clase de altura (0..11) de cada bin, -1 si queda fuera del rango útil
+	prevLog []float64
+
+	onset  []float64 // Flujo espectral por salto
+	rms    []float64 // RMS de cada salto
+	chroma [12]float64
+
+	pcm *dsp.F32LE
+}
+
+// NewAnalyzer prepara un analizador
+func NewAnalyzer() *Analyzer {
+	a := &Analyzer{
+		frame:   make([]float64, frameSize),
+		hop:     make([]float64, 0, hopSize),
+		window:  make([]float64, frameSize),
+		fft:     make([]complex128, frameSize),
+		binPC:   make([]int, frameSize/2+1),
+		prevLog: make([]float64, frameSize/2+1),
+	}
+	a.pcm = dsp.NewF32LE(func(x float32) { a.sample(float64(x)) })
+	for i := range a.window {
+		a.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/frameSize)
+	}
+	for k := range a.binPC {
+		a.binPC[k] = -1
+		freq := float64(k) * SampleRate / frameSize
+		// Entre A1 y ~B7: por debajo la resolución no separa semitonos
+		if freq >= 55 && freq <= 4000 {
+			midi := 69 + 12*math.Log2(freq/440)
+			a.binPC[k] = (int(math.Round(midi))%12 + 12) % 12
+		}
+	}
+	return a
+}
+
+// Write recibe muestras float32 little-endian mono
+func (a *Analyzer) Write(p []byte) (int, error) {
+	return a.pcm.Write(p)
+}
+
+func (a *Analyzer) sample(x float64) {
+	a.hop = append(a.hop, x)
+	a.samples++
+	if len(a.hop) < hopSize {
+		return
+	}
+
+	var sum float64
+	for _, s := range a.hop {
+		sum += s * s
+	}
+	a.rms = append(a.rms, math.Sqrt(sum/hopSize))
+
+	copy(a.frame, a.frame[hopSize:])
+	copy(a.frame[frameSize-hopSize:], a.hop)
+	a.hop = a.hop[:0]
+	if a.samples >= frameSize {
+		a.spectrum()
+	}
+}
+
+// spectrum procesa la ventana actual: flujo espectral y cromagrama
+func (a *Analyzer) spectrum() {
+	for i, s := range a.frame {
+		a.fft[i] = complex(s*a.window[i], 0)
+	}
+	dsp.FFT(a.fft)
+
+	var flux float64
+	for k := range a.prevLog {
+		mag := cmplx.Abs(a.fft[k])
+		// Compresión logarítmica: los onsets suaves también cuentan
+		logMag := math.Log1p(100 * mag)
+		if d := logMag - a.prevLog[k]; d > 0 {
+			flux += d
+		}
+		a.prevLog[k] = logMag
+		if pc := a.binPC[k]; pc >= 0 {
+			a.chroma[pc] += mag * mag
+		}
+	}
+	a.onset = append(a.onset, flux)
+}
+
+// Features termina el análisis
+func (a *Analyzer) Features() (Features, error) {
+	if a.samples < minSeconds*SampleRate {
+		return Features{}, ErrTooShort
+	}
+
+	var f Features
+	var regularity float64
+	f.TempoBPM, regularity = a.tempo()
+	f.Key, f.Mode, f.KeyConfidence = a.key()
+
+	// Energía: nivel RMS medio (-40 dBFS → 0, -6 dBFS → 1) y densidad de onsets
+	var sum float64
+	for _, r := range a.rms {
+		sum += r * r
+	}
+	rmsDB := 10 * math.Log10(sum/float64(len(a.rms))+1e-12)
+	level := clamp01((rmsDB + 40) / 34)
+	f.Energy = round3(0.7*level + 0.3*clamp01(a.onsetRate()/6))
+
+	// Bailabilidad: pulso regular y tempo cómodo para bailar (~120 BPM)
+	tempoFit := math.Exp(-0.5 * math.Pow((f.TempoBPM-120)/35, 2))
+	f.Danceability = round3(0.6*clamp01(regularity*2) + 0.25*tempoFit + 0.15*level)
+	return f, nil
+}
+
+// hopsPerSecond es la frecuencia de la envolvente de onsets
+const hopsPerSecond = float64(SampleRate) / hopSize
+
+// novelty devuelve la envolvente de onsets sin su media local y sin negativos
+func (a *Analyzer) novelty() []float64 {
+	n := len(a.onset)
+	out := make([]float64, n)
+	radius := SampleRate / hopSize / 2 // Medio segundo
+	var sum float64
+	lo, hi := 0, 0
+	for i := 0; i < n; i++ {
+		for hi < n && hi <= i+radius {
+			sum += a.onset[hi]
+			hi++
+		}
+		for lo < i-radius {
+			sum -= a.onset[lo]
+			lo++
+		}
+		if d := a.onset[i] - sum/float64(hi-lo); d > 0 {
+			out[i] = d
+		}
+	}
+	return out
+}
+
+// tempo devuelve el BPM y la regularidad del pulso (autocorrelación normalizada)
+func (a *Analyzer) tempo() (float64, float64) {
+	o := a.novelty()
+	autocorr := func(lag int) float64 {
+		var s float64
+		for t := 0; t+lag < len(o); t++ {
+			s += o[t] * o[t+lag]
+		}
+		return s / float64(len(o)-lag)
+	}
+
+	zero := autocorr(0)
+	if zero == 0 {
+		return 0, 0
+	}
+	minLag := int(math.Floor(60 * hopsPerSecond / maxTempo))
+	maxLag := int(math.Ceil(60 * hopsPerSecond / minTempo))
+	ac := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1 && lag < len(o); lag++ {
+		ac[lag] = autocorr(lag)
+	}
+
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		bpm := 60 * hopsPerSecond / float64(lag)
+		// Prior log-normal alrededor de 120 BPM (una octava de desviación)
+		weight := math.Exp(-0.5 * math.Pow(math.Log2(bpm/120), 2))
+		if score := ac[lag] * weight; score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0, 0
+	}
+
+	// Interpolación parabólica para no quedarnos en la rejilla de saltos
+	lag := float64(best)
+	if l, c, r := ac[best-1], ac[best], ac[best+1]; l+r-2*c != 0 {
+		lag += 0.5 * (l - r) / (l - 2*c + r)
+	}
+	return math.Round(60*hopsPerSecond/lag*10) / 10, ac[best] / zero
+}
+
+// key correlaciona el cromagrama con los perfiles en las 12 tónicas
+func (a *Analyzer) key() (int, string, float64) {
+	bestKey, bestMode, best := 0, "major", math.Inf(-1)
+	for tonic := 0; tonic < 12; tonic++ {
+		var rotated [12]float64
+		for i := range rotated {
+			rotated[i] = a.chroma[(tonic+i)%12]
+		}
+		if r := pearson(rotated, majorProfile); r > best {
+			bestKey, bestMode, best = tonic, "major", r
+		}
+		if r := pearson(rotated, minorProfile); r > best {
+			bestKey, bestMode, best = tonic, "minor", r
+		}
+	}
+	return bestKey, bestMode, round3(clamp01(best))
+}
+
+// onsetRate son los picos de la envolvente de onsets por segundo
+func (a *Analyzer) onsetRate() float64 {
+	o := a.novelty()
+	var mean, sq float64
+	for _, v := range o {
+		mean += v
+		sq += v * v
+	}
+	mean /= float64(len(o))
+	threshold := mean + 0.5*math.Sqrt(max(0, sq/float64(len(o))-mean*mean))
+
+	peaks := 0
+	for i := 1; i+1 < len(o); i++ {
+		if o[i] > threshold && o[i] >= o[i-1] && o[i] > o[i+1] {
+			peaks++
+		}
+	}
+	return float64(peaks) / (float64(len(o)) / hopsPerSecond)
+}
+
+func pearson(x, y [12]float64) float64 {
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= 12
+	my /= 12
+	var num, dx, dy float64
+	for i := range x {
+		num += (x[i] - mx) * (y[i] - my)
+		dx += (x[i] - mx) * (x[i] - mx)
+		dy += (y[i] - my) * (y[i] - my)
+	}
+	if dx == 0 || dy == 0 {
+		return 0
+	}
+	return num / math.Sqrt(dx*dy)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
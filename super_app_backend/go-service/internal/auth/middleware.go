@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+// userIDFromHeader extrae el user_id de un Access Token "Bearer" válido.
+// Devuelve "" si no hay token o si no es válido.
+func userIDFromHeader(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+
+	claims, err := utils.ValidateToken(strings.TrimPrefix(header, "Bearer "))
+	if err != nil || claims["type"] != "access" {
+		return ""
+	}
+
+	userID, _ := claims["user_id"].(string)
+	return userID
+}
+
+// OptionalAuth identifica al usuario si manda token, pero deja pasar a los anónimos
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID := userIDFromHeader(c); userID != "" {
+			c.Set("user_id", userID)
+		}
+		c.Next()
+	}
+}
+
+// RequireAuth corta la petición con 401 si no hay un Access Token válido
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := userIDFromHeader(c)
+		if userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token inválido o expirado"})
+			return
+		}
+		c.Set("user_id", userID)
+		c.Next()
+	}
+}
+
+// RequireRole exige un Access Token válido de un usuario con alguno de los roles dados.
+// Los "admin" siempre pasan.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := userIDFromHeader(c)
+		if userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token inválido o expirado"})
+			return
+		}
+
+		var role string
+		if err := db.DB.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+			return
+		}
+
+		allowed := role == "admin"
+		for _, r := range roles {
+			if role == r {
+				allowed = true
+			}
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "No tienes permisos para esta acción"})
+			return
+		}
+
+		c.Set("user_id", userID)
+		c.Set("user_role", role)
+		c.Next()
+	}
+}
+
+// CurrentUserID devuelve el usuario autenticado (o "" si es anónimo)
+func CurrentUserID(c *gin.Context) string {
+	return c.GetString("user_id")
+}
+
+// CurrentUserRole devuelve el rol del usuario autenticado ("" si es anónimo).
+// RequireRole ya lo deja en el contexto; si no, se consulta una vez.
+func CurrentUserRole(c *gin.Context) string {
+	if role := c.GetString("user_role"); role != "" {
+		return role
+	}
+	userID := CurrentUserID(c)
+	if userID == "" {
+		return ""
+	}
+	var role string
+	if err := db.DB.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role); err != nil {
+		return ""
+	}
+	c.Set("user_role", role)
+	return role
+}
+
+// IsModerator indica si el usuario autenticado es curador o admin
+func IsModerator(c *gin.Context) bool {
+	role := CurrentUserRole(c)
+	return role == "curator" || role == "admin"
+}
@@ -0,0 +1,70 @@
+// Package dsp reúne lo que comparten los análisis de audio (huellas,
+// características y sonoridad): leer las muestras float32 little-endian que
+// produce "ffmpeg -f f32le" y la FFT.
+package dsp
+
+import (
+	"encoding/binary"
+	"math"
+	"math/cmplx"
+)
+
+// F32LE convierte un flujo de bytes float32 little-endian en muestras. Guarda
+// los bytes de una muestra cortada entre dos Write para completarla en el siguiente.
+type F32LE struct {
+	sample  func(float32)
+	pending []byte
+}
+
+// NewF32LE llama a sample con cada muestra que llega por Write
+func NewF32LE(sample func(float32)) *F32LE {
+	return &F32LE{sample: sample}
+}
+
+// Write decodifica las muestras completas de p; nunca devuelve error
+func (d *F32LE) Write(p []byte) (int, error) {
+	written := len(p)
+	if len(d.pending) > 0 {
+		need := 4 - len(d.pending)
+		if len(p) < need {
+			d.pending = append(d.pending, p...)
+			return written, nil
+		}
+		d.pending = append(d.pending, p[:need]...)
+		d.sample(math.Float32frombits(binary.LittleEndian.Uint32(d.pending)))
+		d.pending = d.pending[:0]
+		p = p[need:]
+	}
+	for len(p) >= 4 {
+		d.sample(math.Float32frombits(binary.LittleEndian.Uint32(p)))
+		p = p[4:]
+	}
+	d.pending = append(d.pending, p...)
+	return written, nil
+}
+
+// FFT es una FFT radix-2 in-place (len(x) debe ser potencia de 2)
+func FFT(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u, v := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = u+v, u-v
+				w *= step
+			}
+		}
+	}
+}
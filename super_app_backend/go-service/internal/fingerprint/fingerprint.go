@@ -0,0 +1,258 @@
+// Package fingerprint calcula huellas acústicas al estilo de Chromaprint para
+// reconocer la misma grabación aunque llegue con otro título, otra fuente u
+// otra compresión.
+//
+// El Generator recibe audio mono float32 little-endian a 11025 Hz (lo que
+// produce "ffmpeg -ac 1 -ar 11025 -f f32le") como io.Writer. Cada ~124 ms
+// calcula un cromagrama de 12 clases de altura, lo suaviza en el tiempo y lo
+// resume en una sub-huella de 32 bits:
+//   - bits 31..20: cada clase comparada con la siguiente (forma del espectro)
+//   - bits 19..12: cada clase comparada con su tercera mayor (i, i+4)
+//   - bits 11..0: cada clase comparada con la misma clase dos ventanas antes
+//
+// Los 20 bits altos solo dependen de la forma del cromagrama, que sobrevive
+// bien a la recompresión, y se usan como términos del índice de similitud.
+package fingerprint
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"math/cmplx"
+
+	"github.com/giampier/super-app-api/internal/dsp"
+)
+
+const (
+	// SampleRate es la frecuencia que espera el Generator
+	SampleRate = 11025
+	// Version cambia cuando cambia el algoritmo (huellas de versiones
+	// distintas no se pueden comparar)
+	Version = 1
+	// MaxSeconds es cuánto audio se usa: como Chromaprint, el comienzo basta
+	// para reconocer una grabación
+	MaxSeconds = 120
+
+	frameSize = 4096
+	hopSize   = frameSize / 3
+	smoothing = 8 // Ventanas del promedio móvil del cromagrama (~1 s)
+	deltaLag  = 2 // Distancia de los bits temporales, en ventanas
+
+	// TermShift deja en un término los 20 bits de forma del cromagrama
+	TermShift = 12
+	// Se compara con un desplazamiento de hasta ~15 s (silencios distintos al
+	// principio) y pidiendo al menos ~10 s en común
+	maxOffset  = 120
+	minOverlap = 80
+)
+
+// Fingerprint es la secuencia de sub-huellas de una grabación
+type Fingerprint []uint32
+
+// Generator acumula la huella mientras se decodifica el audio
+type Generator struct {
+	frame   []float64
+	hop     []float64
+	samples int64
+
+	window []float64
+	fft    []complex128
+	binPC  []int
+
+	recent [][12]float64 // Últimos cromagramas sin suavizar
+	smooth [][12]float64 // Cromagramas suavizados de las últimas ventanas
+	fp     Fingerprint
+
+	pcm *dsp.F32LE
+}
+
+// NewGenerator prepara un generador de huellas
+func NewGenerator() *Generator {
+	g := &Generator{
+		frame:  make([]float64, frameSize),
+		hop:    make([]float64, 0, hopSize),
+		window: make([]float64, frameSize),
+		fft:    make([]complex128, frameSize),
+		binPC:  make([]int, frameSize/2+1),
+	}
+	g.pcm = dsp.NewF32LE(func(x float32) { g.sample(float64(x)) })
+	for i := range g.window {
+		g.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/frameSize)
+	}
+	for k := range g.binPC {
+		g.binPC[k] = -1
+		freq := float64(k) * SampleRate / frameSize
+		// Entre A1 y ~A7, como Chromaprint (28 Hz - 3,5 kHz recortado a lo que
+		// la resolución separa en semitonos)
+		if freq >= 55 && freq <= 3520 {
+			midi := 69 + 12*math.Log2(freq/440)
+			g.binPC[k] = (int(math.Round(midi))%12 + 12) % 12
+		}
+	}
+	return g
+}
+
+// Write recibe muestras float32 little-endian mono; lo que pase de
+// MaxSeconds se descarta
+func (g *Generator) Write(p []byte) (int, error) {
+	return g.pcm.Write(p)
+}
+
+func (g *Generator) sample(x float64) {
+	if g.samples >= MaxSeconds*SampleRate {
+		return
+	}
+	g.hop = append(g.hop, x)
+	g.samples++
+	if len(g.hop) < hopSize {
+		return
+	}
+	copy(g.frame, g.frame[hopSize:])
+	copy(g.frame[frameSize-hopSize:], g.hop)
+	g.hop = g.hop[:0]
+	if g.samples >= frameSize {
+		g.spectrum()
+	}
+}
+
+// spectrum calcula el cromagrama de la ventana actual y su sub-huella
+func (g *Generator) spectrum() {
+	for i, s := range g.frame {
+		g.fft[i] = complex(s*g.window[i], 0)
+	}
+	dsp.FFT(g.fft)
+
+	var chroma [12]float64
+	for k, pc := range g.binPC {
+		if pc >= 0 {
+			mag := cmplx.Abs(g.fft[k])
+			chroma[pc] += mag * mag
+		}
+	}
+	// Normalizado: el volumen no cambia la huella. El silencio queda en cero.
+	var norm float64
+	for _, v := range chroma {
+		norm += v * v
+	}
+	if norm = math.Sqrt(norm); norm > 1e-9 {
+		for i := range chroma {
+			chroma[i] /= norm
+		}
+	} else {
+		chroma = [12]float64{}
+	}
+
+	g.recent = append(g.recent, chroma)
+	if len(g.recent) > smoothing {
+		g.recent = g.recent[1:]
+	}
+	var avg [12]float64
+	for _, c := range g.recent {
+		for i, v := range c {
+			avg[i] += v / float64(len(g.recent))
+		}
+	}
+	g.smooth = append(g.smooth, avg)
+	if len(g.smooth) > deltaLag+1 {
+		g.smooth = g.smooth[1:]
+	}
+	g.fp = append(g.fp, subFingerprint(avg, g.smooth[0]))
+}
+
+// subFingerprint resume un cromagrama (y el de deltaLag ventanas antes)
+func subFingerprint(c, prev [12]float64) uint32 {
+	var fp uint32
+	for i := 0; i < 12; i++ {
+		if c[i] > c[(i+1)%12] {
+			fp |= 1 << (31 - i)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		if c[i] > c[(i+4)%12] {
+			fp |= 1 << (19 - i)
+		}
+	}
+	for i := 0; i < 12; i++ {
+		if c[i] > prev[i] {
+			fp |= 1 << (11 - i)
+		}
+	}
+	return fp
+}
+
+// Fingerprint devuelve la huella calculada hasta ahora
+func (g *Generator) Fingerprint() Fingerprint {
+	return g.fp
+}
+
+// DurationMs es el audio recibido hasta ahora (como mucho MaxSeconds)
+func (g *Generator) DurationMs() int64 {
+	return g.samples * 1000 / SampleRate
+}
+
+// Terms devuelve los términos distintos de la huella para el índice de
+// similitud (sin los del silencio)
+func (fp Fingerprint) Terms() []int32 {
+	seen := make(map[int32]bool)
+	var terms []int32
+	for _, sub := range fp {
+		term := int32(sub >> TermShift)
+		if term == 0 || seen[term] {
+			continue
+		}
+		seen[term] = true
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// Bytes serializa la huella (4 bytes little-endian por sub-huella)
+func (fp Fingerprint) Bytes() []byte {
+	b := make([]byte, 4*len(fp))
+	for i, sub := range fp {
+		binary.LittleEndian.PutUint32(b[4*i:], sub)
+	}
+	return b
+}
+
+// FromBytes es la inversa de Bytes
+func FromBytes(b []byte) Fingerprint {
+	fp := make(Fingerprint, len(b)/4)
+	for i := range fp {
+		fp[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return fp
+}
+
+// Compare alinea dos huellas y devuelve la confianza (0..1) de que sean la
+// misma grabación y el desplazamiento de b respecto de a en segundos. Dos
+// grabaciones distintas difieren en cerca de la mitad de los bits; una
+// recompresión de la misma, en pocos.
+func Compare(a, b Fingerprint) (confidence, offsetSeconds float64) {
+	bestBER, bestOffset := 1.0, 0
+	for offset := -maxOffset; offset <= maxOffset; offset++ {
+		var errors, compared int
+		for i := range a {
+			j := i + offset
+			if j < 0 || j >= len(b) {
+				continue
+			}
+			// Dos silencios coinciden sin decir nada de la grabación
+			if a[i] == 0 && b[j] == 0 {
+				continue
+			}
+			errors += bits.OnesCount32(a[i] ^ b[j])
+			compared++
+		}
+		if compared < minOverlap {
+			continue
+		}
+		if ber := float64(errors) / float64(32*compared); ber < bestBER {
+			bestBER, bestOffset = ber, offset
+		}
+	}
+	// BER 0,1 o menos → 1; BER 0,35 o más (lo normal entre grabaciones
+	// distintas) → 0
+	confidence = math.Max(0, math.Min(1, (0.35-bestBER)/0.25))
+	return math.Round(confidence*1000) / 1000, float64(bestOffset) * hopSize / SampleRate
+}
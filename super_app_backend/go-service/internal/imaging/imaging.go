@@ -0,0 +1,271 @@
+// Package imaging redimensiona portadas y fotos de artistas con la librería
+// estándar: decodifica JPEG, PNG y GIF, reduce con un promedio por área (el
+// mismo resultado que un "box filter", sin escalones al achicar mucho) y
+// codifica en JPEG. WebP, que la librería estándar no sabe escribir ni leer,
+// pasa por ffmpeg cuando está disponible.
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os/exec"
+)
+
+// Formatos de salida
+const (
+	JPEG = "jpeg"
+	WebP = "webp"
+)
+
+// MaxSide es el lado máximo que se genera (y el de una imagen sin tamaño pedido)
+const MaxSide = 2048
+
+// MaxPixels es lo más grande que se acepta decodificar (~36 MP, 144 MB en
+// RGBA): un archivo de pocos KB puede declarar un tamaño enorme
+const MaxPixels = 6000 * 6000
+
+var (
+	// ErrWebPUnavailable indica que no hay ffmpeg con libwebp
+	ErrWebPUnavailable = errors.New("WebP no disponible (falta ffmpeg con libwebp)")
+	// ErrTooLarge indica que la imagen pasa de MaxPixels
+	ErrTooLarge = errors.New("la imagen es demasiado grande")
+)
+
+// Decode lee una imagen; si la librería estándar no conoce el formato y hay
+// ffmpeg (ffmpegPath no vacío), la convierte primero a PNG. Antes de
+// decodificar mira el tamaño declarado y rechaza lo que pase de MaxPixels.
+func Decode(ctx context.Context, data []byte, ffmpegPath string) (image.Image, error) {
+	err := checkSize(data)
+	if err == nil {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		return img, err
+	}
+	if !errors.Is(err, image.ErrFormat) || ffmpegPath == "" {
+		return nil, err
+	}
+	converted, ffErr := runFFmpeg(ctx, ffmpegPath, data, "-f", "image2pipe", "-vcodec", "png", "-")
+	if ffErr != nil {
+		return nil, err
+	}
+	if err := checkSize(converted); err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(converted))
+}
+
+// checkSize lee solo la cabecera de la imagen
+func checkSize(data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// Fit calcula el tamaño final para una imagen de srcW x srcH con el ancho y
+// alto pedidos (0 = libre). Con los dos se recorta para llenar el recuadro;
+// con uno se conserva la proporción. Nunca agranda.
+func Fit(srcW, srcH, w, h int) (int, int) {
+	if w <= 0 && h <= 0 {
+		w = min(srcW, MaxSide)
+	}
+	switch {
+	case w <= 0:
+		h = min(h, srcH)
+		w = max(1, (srcW*h+srcH/2)/srcH)
+	case h <= 0:
+		w = min(w, srcW)
+		h = max(1, (srcH*w+srcW/2)/srcW)
+	default:
+		// Recuadro fijo: si la fuente es más chica se reduce el recuadro
+		// manteniendo su proporción
+		if scale := min(float64(srcW)/float64(w), float64(srcH)/float64(h)); scale < 1 {
+			w, h = max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+		}
+	}
+	return w, h
+}
+
+// Resize devuelve src reducida a w x h (calculados con Fit); si la proporción
+// no coincide recorta el centro
+func Resize(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	crop := b
+	// Recorte centrado con la proporción de destino
+	if sw, sh := b.Dx(), b.Dy(); sw*h != sh*w {
+		if sw*h > sh*w {
+			cw := sh * w / h
+			crop.Min.X += (sw - cw) / 2
+			crop.Max.X = crop.Min.X + cw
+		} else {
+			ch := sw * h / w
+			crop.Min.Y += (sh - ch) / 2
+			crop.Max.Y = crop.Min.Y + ch
+		}
+	}
+
+	// Una sola conversión a RGBA (draw está optimizado para YCbCr, paletas...)
+	cw, ch := crop.Dx(), crop.Dy()
+	rgba := image.NewRGBA(image.Rect(0, 0, cw, ch))
+	draw.Draw(rgba, rgba.Bounds(), src, crop.Min, draw.Src)
+
+	// Dos pasadas separables (horizontal y vertical) sobre valores premultiplicados
+	rows := make([]float64, 4*w*ch)
+	xw := weights(cw, w)
+	for y := 0; y < ch; y++ {
+		line := rgba.Pix[y*rgba.Stride:]
+		for x, taps := range xw {
+			acc := rows[4*(y*w+x):][:4]
+			for _, t := range taps {
+				p := line[4*t.index:][:4]
+				for i := range acc {
+					acc[i] += float64(p[i]) * t.weight
+				}
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	yw := weights(ch, h)
+	for y, taps := range yw {
+		for x := 0; x < w; x++ {
+			var acc [4]float64
+			for _, t := range taps {
+				p := rows[4*(t.index*w+x):][:4]
+				for i := range acc {
+					acc[i] += p[i] * t.weight
+				}
+			}
+			out := dst.Pix[y*dst.Stride+4*x:][:4]
+			for i := range acc {
+				out[i] = to8(acc[i])
+			}
+		}
+	}
+	return dst
+}
+
+type tap struct {
+	index  int
+	weight float64
+}
+
+// weights reparte cada píxel de destino entre los de origen que cubre, en
+// proporción al área cubierta
+func weights(srcN, dstN int) [][]tap {
+	scale := float64(srcN) / float64(dstN)
+	out := make([][]tap, dstN)
+	for d := range out {
+		lo, hi := float64(d)*scale, float64(d+1)*scale
+		for s := int(lo); s < srcN && float64(s) < hi; s++ {
+			cover := min(hi, float64(s+1)) - max(lo, float64(s))
+			if cover > 0 {
+				out[d] = append(out[d], tap{s, cover / scale})
+			}
+		}
+	}
+	return out
+}
+
+func to8(v float64) uint8 {
+	v += 0.5
+	if v > 255 {
+		return 255
+	}
+	if v < 0 {
+		return 0
+	}
+	return uint8(v)
+}
+
+// Encode codifica en JPEG o WebP (este último con ffmpeg)
+func Encode(ctx context.Context, img image.Image, format, ffmpegPath string) ([]byte, error) {
+	switch format {
+	case JPEG:
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: 85})
+		return buf.Bytes(), err
+	case WebP:
+		if ffmpegPath == "" {
+			return nil, ErrWebPUnavailable
+		}
+		var src bytes.Buffer
+		if err := png.Encode(&src, img); err != nil {
+			return nil, err
+		}
+		out, err := runFFmpeg(ctx, ffmpegPath, src.Bytes(), "-c:v", "libwebp", "-quality", "80", "-f", "webp", "-")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWebPUnavailable, err)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("formato desconocido %q", format)
+}
+
+// ContentType es el tipo MIME de un formato de salida
+func ContentType(format string) string {
+	if format == WebP {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// Placeholder es la imagen que se sirve cuando la fuente ya no existe: un
+// cuadro gris oscuro (el fondo de las tarjetas de la app)
+func Placeholder(w, h int) image.Image {
+	if w <= 0 && h <= 0 {
+		w, h = 300, 300
+	} else if w <= 0 {
+		w = h
+	} else if h <= 0 {
+		h = w
+	}
+	img := image.NewRGBA(image.Rect(0, 0, min(w, MaxSide), min(h, MaxSide)))
+	gray := color.RGBA{R: 0x28, G: 0x28, B: 0x28, A: 0xff}
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = gray.R, gray.G, gray.B, gray.A
+	}
+	return img
+}
+
+// flatten pinta la transparencia sobre blanco (JPEG no tiene canal alfa)
+func flatten(img image.Image) image.Image {
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Opaque() {
+		return img
+	}
+	out := image.NewRGBA(rgba.Bounds())
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		// Premultiplicado: sobre blanco se suma lo que falta de opacidad
+		a := rgba.Pix[i+3]
+		for c := 0; c < 3; c++ {
+			out.Pix[i+c] = rgba.Pix[i+c] + (255 - a)
+		}
+		out.Pix[i+3] = 255
+	}
+	return out
+}
+
+// runFFmpeg pasa data por la entrada estándar de ffmpeg y devuelve su salida
+func runFFmpeg(ctx context.Context, ffmpegPath string, data []byte, output ...string) ([]byte, error) {
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}, output...)
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// pngHeader arma un PNG que solo trae la cabecera: declara w x h sin datos
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8], ihdr[9] = 8, 2 // 8 bits, RGB
+
+	var b bytes.Buffer
+	b.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&b, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	b.Write(chunk)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return b.Bytes()
+}
+
+func TestDecodeRejectsHugeImages(t *testing.T) {
+	if _, err := Decode(context.Background(), pngHeader(50000, 50000), ""); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("se esperaba ErrTooLarge, llegó %v", err)
+	}
+
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewGray(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	img, err := Decode(context.Background(), small.Bytes(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+		t.Fatalf("tamaño %dx%d, se esperaba 40x30", b.Dx(), b.Dy())
+	}
+
+	if _, err := Decode(context.Background(), []byte("no es una imagen"), ""); !errors.Is(err, image.ErrFormat) {
+		t.Fatalf("se esperaba image.ErrFormat, llegó %v", err)
+	}
+}
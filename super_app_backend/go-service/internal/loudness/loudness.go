@@ -0,0 +1,231 @@
+// Package loudness mide la sonoridad integrada (EBU R128 / ITU-R BS.1770-4) y
+// el true peak de audio PCM, y calcula la ganancia de normalización estilo
+// ReplayGain 2.0.
+//
+// El Meter recibe muestras float32 little-endian intercaladas a 48 kHz (lo que
+// produce "ffmpeg -f f32le -ar 48000"), así que se le puede conectar
+// directamente la salida de ffmpeg como io.Writer.
+package loudness
+
+import (
+	"math"
+
+	"github.com/giampier/super-app-api/internal/dsp"
+)
+
+const (
+	// SampleRate es la frecuencia que espera el Meter (los filtros K están
+	// calculados para ella)
+	SampleRate = 48000
+	// ReferenceLUFS es el nivel objetivo de ReplayGain 2.0
+	ReferenceLUFS = -18.0
+
+	blockSubdivisions = 4               // Bloques de 400 ms con solapamiento del 75%
+	subBlockSamples   = SampleRate / 10 // 100 ms
+	absoluteGate      = -70.0           // LUFS
+	relativeGate      = -10.0           // LU por debajo de la sonoridad sin gate relativo
+	truePeakTaps      = 48              // FIR de sobremuestreo del anexo 2 de BS.1770-4
+	truePeakFactor    = 4               // Sobremuestreo x4 a 48 kHz
+	truePeakPhaseTaps = truePeakTaps / truePeakFactor
+)
+
+// biquad es un filtro IIR de segundo orden (forma directa II transpuesta)
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// Coeficientes del filtro K a 48 kHz (BS.1770-4, tablas 1 y 2)
+func kWeighting() [2]biquad {
+	return [2]biquad{
+		{b0: 1.53512485958697, b1: -2.69169618940638, b2: 1.19839281085285, a1: -1.69065929318241, a2: 0.73248077421585},
+		{b0: 1.0, b1: -2.0, b2: 1.0, a1: -1.99004745483398, a2: 0.99007225036621},
+	}
+}
+
+// Filtro de interpolación para el true peak: sinc enventanado (Hann) de 48
+// coeficientes repartido en 4 fases de 12
+var truePeakPhases = func() [truePeakFactor][truePeakPhaseTaps]float64 {
+	var phases [truePeakFactor][truePeakPhaseTaps]float64
+	center := float64(truePeakTaps-1) / 2
+	for n := 0; n < truePeakTaps; n++ {
+		x := (float64(n) - center) / truePeakFactor
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(n)/float64(truePeakTaps-1))
+		phases[n%truePeakFactor][n/truePeakFactor] = sinc * window
+	}
+	return phases
+}()
+
+// channel es el estado de un canal
+type channel struct {
+	filters [2]biquad
+	sum     float64                    // Energía del sub-bloque de 100 ms en curso
+	history [truePeakPhaseTaps]float64 // Últimas muestras para el true peak
+	pos     int
+}
+
+// Meter acumula la medición de una canción (o de varias, para un álbum)
+type Meter struct {
+	channels []channel
+	weights  []float64
+
+	frame     int       // Muestras por canal del sub-bloque en curso
+	subBlocks []float64 // Energía ponderada de los últimos sub-bloques
+	blocks    []float64 // Energía media de cada bloque de 400 ms
+	peak      float64   // True peak lineal
+	frames    int64
+
+	pcm *dsp.F32LE
+}
+
+// NewMeter crea un medidor para audio de n canales (1 o 2; con más canales
+// todos pesan 1, así que conviene mezclar a estéreo antes)
+func NewMeter(n int) *Meter {
+	m := &Meter{channels: make([]channel, n), weights: make([]float64, n)}
+	for i := range m.channels {
+		m.channels[i].filters = kWeighting()
+		m.weights[i] = 1
+	}
+	m.pcm = dsp.NewF32LE(m.sample)
+	return m
+}
+
+// Write recibe muestras float32 little-endian intercaladas
+func (m *Meter) Write(p []byte) (int, error) {
+	return m.pcm.Write(p)
+}
+
+// WriteSamples recibe muestras ya decodificadas, intercaladas
+func (m *Meter) WriteSamples(samples []float32) {
+	for _, s := range samples {
+		m.sample(s)
+	}
+}
+
+// next es el canal de la próxima muestra
+func (m *Meter) next() int {
+	return int(m.frames % int64(len(m.channels)))
+}
+
+func (m *Meter) sample(s float32) {
+	ch := m.next()
+	c := &m.channels[ch]
+	x := float64(s)
+
+	y := c.filters[1].process(c.filters[0].process(x))
+	c.sum += y * y
+	m.truePeak(c, x)
+
+	m.frames++
+	if m.next() != 0 {
+		return
+	}
+	m.frame++
+	if m.frame == subBlockSamples {
+		m.closeSubBlock()
+	}
+}
+
+// truePeak interpola la señal x4 y guarda el máximo absoluto
+func (m *Meter) truePeak(c *channel, x float64) {
+	c.history[c.pos] = x
+	c.pos = (c.pos + 1) % truePeakPhaseTaps
+	for _, phase := range truePeakPhases {
+		var y float64
+		for k, h := range phase {
+			// history[pos-1] es la muestra más reciente
+			y += h * c.history[(c.pos-1-k+2*truePeakPhaseTaps)%truePeakPhaseTaps]
+		}
+		m.peak = max(m.peak, math.Abs(y))
+	}
+	m.peak = max(m.peak, math.Abs(x))
+}
+
+func (m *Meter) closeSubBlock() {
+	var energy float64
+	for i := range m.channels {
+		energy += m.weights[i] * m.channels[i].sum
+		m.channels[i].sum = 0
+	}
+	m.frame = 0
+
+	m.subBlocks = append(m.subBlocks, energy)
+	if len(m.subBlocks) > blockSubdivisions {
+		m.subBlocks = m.subBlocks[1:]
+	}
+	if len(m.subBlocks) == blockSubdivisions {
+		var sum float64
+		for _, e := range m.subBlocks {
+			sum += e
+		}
+		m.blocks = append(m.blocks, sum/(blockSubdivisions*subBlockSamples))
+	}
+}
+
+// Add suma los bloques y el pico de otro medidor (sonoridad de álbum: el
+// gating se aplica sobre los bloques de todas las canciones juntas)
+func (m *Meter) Add(other *Meter) {
+	m.blocks = append(m.blocks, other.blocks...)
+	m.peak = max(m.peak, other.peak)
+	m.frames += other.frames
+}
+
+// Integrated devuelve la sonoridad integrada en LUFS (-Inf si es silencio o
+// dura menos de 400 ms)
+func (m *Meter) Integrated() float64 {
+	gated := func(threshold float64) (float64, int) {
+		var sum float64
+		var n int
+		for _, e := range m.blocks {
+			if blockLoudness(e) > threshold {
+				sum += e
+				n++
+			}
+		}
+		return sum, n
+	}
+
+	sum, n := gated(absoluteGate)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+	threshold := max(absoluteGate, blockLoudness(sum/float64(n))+relativeGate)
+	sum, n = gated(threshold)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+	return blockLoudness(sum / float64(n))
+}
+
+// TruePeak devuelve el true peak en dBTP
+func (m *Meter) TruePeak() float64 {
+	return 20 * math.Log10(m.peak)
+}
+
+// DurationMs es lo medido hasta ahora
+func (m *Meter) DurationMs() int64 {
+	if len(m.channels) == 0 {
+		return 0
+	}
+	return m.frames / int64(len(m.channels)) * 1000 / SampleRate
+}
+
+// Gain es la ganancia en dB que lleva la sonoridad dada a ReferenceLUFS
+func Gain(integrated float64) float64 {
+	return ReferenceLUFS - integrated
+}
+
+func blockLoudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
@@ -0,0 +1,91 @@
+package lyrics
+
+import "strings"
+
+// Diff compara dos letras línea a línea (LCS) y devuelve un diff legible:
+// "  " línea igual, "- " línea quitada, "+ " línea nueva.
+func Diff(old, new string) string {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	// lcs[i][j] = longitud de la subsecuencia común de a[i:] y b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out.WriteString("- " + a[i] + "\n")
+	}
+	for ; j < len(b); j++ {
+		out.WriteString("+ " + b[j] + "\n")
+	}
+	return out.String()
+}
+
+// DiffStats cuenta las líneas añadidas y quitadas de un diff
+func DiffStats(diff string) (added, removed int) {
+	for _, l := range splitLines(diff) {
+		switch {
+		case strings.HasPrefix(l, "+ "):
+			added++
+		case strings.HasPrefix(l, "- "):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// Canonical serializa la letra en la forma que guardamos en las revisiones:
+// LRC mejorado si tiene tiempos, texto plano (una línea por renglón) si no.
+func (d *Document) Canonical() (content, format string) {
+	if d.Synced {
+		return d.FormatEnhancedLRC(), "lrc"
+	}
+	var b strings.Builder
+	for _, l := range d.Lines {
+		b.WriteString(l.Text + "\n")
+	}
+	return b.String(), "text"
+}
+
+// ParseCanonical es la inversa de Canonical
+func ParseCanonical(content, format string) (*Document, error) {
+	if format == "text" {
+		return ParsePlain(content)
+	}
+	return Parse(content)
+}
@@ -0,0 +1,128 @@
+package lyrics
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+type token struct {
+	norm       string
+	start, end int
+}
+
+// tokenize separa una línea en palabras normalizadas con su posición en runas.
+// Cada palabra se normaliza con utils.SearchText, lo mismo que la búsqueda en
+// SQL, así que una línea encontrada siempre tiene algo que resaltar.
+func tokenize(s string) []token {
+	var tokens []token
+	runes := []rune(s)
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		inWord := i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || isApostrophe(runes[i]) || unicode.Is(unicode.Mn, runes[i]))
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			norm := utils.SearchText(string(runes[start:i]))
+			if norm != "" {
+				tokens = append(tokens, token{norm: norm, start: start, end: i})
+			}
+			start = -1
+		}
+	}
+	return tokens
+}
+
+// Highlight marca las palabras de la línea que coinciden (aunque sea con
+// pequeñas faltas o sin tildes) con las de la búsqueda
+func Highlight(line, query string) []models.TextSpan {
+	queryTokens := tokenize(query)
+	var spans []models.TextSpan
+
+	for _, t := range tokenize(line) {
+		matched := false
+		for _, q := range queryTokens {
+			if fuzzyEqual(t.norm, q.norm) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		// Palabras contiguas se funden en un solo tramo ("been tryna")
+		if n := len(spans); n > 0 && onlySpaces(line, spans[n-1].End, t.start) {
+			spans[n-1].End = t.end
+		} else {
+			spans = append(spans, models.TextSpan{Start: t.start, End: t.end})
+		}
+	}
+	return spans
+}
+
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’' || r == '‘' || r == 'ʼ' || r == '`'
+}
+
+// Mark devuelve la línea como HTML: el texto escapado y los tramos envueltos
+// en <em></em>
+func Mark(line string, spans []models.TextSpan) string {
+	runes := []rune(line)
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		b.WriteString(html.EscapeString(string(runes[last:s.Start])))
+		b.WriteString("<em>" + html.EscapeString(string(runes[s.Start:s.End])) + "</em>")
+		last = s.End
+	}
+	b.WriteString(html.EscapeString(string(runes[last:])))
+	return b.String()
+}
+
+func onlySpaces(s string, from, to int) bool {
+	return strings.TrimSpace(string([]rune(s)[from:to])) == ""
+}
+
+// fuzzyEqual tolera 1 error en palabras de 4+ letras y 2 en las de 8+
+func fuzzyEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, rb := []rune(a), []rune(b)
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+
+	allowed := 0
+	switch {
+	case maxLen >= 8:
+		allowed = 2
+	case maxLen >= 4:
+		allowed = 1
+	}
+	return allowed > 0 && levenshtein(ra, rb) <= allowed
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
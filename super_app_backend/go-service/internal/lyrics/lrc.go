@@ -0,0 +1,310 @@
+package lyrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document es una letra ya interpretada, lista para guardar en la tabla lyrics
+type Document struct {
+	Tags   map[string]string // Metadatos LRC: ar, ti, al, by, length...
+	Offset int               // [offset:] original en ms (ya aplicado a los tiempos)
+	Synced bool              // false = texto plano sin tiempos
+	Lines  []Line
+}
+
+// Line es una línea de la letra. EndMs = 0 si no se conoce el final.
+type Line struct {
+	TimeMs int
+	EndMs  int
+	Text   string
+	Words  []Word // Tiempos por palabra/sílaba (LRC mejorado o TTML)
+}
+
+// Word es una palabra o sílaba con su propio tiempo (modo karaoke)
+type Word struct {
+	StartMs int
+	EndMs   int
+	Text    string // Conserva los espacios para poder unir sílabas
+}
+
+var (
+	// [mm:ss], [mm:ss.xx], [mm:ss.xxx] o [mm:ss:xx]
+	timeTagRe = regexp.MustCompile(`^\[(\d{1,3}):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	// <mm:ss.xx> para las palabras del LRC mejorado
+	wordTagRe = regexp.MustCompile(`<(\d{1,3}):(\d{1,2})(?:[.:](\d{1,3}))?>`)
+	// [clave:valor] para los metadatos
+	metaTagRe = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]$`)
+)
+
+var ErrEmpty = errors.New("la letra está vacía")
+
+// ParseTimestamp convierte "mm", "ss" y la fracción opcional a milisegundos
+func ParseTimestamp(min, sec, frac string) int {
+	m, _ := strconv.Atoi(min)
+	s, _ := strconv.Atoi(sec)
+	ms := 0
+	if frac != "" {
+		f, _ := strconv.Atoi(frac)
+		switch len(frac) {
+		case 1:
+			ms = f * 100
+		case 2:
+			ms = f * 10
+		default:
+			ms = f
+		}
+	}
+	return (m*60+s)*1000 + ms
+}
+
+// FormatTimestamp devuelve el tiempo en formato LRC mm:ss.xx
+func FormatTimestamp(ms int) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%02d:%02d.%02d", ms/60000, (ms/1000)%60, (ms%1000)/10)
+}
+
+// Parse interpreta una letra en LRC. Si no encuentra ninguna marca de tiempo
+// la trata como texto plano (una línea por renglón, sin sincronizar).
+func Parse(input string) (*Document, error) {
+	doc := &Document{Tags: map[string]string{}}
+	var plain []string
+
+	scanner := bufio.NewScanner(strings.NewReader(strings.TrimPrefix(input, "\ufeff")))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+
+		// Una línea puede tener varias marcas: [00:12.00][01:40.00]Estribillo
+		var times []int
+		rest := raw
+		for {
+			m := timeTagRe.FindStringSubmatch(rest)
+			if m == nil {
+				break
+			}
+			times = append(times, ParseTimestamp(m[1], m[2], m[3]))
+			rest = rest[len(m[0]):]
+		}
+
+		if len(times) > 0 {
+			doc.Synced = true
+			text, words := parseWords(rest, times[0])
+			for _, t := range times {
+				// Si la línea se repite, desplazamos sus palabras al nuevo inicio
+				shifted := make([]Word, len(words))
+				for i, w := range words {
+					shifted[i] = Word{StartMs: w.StartMs + t - times[0], EndMs: w.EndMs, Text: w.Text}
+					if w.EndMs > 0 {
+						shifted[i].EndMs += t - times[0]
+					}
+				}
+				doc.Lines = append(doc.Lines, Line{TimeMs: t, Text: text, Words: shifted})
+			}
+			continue
+		}
+
+		if m := metaTagRe.FindStringSubmatch(raw); m != nil {
+			key := strings.ToLower(strings.TrimSpace(m[1]))
+			value := strings.TrimSpace(m[2])
+			if key == "offset" {
+				doc.Offset, _ = strconv.Atoi(strings.TrimPrefix(value, "+"))
+			}
+			doc.Tags[key] = value
+			continue
+		}
+
+		plain = append(plain, raw)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !doc.Synced {
+		for _, text := range plain {
+			doc.Lines = append(doc.Lines, Line{Text: text})
+		}
+	} else {
+		// Un offset positivo adelanta la letra
+		for i := range doc.Lines {
+			l := &doc.Lines[i]
+			l.TimeMs = shift(l.TimeMs, doc.Offset)
+			for j := range l.Words {
+				l.Words[j].StartMs = shift(l.Words[j].StartMs, doc.Offset)
+				if l.Words[j].EndMs > 0 {
+					l.Words[j].EndMs = shift(l.Words[j].EndMs, doc.Offset)
+				}
+			}
+		}
+		doc.Finalize()
+	}
+
+	if len(doc.Lines) == 0 {
+		return nil, ErrEmpty
+	}
+	return doc, nil
+}
+
+func shift(ms, offset int) int {
+	if ms -= offset; ms < 0 {
+		return 0
+	}
+	return ms
+}
+
+// parseWords separa "<00:12.00>I've <00:12.50>been" en palabras con tiempo.
+// Una marca final sin texto ("...<00:14.00>") indica el final de la última palabra.
+func parseWords(rest string, lineStart int) (string, []Word) {
+	matches := wordTagRe.FindAllStringSubmatchIndex(rest, -1)
+	if matches == nil {
+		return strings.TrimSpace(rest), nil
+	}
+
+	var words []Word
+	if lead := rest[:matches[0][0]]; strings.TrimSpace(lead) != "" {
+		words = append(words, Word{StartMs: lineStart, Text: lead})
+	}
+	for i, m := range matches {
+		start := ParseTimestamp(rest[m[2]:m[3]], rest[m[4]:m[5]], optional(rest, m[6], m[7]))
+		end := len(rest)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+
+		if len(words) > 0 && words[len(words)-1].EndMs == 0 {
+			words[len(words)-1].EndMs = start
+		}
+		if text := rest[m[1]:end]; strings.TrimSpace(text) != "" {
+			words = append(words, Word{StartMs: start, Text: text})
+		}
+	}
+
+	var text strings.Builder
+	for _, w := range words {
+		text.WriteString(w.Text)
+	}
+	return strings.TrimSpace(text.String()), words
+}
+
+func optional(s string, from, to int) string {
+	if from < 0 {
+		return ""
+	}
+	return s[from:to]
+}
+
+// Finalize ordena las líneas y completa los finales que falten:
+// una línea termina donde empieza la siguiente (o con su última palabra).
+func (d *Document) Finalize() {
+	if !d.Synced {
+		return
+	}
+	sort.SliceStable(d.Lines, func(i, j int) bool { return d.Lines[i].TimeMs < d.Lines[j].TimeMs })
+
+	for i := range d.Lines {
+		l := &d.Lines[i]
+		next := 0
+		if i+1 < len(d.Lines) {
+			next = d.Lines[i+1].TimeMs
+		}
+
+		for j := range l.Words {
+			if l.Words[j].EndMs == 0 {
+				if j+1 < len(l.Words) {
+					l.Words[j].EndMs = l.Words[j+1].StartMs
+				} else {
+					l.Words[j].EndMs = next
+				}
+			}
+		}
+
+		if l.EndMs == 0 {
+			if n := len(l.Words); n > 0 && l.Words[n-1].EndMs > 0 {
+				l.EndMs = l.Words[n-1].EndMs
+			} else {
+				l.EndMs = next
+			}
+		}
+	}
+}
+
+// ParsePlain trata la entrada como texto plano, sin interpretar corchetes
+func ParsePlain(input string) (*Document, error) {
+	doc := &Document{Tags: map[string]string{}}
+	for _, raw := range strings.Split(strings.TrimPrefix(input, "\ufeff"), "\n") {
+		if text := strings.TrimSpace(raw); text != "" {
+			doc.Lines = append(doc.Lines, Line{Text: text})
+		}
+	}
+	if len(doc.Lines) == 0 {
+		return nil, ErrEmpty
+	}
+	return doc, nil
+}
+
+// Orden estable para exportar los metadatos más comunes primero
+var tagOrder = []string{"ti", "ar", "al", "au", "by", "length", "re", "ve"}
+
+// FormatLRC genera un LRC estándar. El offset ya está aplicado en los tiempos,
+// así que no se vuelve a exportar.
+func (d *Document) FormatLRC() string {
+	return d.format(func(l Line) string { return l.Text })
+}
+
+// FormatEnhancedLRC es como FormatLRC pero con las marcas <mm:ss.xx> de cada palabra
+func (d *Document) FormatEnhancedLRC() string {
+	return d.format(func(l Line) string {
+		if len(l.Words) == 0 {
+			return l.Text
+		}
+		var b strings.Builder
+		for _, w := range l.Words {
+			fmt.Fprintf(&b, "<%s>%s", FormatTimestamp(w.StartMs), w.Text)
+		}
+		if last := l.Words[len(l.Words)-1]; last.EndMs > 0 {
+			fmt.Fprintf(&b, "<%s>", FormatTimestamp(last.EndMs))
+		}
+		return b.String()
+	})
+}
+
+func (d *Document) format(lineText func(Line) string) string {
+	var b strings.Builder
+
+	written := map[string]bool{"offset": true}
+	for _, key := range tagOrder {
+		if v, ok := d.Tags[key]; ok {
+			fmt.Fprintf(&b, "[%s:%s]\n", key, v)
+			written[key] = true
+		}
+	}
+	var extra []string
+	for key := range d.Tags {
+		if !written[key] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		fmt.Fprintf(&b, "[%s:%s]\n", key, d.Tags[key])
+	}
+
+	for _, l := range d.Lines {
+		if d.Synced {
+			fmt.Fprintf(&b, "[%s]%s\n", FormatTimestamp(l.TimeMs), lineText(l))
+		} else {
+			b.WriteString(l.Text + "\n")
+		}
+	}
+	return b.String()
+}
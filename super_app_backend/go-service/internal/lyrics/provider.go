@@ -0,0 +1,120 @@
+package lyrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound indica que el proveedor no tiene letra para esa canción
+var ErrNotFound = errors.New("letra no encontrada en el proveedor")
+
+// Query identifica la canción que buscamos en un proveedor externo
+type Query struct {
+	TrackName  string
+	ArtistName string
+	AlbumName  string
+	DurationMs int
+}
+
+// Result es la letra que devuelve un proveedor
+type Result struct {
+	SourceID     string // ID de la letra en el proveedor
+	Synced       string // LRC con tiempos (puede venir vacío)
+	Plain        string // Texto plano
+	Instrumental bool
+}
+
+// Provider es cualquier fuente externa de letras
+type Provider interface {
+	Name() string
+	Fetch(ctx context.Context, q Query) (*Result, error)
+}
+
+// LRCLIB habla con la API de lrclib.net (o un servidor compatible)
+type LRCLIB struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewLRCLIB crea el cliente. baseURL vacío = https://lrclib.net
+func NewLRCLIB(baseURL string) *LRCLIB {
+	if baseURL == "" {
+		baseURL = "https://lrclib.net"
+	}
+	return &LRCLIB{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *LRCLIB) Name() string { return "lrclib" }
+
+// Fetch usa GET /api/get, que exige coincidencia de título, artista, álbum y duración (±2s)
+func (p *LRCLIB) Fetch(ctx context.Context, q Query) (*Result, error) {
+	params := url.Values{}
+	params.Set("track_name", q.TrackName)
+	params.Set("artist_name", q.ArtistName)
+	if q.AlbumName != "" {
+		params.Set("album_name", q.AlbumName)
+	}
+	if q.DurationMs > 0 {
+		params.Set("duration", strconv.Itoa((q.DurationMs+500)/1000))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/api/get?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// LRCLIB pide identificar la app que hace las peticiones
+	req.Header.Set("User-Agent", "SuperApp Streaming (https://github.com/GiamMoon/Stream-Music)")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lrclib respondió %d", resp.StatusCode)
+	}
+
+	var body struct {
+		ID           int64  `json:"id"`
+		Instrumental bool   `json:"instrumental"`
+		PlainLyrics  string `json:"plainLyrics"`
+		SyncedLyrics string `json:"syncedLyrics"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("respuesta de lrclib inválida: %w", err)
+	}
+
+	return &Result{
+		SourceID:     strconv.FormatInt(body.ID, 10),
+		Synced:       body.SyncedLyrics,
+		Plain:        body.PlainLyrics,
+		Instrumental: body.Instrumental,
+	}, nil
+}
+
+// Document convierte el resultado en una letra lista para guardar (prefiere la sincronizada)
+func (r *Result) Document() (*Document, error) {
+	if strings.TrimSpace(r.Synced) != "" {
+		if doc, err := Parse(r.Synced); err == nil {
+			return doc, nil
+		}
+	}
+	if strings.TrimSpace(r.Plain) != "" {
+		return ParsePlain(r.Plain)
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,100 @@
+package lyrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeLRCLIB responde como lrclib.net según el título pedido
+func fakeLRCLIB(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/get" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("User-Agent") == "" {
+			t.Error("falta User-Agent")
+		}
+		q := r.URL.Query()
+		switch q.Get("track_name") {
+		case "Hit":
+			if q.Get("artist_name") != "Artista" || q.Get("album_name") != "Disco" || q.Get("duration") != "185" {
+				t.Errorf("parámetros inesperados: %v", q)
+			}
+			w.Write([]byte(`{"id": 42, "instrumental": false, "plainLyrics": "hola\nmundo",
+				"syncedLyrics": "[00:01.00]hola\n[00:02.50]mundo"}`))
+		case "Instrumental":
+			w.Write([]byte(`{"id": 7, "instrumental": true}`))
+		case "Roto":
+			w.Write([]byte(`{"id": `))
+		case "Caido":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": 404, "name": "TrackNotFound"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLRCLIBHit(t *testing.T) {
+	p := NewLRCLIB(fakeLRCLIB(t).URL + "/")
+	res, err := p.Fetch(context.Background(), Query{TrackName: "Hit", ArtistName: "Artista", AlbumName: "Disco", DurationMs: 184600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SourceID != "42" || res.Instrumental {
+		t.Fatalf("resultado inesperado: %+v", res)
+	}
+
+	doc, err := res.Document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.Synced || len(doc.Lines) != 2 || doc.Lines[1].TimeMs != 2500 || doc.Lines[1].Text != "mundo" {
+		t.Fatalf("documento inesperado: %+v", doc)
+	}
+}
+
+func TestLRCLIBMiss(t *testing.T) {
+	p := NewLRCLIB(fakeLRCLIB(t).URL)
+	if _, err := p.Fetch(context.Background(), Query{TrackName: "Nada", ArtistName: "Nadie"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("se esperaba ErrNotFound, llegó %v", err)
+	}
+}
+
+func TestLRCLIBInstrumental(t *testing.T) {
+	p := NewLRCLIB(fakeLRCLIB(t).URL)
+	res, err := p.Fetch(context.Background(), Query{TrackName: "Instrumental", ArtistName: "Artista"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Instrumental {
+		t.Fatal("se esperaba instrumental")
+	}
+	if _, err := res.Document(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("una instrumental no tiene documento, llegó %v", err)
+	}
+}
+
+func TestLRCLIBErrors(t *testing.T) {
+	p := NewLRCLIB(fakeLRCLIB(t).URL)
+	for _, track := range []string{"Caido", "Roto"} {
+		_, err := p.Fetch(context.Background(), Query{TrackName: track, ArtistName: "Artista"})
+		if err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: se esperaba un error del proveedor, llegó %v", track, err)
+		}
+	}
+
+	// Servidor inaccesible
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	if _, err := NewLRCLIB(srv.URL).Fetch(context.Background(), Query{TrackName: "Hit"}); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("se esperaba un error de red, llegó %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package lyrics
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseTTML interpreta letras en TTML (el formato de subtítulos del W3C que usan
+// muchos proveedores para karaoke). Cada <p> es una línea y cada <span begin>
+// dentro de ella es una palabra o sílaba.
+func ParseTTML(input string) (*Document, error) {
+	doc := &Document{Tags: map[string]string{}}
+	dec := xml.NewDecoder(strings.NewReader(input))
+	dec.Strict = false
+
+	var line *Line
+	var word *Word
+	var text strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("TTML inválido: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "tt":
+				if lang := attr(t, "lang"); lang != "" {
+					doc.Tags["la"] = lang
+				}
+			case "p":
+				line = &Line{}
+				text.Reset()
+				if begin, ok := ttmlTime(attr(t, "begin")); ok {
+					line.TimeMs = begin
+					doc.Synced = true
+				}
+				line.EndMs, _ = ttmlTime(attr(t, "end"))
+			case "span":
+				if line == nil {
+					continue
+				}
+				if begin, ok := ttmlTime(attr(t, "begin")); ok {
+					word = &Word{StartMs: begin}
+					word.EndMs, _ = ttmlTime(attr(t, "end"))
+				}
+			case "br":
+				if line != nil {
+					appendText(line, word, &text, " ")
+				}
+			}
+
+		case xml.CharData:
+			if line != nil {
+				appendText(line, word, &text, string(t))
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "span":
+				if word != nil && line != nil {
+					if strings.TrimSpace(word.Text) != "" {
+						line.Words = append(line.Words, *word)
+					}
+					word = nil
+				}
+			case "p":
+				if line == nil {
+					continue
+				}
+				if len(line.Words) > 0 {
+					text.Reset()
+					for _, w := range line.Words {
+						text.WriteString(w.Text)
+					}
+				}
+				line.Text = strings.Join(strings.Fields(text.String()), " ")
+				if line.Text != "" {
+					doc.Lines = append(doc.Lines, *line)
+				}
+				line = nil
+			}
+		}
+	}
+
+	if len(doc.Lines) == 0 {
+		return nil, ErrEmpty
+	}
+	doc.Finalize()
+	return doc, nil
+}
+
+// appendText manda el texto a la palabra abierta, o a la última palabra
+// (espacios entre <span>), o al texto de la línea si no hay palabras
+func appendText(line *Line, word *Word, text *strings.Builder, s string) {
+	switch {
+	case word != nil:
+		word.Text += s
+	case len(line.Words) > 0:
+		if strings.TrimSpace(s) == "" {
+			line.Words[len(line.Words)-1].Text += " "
+		} else {
+			line.Words[len(line.Words)-1].Text += s
+		}
+	default:
+		text.WriteString(s)
+	}
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+var errBadTime = errors.New("tiempo TTML inválido")
+
+// ttmlTime acepta "hh:mm:ss.fff", "mm:ss.fff", "ss.fff" y las formas con
+// unidad "12.5s", "1200ms", "1.5m", "0.01h"
+func ttmlTime(v string) (int, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	ms, err := parseTTMLTime(v)
+	if err != nil {
+		return 0, false
+	}
+	return ms, true
+}
+
+func parseTTMLTime(v string) (int, error) {
+	for _, unit := range []struct {
+		suffix string
+		factor float64
+	}{{"ms", 1}, {"h", 3600000}, {"m", 60000}, {"s", 1000}} {
+		if strings.HasSuffix(v, unit.suffix) {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(v, unit.suffix), 64)
+			if err != nil {
+				return 0, errBadTime
+			}
+			return int(f*unit.factor + 0.5), nil
+		}
+	}
+
+	parts := strings.Split(v, ":")
+	if len(parts) > 3 {
+		parts = parts[:3] // hh:mm:ss:frames -> ignoramos los frames
+	}
+	total := 0.0
+	for _, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, errBadTime
+		}
+		total = total*60 + f
+	}
+	return int(total*1000 + 0.5), nil
+}
@@ -2,24 +2,25 @@ package models
 
 import (
 	"database/sql/driver"
-	"encoding/json"
-	"errors"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // --- UTILIDADES PARA ARRAYS EN POSTGRES ---
+// StringArray mapea columnas TEXT[] (formato '{a,b}' de Postgres, no JSON)
 type StringArray []string
 
 func (a StringArray) Value() (driver.Value, error) {
-	return json.Marshal(a)
+	return pq.StringArray(a).Value()
 }
 
 func (a *StringArray) Scan(value interface{}) error {
-	b, ok := value.([]byte)
-	if !ok {
-		return errors.New("type assertion to []byte failed")
+	if value == nil {
+		*a = StringArray{}
+		return nil
 	}
-	return json.Unmarshal(b, a)
+	return (*pq.StringArray)(a).Scan(value)
 }
 
 // --- MODELOS DE BASE DE DATOS ---
@@ -49,10 +50,122 @@ type Track struct {
 	DurationMs  int         `json:"duration_ms"`
 	StreamURL   string      `json:"stream_url"`
 	CanvasURL   string      `json:"canvas_url"`
+	CoverURL    string      `json:"cover_url"`
 	HasLyrics   bool        `json:"has_lyrics"`
 	IsExplicit  bool        `json:"is_explicit"`
+	TrackNumber int         `json:"track_number,omitempty"`
+	DiscNumber  int         `json:"disc_number,omitempty"`
+	Qualities   StringArray `json:"available_qualities"` // "AAC_64", "AAC_320", "FLAC"...
+	PremiumOnly bool        `json:"premium_only"`
+	PreviewURL  string      `json:"preview_url,omitempty"`   // Fragmento de 30 s (HLS)
+	PlayMode    string      `json:"playback_mode,omitempty"` // "full", "preview" o "blocked" para quien pregunta
 	Producers   StringArray `json:"producers"` 
 	Writers     StringArray `json:"writers"`
+	Engineers   StringArray `json:"engineers"`
+	Credits     []Credit    `json:"credits,omitempty"` // Créditos tipados con enlace al contribuidor
+
+	// Resúmenes anidados (solo en detalle de canción)
+	Artist *ArtistSummary `json:"artist,omitempty"`
+	Album  *AlbumSummary  `json:"album,omitempty"`
+
+	// Todos los artistas en orden y el texto para mostrar ("A feat. B")
+	Artists       []ArtistCredit `json:"artists,omitempty"`
+	ArtistDisplay string         `json:"artist_display,omitempty"`
+
+	// Identificadores externos: {"isrc": "...", "deezer": "..."}
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+
+	// Normalización de volumen (nil hasta que se analiza)
+	Loudness *Loudness `json:"loudness,omitempty"`
+}
+
+// ArtistCredit es un artista con su papel en una canción o álbum
+type ArtistCredit struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ImageURL string `json:"image_url"`
+	Role     string `json:"role"` // "primary", "featured" o "remixer"
+}
+
+// ArtistSummary es la versión corta de un artista para anidar en otras respuestas
+type ArtistSummary struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ImageURL string `json:"image_url"`
+}
+
+// AlbumSummary es la versión corta de un álbum para anidar en otras respuestas
+type AlbumSummary struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	CoverURL    string     `json:"cover_url"`
+	ReleaseDate *time.Time `json:"release_date,omitempty"`
+	Label       string     `json:"label"`
+
+	Artists       []ArtistCredit `json:"artists,omitempty"`
+	ArtistDisplay string         `json:"artist_display,omitempty"`
+}
+
+// ArtistPage es la página de un artista: sus lanzamientos y sus apariciones en otros
+type ArtistPage struct {
+	Artist      Artist         `json:"artist"`
+	Albums      []AlbumSummary `json:"albums"`      // Donde es artista principal
+	Appearances []Appearance   `json:"appearances"` // Colaboraciones en lanzamientos de otros
+}
+
+// Appearance es una canción de otro artista en la que participa
+type Appearance struct {
+	Role          string       `json:"role"`
+	TrackID       string       `json:"track_id"`
+	TrackTitle    string       `json:"track_title"`
+	ArtistDisplay string       `json:"artist_display"`
+	Album         AlbumSummary `json:"album"`
+}
+
+// --- CRÉDITOS ---
+
+// Roles válidos para un crédito
+var CreditRoles = map[string]bool{
+	"producer":           true,
+	"writer":             true,
+	"composer":           true,
+	"mixing_engineer":    true,
+	"featured_performer": true,
+}
+
+// Contributor es una persona que trabajó en canciones (productor, compositor...)
+type Contributor struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	ArtistID *string `json:"artist_id"` // Si también es artista del catálogo
+}
+
+// Credit es un contribuidor con su rol en una canción concreta
+type Credit struct {
+	ContributorID string  `json:"contributor_id"`
+	Name          string  `json:"name"`
+	ArtistID      *string `json:"artist_id"`
+	Role          string  `json:"role"`
+}
+
+// CreditInput es un crédito enviado por un curador. Si no trae contributor_id,
+// se reutiliza el de la canción con ese nombre o el del artista vinculado, y si
+// no hay se crea uno nuevo (el nombre solo no identifica a una persona).
+type CreditInput struct {
+	ContributorID string `json:"contributor_id"`
+	Name          string `json:"name"`
+	ArtistID      string `json:"artist_id"`
+	Role          string `json:"role" binding:"required"`
+}
+
+// ContributorWork es una canción en la que participó un contribuidor
+type ContributorWork struct {
+	Role       string `json:"role"`
+	TrackID    string `json:"track_id"`
+	TrackTitle string `json:"track_title"`
+	ArtistName string `json:"artist_name"`
+	AlbumTitle string `json:"album_title"`
+	CoverURL   string `json:"cover_url"`
 }
 
 type LyricLine struct {
@@ -60,6 +173,94 @@ type LyricLine struct {
     Text   string `json:"text"`
 }
 
+// --- LETRAS v2 (sincronizadas por palabra) ---
+
+// LyricWord es una palabra o sílaba con su tiempo de inicio y fin
+type LyricWord struct {
+	StartMs int    `json:"start_ms"`
+	EndMs   *int   `json:"end_ms"`
+	Text    string `json:"text"`
+}
+
+// LyricLineV2 es una línea con su final y, si existen, sus palabras
+type LyricLineV2 struct {
+	TimeMs int         `json:"time_ms"`
+	EndMs  *int        `json:"end_ms"`
+	Text   string      `json:"text"`
+	Words  []LyricWord `json:"words"`
+}
+
+// LyricsV2 es la respuesta de GET /music/tracks/:id/lyrics?v=2
+type LyricsV2 struct {
+	Version    int           `json:"version"`
+	TrackID    string        `json:"track_id"`
+	Language   string        `json:"language"`
+	Synced     bool          `json:"synced"`      // Hay tiempos por línea
+	WordSynced bool          `json:"word_synced"` // Hay tiempos por palabra
+	Lines      []LyricLineV2 `json:"lines"`
+}
+
+// LyricsVariant describe una letra disponible para una canción
+type LyricsVariant struct {
+	Kind        string    `json:"kind"`     // "original", "translation" o "romanization"
+	Language    string    `json:"language"` // BCP 47: "es", "en", "ja-Latn"...
+	Synced      bool      `json:"synced"`
+	Lines       int       `json:"lines"`
+	Source      string    `json:"source"`      // "curator", "community", "lrclib"...
+	Contributor *UserRef  `json:"contributor"` // Quién aportó la versión publicada
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UserRef identifica a un usuario en respuestas públicas (sin email)
+type UserRef struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// LyricsRevision es una versión propuesta (o publicada) de la letra de una canción
+type LyricsRevision struct {
+	ID          string     `json:"id"`
+	TrackID     string     `json:"track_id"`
+	TrackTitle  string     `json:"track_title"`
+	Kind        string     `json:"kind"`
+	Language    string     `json:"language"`
+	Status      string     `json:"status"` // "pending", "approved" o "rejected"
+	Source      string     `json:"source"`
+	Note        string     `json:"note"`
+	Added       int        `json:"lines_added"`
+	Removed     int        `json:"lines_removed"`
+	Diff        string     `json:"diff,omitempty"`
+	Content     string     `json:"content,omitempty"`
+	SubmittedBy *UserRef   `json:"submitted_by"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	ReviewedBy  *UserRef   `json:"reviewed_by"`
+	ReviewedAt  *time.Time `json:"reviewed_at"`
+	ReviewNote  string     `json:"review_note"`
+	RollbackOf  *string    `json:"rollback_of"`
+	IsCurrent   bool       `json:"is_current"` // Es la versión publicada ahora mismo
+}
+
+// TextSpan marca un tramo de texto (posiciones en runas, fin exclusivo)
+type TextSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// LyricsMatch es una canción encontrada por un fragmento de su letra
+type LyricsMatch struct {
+	TrackID     string     `json:"track_id"`
+	Title       string     `json:"title"`
+	ArtistName  string     `json:"artist_name"`
+	CoverURL    string     `json:"cover_url"`
+	TimeMs      int        `json:"time_ms"`     // Para saltar directo a ese momento
+	Line        string     `json:"line"`        // Línea tal cual
+	Highlighted string     `json:"highlighted"` // Línea en HTML (escapada) con <em> en lo que coincide
+	Highlights  []TextSpan `json:"highlights"`
+	Language    string     `json:"language"`     // Idioma de la línea encontrada
+	ExactPhrase bool       `json:"exact_phrase"` // false = coincidencia aproximada
+	Score       float64    `json:"score"`
+}
+
 type Playlist struct {
     ID          string  `json:"id"`
     Name        string  `json:"name"`
@@ -77,4 +278,186 @@ type SyncTrackInput struct {
 	ArtistName string `json:"artist_name"`
 	ArtistImg  string `json:"artist_image"`
 	AlbumTitle string `json:"album_title"`
-}
\ No newline at end of file
+
+	// Posición en el álbum (0 = desconocida)
+	TrackNumber int `json:"track_number"`
+	DiscNumber  int `json:"disc_number"`
+
+	// Identificadores externos: si vienen, mandan sobre el título para reconocer duplicados
+	ISRC           string `json:"isrc"`
+	UPC            string `json:"upc"`
+	DeezerAlbumID  string `json:"deezer_album_id"`
+	DeezerArtistID string `json:"deezer_artist_id"`
+
+	// Colaboraciones: si no vienen, se intentan sacar de "A feat. B" en artist_name
+	FeaturedArtists []string `json:"featured_artists"`
+	Remixers        []string `json:"remixers"`
+}
+
+// SyncEntity es el resultado de sincronizar una entidad del catálogo
+type SyncEntity struct {
+	ID     string `json:"id"`
+	Status string `json:"status"` // "created", "updated" o "unchanged"
+}
+
+// SyncResult resume lo que hizo una sincronización
+type SyncResult struct {
+	Status  string       `json:"status"` // El de la canción
+	Track   SyncEntity   `json:"track"`
+	Album   SyncEntity   `json:"album"`
+	Artist  SyncEntity   `json:"artist"`
+	Artists []SyncEntity `json:"artists,omitempty"` // Invitados y remixers
+}
+
+// SyncBatchItem es un elemento de POST /music/sync/batch: una canción (por defecto),
+// un álbum o un artista, con los mismos campos que SyncTrackInput
+type SyncBatchItem struct {
+	Type string `json:"type"` // "track", "album" o "artist"
+	SyncTrackInput
+}
+
+// SyncBatchItemResult es el resultado de un elemento del batch, en el mismo orden
+type SyncBatchItemResult struct {
+	Index  int         `json:"index"`
+	Type   string      `json:"type"`
+	Status string      `json:"status"` // "created", "updated", "unchanged" o "error"
+	Error  string      `json:"error,omitempty"`
+	Result *SyncResult `json:"result,omitempty"`
+}
+
+// CatalogRecord es un registro de un volcado del catálogo (catalogctl import):
+// un artista, álbum o canción con los campos de SyncTrackInput, o una letra
+type CatalogRecord struct {
+	SyncBatchItem
+
+	// Solo para type "lyrics". La canción se busca por track_id, isrc, deezer_id
+	// o por title + artist_name + album_title
+	TrackID  string `json:"track_id"`
+	Kind     string `json:"kind"`     // "original" (por defecto), "translation" o "romanization"
+	Language string `json:"language"`
+	Format   string `json:"format"`   // "lrc", "text" o "ttml"
+	Lyrics   string `json:"lyrics"`
+}
+
+// LookupResult es la entidad del catálogo que corresponde a un identificador externo
+type LookupResult struct {
+	Type   string         `json:"type"` // "track", "album" o "artist"
+	ID     string         `json:"id"`
+	Track  *Track         `json:"track,omitempty"`
+	Album  *AlbumSummary  `json:"album,omitempty"`
+	Artist *ArtistSummary `json:"artist,omitempty"`
+}
+
+// --- BÚSQUEDA ---
+
+// SearchSuggestion es un resultado del autocompletado (artista, álbum o canción)
+type SearchSuggestion struct {
+	Type     string `json:"type"` // "artist", "album" o "track"
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"` // Nombre del artista para álbumes y canciones
+	ImageURL string `json:"image_url"`
+}
+
+// --- STREAMING ---
+
+// TranscodeJob es la conversión de un master a HLS
+type TranscodeJob struct {
+	ID         string      `json:"id"`
+	TrackID    string      `json:"track_id"`
+	Status     string      `json:"status"` // "queued", "running", "done" o "failed"
+	Error      string      `json:"error,omitempty"`
+	StreamURL  string      `json:"stream_url,omitempty"` // master.m3u8 generado (cuando termina)
+	Renditions []Rendition `json:"renditions,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// Rendition es una calidad de audio disponible de una canción
+type Rendition struct {
+	Quality          string `json:"quality"` // "AAC_64", "AAC_160", "AAC_320" o "FLAC"
+	Codecs           string `json:"codecs"`
+	Bandwidth        int    `json:"bandwidth"`
+	AverageBandwidth int    `json:"average_bandwidth"`
+}
+
+// Loudness son los datos de normalización de una canción. El reproductor aplica
+// track_gain_db (o album_gain_db en modo álbum) sin pasarse del true peak.
+type Loudness struct {
+	ReferenceLUFS  float64  `json:"reference_lufs"` // Nivel objetivo (-18, como ReplayGain 2.0)
+	IntegratedLUFS float64  `json:"integrated_lufs"`
+	TruePeakDBTP   float64  `json:"true_peak_dbtp"`
+	TrackGainDB    float64  `json:"track_gain_db"`
+	AlbumLUFS      *float64 `json:"album_lufs,omitempty"`
+	AlbumPeakDBTP  *float64 `json:"album_peak_dbtp,omitempty"`
+	AlbumGainDB    *float64 `json:"album_gain_db,omitempty"`
+}
+
+// AudioFeatures describe cómo suena una canción (calculado de su audio)
+type AudioFeatures struct {
+	TrackID       string    `json:"track_id"`
+	TempoBPM      float64   `json:"tempo_bpm"`
+	Key           string    `json:"key"`       // "C", "C#"... "B"
+	KeyIndex      int       `json:"key_index"` // 0 = C ... 11 = B
+	Mode          string    `json:"mode"`      // "major" o "minor"
+	KeyConfidence float64   `json:"key_confidence"`
+	Energy        float64   `json:"energy"`       // 0..1
+	Danceability  float64   `json:"danceability"` // 0..1
+	AnalyzedAt    time.Time `json:"analyzed_at"`
+}
+
+// DuplicateTrack es una canción dentro de un candidato a duplicado
+type DuplicateTrack struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	Artist     string `json:"artist"`
+	Album      string `json:"album"`
+	DurationMs int    `json:"duration_ms"`
+}
+
+// DuplicateCandidate es un par de canciones cuyas huellas acústicas coinciden
+type DuplicateCandidate struct {
+	Tracks        [2]DuplicateTrack `json:"tracks"`
+	Confidence    float64           `json:"confidence"`     // 0..1
+	OffsetSeconds float64           `json:"offset_seconds"` // Desfase del audio de la segunda respecto de la primera
+	SharedTerms   int               `json:"shared_terms"`   // Términos del índice en común
+}
+
+// TrackMergeResult resume qué se movió al fusionar una canción duplicada
+type TrackMergeResult struct {
+	TrackID        string `json:"track_id"`  // La que queda
+	MergedID       string `json:"merged_id"` // La que se eliminó (ahora redirige)
+	PlaylistsMoved int64  `json:"playlists_moved"`
+	LyricsMoved    int64  `json:"lyric_sets_moved"`
+	RevisionsMoved int64  `json:"lyric_revisions_moved"`
+	ExternalIDs    int64  `json:"external_ids_moved"`
+}
+
+// ArtistDuplicate es un artista dentro de un grupo de posibles duplicados
+type ArtistDuplicate struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Popularity int    `json:"popularity"`
+	Albums     int    `json:"albums"`
+	Tracks     int    `json:"tracks"`
+}
+
+// ArtistDuplicateGroup son los artistas con el mismo nombre normalizado; el
+// primero (más canciones, luego más popular) es el que conviene conservar
+type ArtistDuplicateGroup struct {
+	NameKey string            `json:"name_key"`
+	Artists []ArtistDuplicate `json:"artists"`
+}
+
+// ArtistMergeResult resume qué se movió al fusionar un artista duplicado
+type ArtistMergeResult struct {
+	ArtistID       string   `json:"artist_id"` // El que queda
+	MergedID       string   `json:"merged_id"` // El que se eliminó (ahora redirige)
+	AlbumsMoved    int64    `json:"albums_moved"`
+	AlbumsFolded   []string `json:"albums_folded"` // Álbumes repetidos fundidos en el del que queda
+	TracksMoved    int64    `json:"tracks_moved"`
+	TracksMerged   []string `json:"tracks_merged"` // Canciones repetidas dentro de esos álbumes
+	FavoritesMoved int64    `json:"favorites_moved"`
+	ExternalIDs    int64    `json:"external_ids_moved"`
+}
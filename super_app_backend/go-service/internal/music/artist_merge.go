@@ -0,0 +1,289 @@
+package music
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/auth"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+// MergeArtist fusiona un artista duplicado en el que queda (solo admins)
+// POST /music/artists/:id/merge {"duplicate_id": "..."}
+func MergeArtist(c *gin.Context) {
+	var input struct {
+		DuplicateID string `json:"duplicate_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	if !validID(c, c.Param("id")) || !validID(c, input.DuplicateID) {
+		return
+	}
+
+	result, err := mergeArtists(c.Param("id"), input.DuplicateID, auth.CurrentUserID(c))
+	switch {
+	case errors.Is(err, errMergeSame):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se puede fusionar un artista consigo mismo"})
+		return
+	case errors.Is(err, errMergeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artista no encontrado"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fusionando los artistas"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// mergePair es un álbum (o canción) del duplicado y su homónimo en el que queda
+type mergePair struct{ dup, keep string }
+
+// mergeArtists pasa a keepID los álbumes, canciones, favoritos e IDs externos
+// de dupID y lo borra dejando una redirección. Un álbum del duplicado con el
+// mismo título que uno del que queda se funde en él (y sus canciones
+// repetidas, con mergeTrackTx).
+func mergeArtists(keepID, dupID, mergedBy string) (models.ArtistMergeResult, error) {
+	result := models.ArtistMergeResult{ArtistID: keepID, MergedID: dupID, AlbumsFolded: []string{}, TracksMerged: []string{}}
+	if keepID == dupID {
+		return result, errMergeSame
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var locked int
+	err = tx.QueryRow("SELECT COUNT(*) FROM (SELECT id FROM artists WHERE id IN ($1::uuid, $2::uuid) ORDER BY id FOR UPDATE) a",
+		keepID, dupID).Scan(&locked)
+	if err != nil {
+		return result, err
+	}
+	if locked != 2 {
+		return result, errMergeNotFound
+	}
+
+	albums, err := queryPairs(tx, `
+		SELECT d.id, k.id FROM albums d
+		JOIN albums k ON k.artist_id = $1 AND k.title = d.title
+		WHERE d.artist_id = $2`, keepID, dupID)
+	if err != nil {
+		return result, err
+	}
+	for _, al := range albums {
+		merged, err := foldAlbum(tx, al, keepID, dupID, mergedBy)
+		if err != nil {
+			return result, err
+		}
+		result.AlbumsFolded = append(result.AlbumsFolded, al.dup)
+		result.TracksMerged = append(result.TracksMerged, merged...)
+	}
+
+	if result.AlbumsMoved, err = rowsAffected(tx.Exec("UPDATE albums SET artist_id = $1 WHERE artist_id = $2", keepID, dupID)); err != nil {
+		return result, err
+	}
+	if result.TracksMoved, err = rowsAffected(tx.Exec("UPDATE tracks SET artist_id = $1 WHERE artist_id = $2", keepID, dupID)); err != nil {
+		return result, err
+	}
+	// Créditos múltiples: si ya figuraba el que queda con ese rol, sobra la fila
+	for table, column := range map[string]string{"track_artists": "track_id", "album_artists": "album_id"} {
+		_, err = tx.Exec(`
+			UPDATE `+table+` x SET artist_id = $1
+			WHERE artist_id = $2 AND NOT EXISTS (
+				SELECT 1 FROM `+table+` y WHERE y.artist_id = $1 AND y.role = x.role AND y.`+column+` = x.`+column+`)`,
+			keepID, dupID)
+		if err != nil {
+			return result, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE contributors SET artist_id = $1 WHERE artist_id = $2", keepID, dupID); err != nil {
+		return result, err
+	}
+
+	result.FavoritesMoved, err = rowsAffected(tx.Exec(`
+		UPDATE user_favorite_artists SET artist_id = $1
+		WHERE artist_id = $2
+		  AND user_id NOT IN (SELECT user_id FROM user_favorite_artists WHERE artist_id = $1)`, keepID, dupID))
+	if err != nil {
+		return result, err
+	}
+	if _, err := tx.Exec("DELETE FROM user_favorite_artists WHERE artist_id = $1", dupID); err != nil {
+		return result, err
+	}
+
+	result.ExternalIDs, err = rowsAffected(tx.Exec(
+		"UPDATE external_ids SET entity_id = $1 WHERE entity_type = 'artist' AND entity_id = $2", keepID, dupID))
+	if err != nil {
+		return result, err
+	}
+
+	// Lo que le falte al que queda (bio, imagen) se toma del duplicado
+	_, err = tx.Exec(`
+		UPDATE artists k SET
+			bio = COALESCE(NULLIF(k.bio, ''), d.bio),
+			image_url = COALESCE(NULLIF(k.image_url, ''), d.image_url),
+			popularity = GREATEST(k.popularity, d.popularity)
+		FROM artists d WHERE k.id = $1 AND d.id = $2`, keepID, dupID)
+	if err != nil {
+		return result, err
+	}
+
+	if _, err := tx.Exec("UPDATE artist_redirects SET artist_id = $1 WHERE artist_id = $2", keepID, dupID); err != nil {
+		return result, err
+	}
+	_, err = tx.Exec("INSERT INTO artist_redirects (old_id, artist_id, merged_by) VALUES ($2, $1, NULLIF($3, '')::uuid)",
+		keepID, dupID, mergedBy)
+	if err != nil {
+		return result, err
+	}
+	if _, err := tx.Exec("DELETE FROM artists WHERE id = $1", dupID); err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+
+	searchIndex.Remove("artist", dupID)
+	for _, id := range result.AlbumsFolded {
+		searchIndex.Remove("album", id)
+	}
+	for _, id := range result.TracksMerged {
+		cleanupMergedTrack(id)
+	}
+	return result, nil
+}
+
+// foldAlbum funde un álbum del duplicado en su homónimo y devuelve las
+// canciones repetidas que se fusionaron
+func foldAlbum(tx *sql.Tx, al mergePair, keepArtist, dupArtist, mergedBy string) ([]string, error) {
+	tracks, err := queryPairs(tx, `
+		SELECT d.id, k.id FROM tracks d
+		JOIN tracks k ON k.album_id = $1 AND k.title = d.title
+		WHERE d.album_id = $2`, al.keep, al.dup)
+	if err != nil {
+		return nil, err
+	}
+	var merged []string
+	for _, t := range tracks {
+		if _, err := mergeTrackTx(tx, t.keep, t.dup, mergedBy); err != nil {
+			return nil, err
+		}
+		merged = append(merged, t.dup)
+	}
+
+	if _, err := tx.Exec("UPDATE tracks SET album_id = $1 WHERE album_id = $2", al.keep, al.dup); err != nil {
+		return nil, err
+	}
+	// Los demás artistas del álbum (invitados) se conservan
+	_, err = tx.Exec(`
+		INSERT INTO album_artists (album_id, artist_id, role, position)
+		SELECT $1, CASE WHEN artist_id = $4 THEN $3::uuid ELSE artist_id END, role, position
+		FROM album_artists WHERE album_id = $2
+		ON CONFLICT DO NOTHING`, al.keep, al.dup, keepArtist, dupArtist)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE external_ids SET entity_id = $1 WHERE entity_type = 'album' AND entity_id = $2", al.keep, al.dup); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		UPDATE albums k SET
+			cover_url = COALESCE(NULLIF(k.cover_url, ''), d.cover_url),
+			release_date = COALESCE(k.release_date, d.release_date),
+			label = COALESCE(NULLIF(k.label, ''), d.label)
+		FROM albums d WHERE k.id = $1 AND d.id = $2`, al.keep, al.dup)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("DELETE FROM albums WHERE id = $1", al.dup)
+	return merged, err
+}
+
+// queryPairs lee pares (duplicado, el que queda) antes de modificar nada:
+// lib/pq no permite otra consulta en la transacción con filas abiertas
+func queryPairs(tx *sql.Tx, query string, args ...interface{}) ([]mergePair, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []mergePair
+	for rows.Next() {
+		var p mergePair
+		if err := rows.Scan(&p.dup, &p.keep); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
+
+// BackfillArtistKeys calcula name_key de los artistas que no la tienen (los
+// creados antes de la deduplicación) y devuelve cuántos actualizó
+func BackfillArtistKeys() (int, error) {
+	rows, err := db.DB.Query("SELECT id, name FROM artists WHERE name_key IS NULL")
+	if err != nil {
+		return 0, err
+	}
+	keys := map[string]string{}
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys[id] = utils.NameKey(name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, key := range keys {
+		if _, err := db.DB.Exec("UPDATE artists SET name_key = $2 WHERE id = $1", id, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// FindArtistDuplicates agrupa los artistas que comparten nombre normalizado
+func FindArtistDuplicates() ([]models.ArtistDuplicateGroup, error) {
+	rows, err := db.DB.Query(`
+		SELECT a.name_key, a.id, a.name, COALESCE(a.popularity, 0),
+		       (SELECT COUNT(*) FROM albums WHERE artist_id = a.id),
+		       (SELECT COUNT(*) FROM tracks WHERE artist_id = a.id) AS tracks
+		FROM artists a
+		WHERE a.name_key IN (
+			SELECT name_key FROM artists WHERE name_key IS NOT NULL
+			GROUP BY name_key HAVING COUNT(*) > 1)
+		ORDER BY a.name_key, tracks DESC, a.popularity DESC NULLS LAST, a.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.ArtistDuplicateGroup{}
+	for rows.Next() {
+		var key string
+		var a models.ArtistDuplicate
+		if err := rows.Scan(&key, &a.ID, &a.Name, &a.Popularity, &a.Albums, &a.Tracks); err != nil {
+			return nil, err
+		}
+		if len(groups) == 0 || groups[len(groups)-1].NameKey != key {
+			groups = append(groups, models.ArtistDuplicateGroup{NameKey: key})
+		}
+		g := &groups[len(groups)-1]
+		g.Artists = append(g.Artists, a)
+	}
+	return groups, rows.Err()
+}
@@ -0,0 +1,207 @@
+package music
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/lib/pq"
+)
+
+// loadArtistCredits trae los artistas de varias canciones (track_artists) o
+// álbumes (album_artists), en su orden de aparición
+func loadArtistCredits(table, key string, ids []string) (map[string][]models.ArtistCredit, error) {
+	rows, err := db.DB.Query(`
+		SELECT x.`+key+`, a.id, a.name, COALESCE(a.image_url, ''), x.role
+		FROM `+table+` x
+		JOIN artists a ON a.id = x.artist_id
+		WHERE x.`+key+` = ANY($1::uuid[])
+		ORDER BY x.`+key+`, x.position, (x.role = 'primary') DESC`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := map[string][]models.ArtistCredit{}
+	for rows.Next() {
+		var id string
+		var a models.ArtistCredit
+		if err := rows.Scan(&id, &a.ID, &a.Name, &a.ImageURL, &a.Role); err != nil {
+			continue
+		}
+		credits[id] = append(credits[id], a)
+	}
+	return credits, nil
+}
+
+func loadTrackArtists(trackIDs []string) (map[string][]models.ArtistCredit, error) {
+	return loadArtistCredits("track_artists", "track_id", trackIDs)
+}
+
+func loadAlbumArtists(albumIDs []string) (map[string][]models.ArtistCredit, error) {
+	return loadArtistCredits("album_artists", "album_id", albumIDs)
+}
+
+// artistDisplay arma el texto que ve el usuario: "A", "A & B", "A, B & C feat. D"
+func artistDisplay(credits []models.ArtistCredit) string {
+	var primary, featured []string
+	for _, a := range credits {
+		switch a.Role {
+		case "primary":
+			primary = append(primary, a.Name)
+		case "featured":
+			featured = append(featured, a.Name)
+		}
+	}
+
+	display := joinNames(primary)
+	if len(featured) > 0 {
+		display += " feat. " + joinNames(featured)
+	}
+	return strings.TrimSpace(display)
+}
+
+func joinNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " & " + names[len(names)-1]
+}
+
+// enrichTracks completa créditos y artistas de las canciones ya escaneadas
+func enrichTracks(tracks []*models.Track) {
+	var trackIDs, albumIDs []string
+	for _, t := range tracks {
+		trackIDs = append(trackIDs, t.ID)
+		if t.Album != nil {
+			albumIDs = append(albumIDs, t.Album.ID)
+		}
+	}
+
+	credits, _ := loadTrackCredits(trackIDs)
+	artists, _ := loadTrackArtists(trackIDs)
+	albumArtists, _ := loadAlbumArtists(albumIDs)
+	externalIDs, _ := loadExternalIDs("track", trackIDs)
+
+	for _, t := range tracks {
+		t.ExternalIDs = externalIDs[t.ID]
+		t.Credits = credits[t.ID]
+		t.Artists = artists[t.ID]
+		t.ArtistDisplay = artistDisplay(t.Artists)
+		if t.ArtistDisplay == "" && t.Artist != nil {
+			t.ArtistDisplay = t.Artist.Name
+		}
+		if t.Album != nil {
+			t.Album.Artists = albumArtists[t.Album.ID]
+			t.Album.ArtistDisplay = artistDisplay(t.Album.Artists)
+		}
+	}
+}
+
+// GetArtist devuelve la página de un artista: sus álbumes y sus colaboraciones.
+// Un ID de artista fusionado devuelve el que quedó.
+// GET /music/artists/:id
+func GetArtist(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	var page models.ArtistPage
+	a := &page.Artist
+	err := db.DB.QueryRow(`
+		SELECT id, name, COALESCE(bio, ''), COALESCE(image_url, ''), COALESCE(popularity, 0)
+		FROM artists
+		WHERE id = $1::uuid OR id = (SELECT artist_id FROM artist_redirects WHERE old_id = $1::uuid)`, c.Param("id")).
+		Scan(&a.ID, &a.Name, &a.Bio, &a.ImageURL, &a.Popularity)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artista no encontrado"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando artista"})
+		return
+	}
+
+	// 1. Lanzamientos propios
+	rows, err := db.DB.Query(`
+		SELECT al.id, al.title, COALESCE(al.cover_url, ''), al.release_date, COALESCE(al.label, '')
+		FROM album_artists aa
+		JOIN albums al ON al.id = aa.album_id
+		WHERE aa.artist_id = $1 AND aa.role = 'primary'
+		ORDER BY al.release_date DESC NULLS LAST, al.title`, a.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando álbumes"})
+		return
+	}
+	page.Albums = []models.AlbumSummary{}
+	var albumIDs []string
+	for rows.Next() {
+		al, err := scanAlbumSummary(rows)
+		if err != nil {
+			continue
+		}
+		page.Albums = append(page.Albums, al)
+		albumIDs = append(albumIDs, al.ID)
+	}
+	rows.Close()
+
+	// 2. Apariciones: canciones suyas en álbumes donde no es el artista principal
+	rows, err = db.DB.Query(`
+		SELECT ta.role, t.id, t.title, al.id, al.title, COALESCE(al.cover_url, ''), al.release_date, COALESCE(al.label, '')
+		FROM track_artists ta
+		JOIN tracks t ON t.id = ta.track_id
+		JOIN albums al ON al.id = t.album_id
+		WHERE ta.artist_id = $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM album_artists aa
+			WHERE aa.album_id = t.album_id AND aa.artist_id = $1 AND aa.role = 'primary')
+		ORDER BY al.release_date DESC NULLS LAST, t.title`, a.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando apariciones"})
+		return
+	}
+	page.Appearances = []models.Appearance{}
+	var trackIDs []string
+	for rows.Next() {
+		var ap models.Appearance
+		var releaseDate sql.NullTime
+		if err := rows.Scan(&ap.Role, &ap.TrackID, &ap.TrackTitle,
+			&ap.Album.ID, &ap.Album.Title, &ap.Album.CoverURL, &releaseDate, &ap.Album.Label); err != nil {
+			continue
+		}
+		if releaseDate.Valid {
+			ap.Album.ReleaseDate = &releaseDate.Time
+		}
+		page.Appearances = append(page.Appearances, ap)
+		trackIDs = append(trackIDs, ap.TrackID)
+	}
+	rows.Close()
+
+	albumArtists, _ := loadAlbumArtists(albumIDs)
+	for i := range page.Albums {
+		page.Albums[i].Artists = albumArtists[page.Albums[i].ID]
+		page.Albums[i].ArtistDisplay = artistDisplay(page.Albums[i].Artists)
+	}
+	trackArtists, _ := loadTrackArtists(trackIDs)
+	for i := range page.Appearances {
+		page.Appearances[i].ArtistDisplay = artistDisplay(trackArtists[page.Appearances[i].TrackID])
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func scanAlbumSummary(row rowScanner) (models.AlbumSummary, error) {
+	var al models.AlbumSummary
+	var releaseDate sql.NullTime
+	if err := row.Scan(&al.ID, &al.Title, &al.CoverURL, &releaseDate, &al.Label); err != nil {
+		return al, err
+	}
+	if releaseDate.Valid {
+		al.ReleaseDate = &releaseDate.Time
+	}
+	return al, nil
+}
@@ -0,0 +1,245 @@
+package music
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+// Registros por transacción en una importación real; en simulación todo va en una
+// sola transacción que se descarta al final
+const importCommitEvery = 500
+
+// CatalogImporter aplica registros de un volcado con la misma lógica que SyncTrack.
+// Cada registro corre en un SAVEPOINT: si falla se descarta solo ese registro.
+type CatalogImporter struct {
+	DryRun bool
+	// Stats cuenta por entidad ("artist", "album", "track", "lyrics") y estado
+	Stats map[string]map[string]int
+
+	s       *catalogSync
+	pending int
+}
+
+// NewCatalogImporter abre la primera transacción
+func NewCatalogImporter(dryRun bool) (*CatalogImporter, error) {
+	im := &CatalogImporter{DryRun: dryRun, Stats: map[string]map[string]int{}}
+	return im, im.begin()
+}
+
+func (im *CatalogImporter) begin() error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	im.s = &catalogSync{tx: tx}
+	im.pending = 0
+	return nil
+}
+
+// Import valida y aplica un registro
+func (im *CatalogImporter) Import(rec models.CatalogRecord) (models.SyncResult, error) {
+	if rec.Type == "" {
+		rec.Type = "track"
+	}
+	if msg := validateCatalogRecord(rec); msg != "" {
+		return models.SyncResult{}, fmt.Errorf("%w: %s", errInvalidSync, msg)
+	}
+
+	s := im.s
+	suggestions, newTracks := len(s.suggestions), len(s.newTracks)
+	if _, err := s.tx.Exec("SAVEPOINT catalog_record"); err != nil {
+		return models.SyncResult{}, err
+	}
+
+	result, err := im.apply(rec)
+	if err != nil {
+		// Deshacemos solo este registro (y lo que iba a publicar tras el commit)
+		s.suggestions, s.newTracks = s.suggestions[:suggestions], s.newTracks[:newTracks]
+		if _, rbErr := s.tx.Exec("ROLLBACK TO SAVEPOINT catalog_record"); rbErr != nil {
+			return result, rbErr
+		}
+		return result, err
+	}
+	if _, err := s.tx.Exec("RELEASE SAVEPOINT catalog_record"); err != nil {
+		return result, err
+	}
+
+	im.count(rec.Type, result)
+	im.pending++
+	if !im.DryRun && im.pending >= importCommitEvery {
+		if err := im.commit(); err != nil {
+			return result, err
+		}
+		return result, im.begin()
+	}
+	return result, nil
+}
+
+func (im *CatalogImporter) apply(rec models.CatalogRecord) (models.SyncResult, error) {
+	s := im.s
+	input := rec.SyncTrackInput
+	var result models.SyncResult
+	var err error
+
+	switch rec.Type {
+	case "artist":
+		result.Artist, err = s.upsertArtist(input.ArtistName, input.ArtistImg, input.DeezerArtistID)
+		result.Status = result.Artist.Status
+	case "album":
+		input.ArtistName, _ = splitFeaturing(input.ArtistName)
+		if result.Artist, err = s.upsertArtist(input.ArtistName, input.ArtistImg, input.DeezerArtistID); err == nil {
+			result.Album, err = s.upsertAlbum(input, result.Artist.ID)
+			result.Status = result.Album.Status
+		}
+	case "track":
+		result, err = s.syncTrack(input)
+	case "lyrics":
+		result, err = s.importLyrics(rec)
+	}
+	return result, err
+}
+
+// count suma al resumen todas las entidades que tocó el registro
+func (im *CatalogImporter) count(recordType string, r models.SyncResult) {
+	add := func(entity, status string) {
+		if status == "" {
+			return
+		}
+		if im.Stats[entity] == nil {
+			im.Stats[entity] = map[string]int{}
+		}
+		im.Stats[entity][status]++
+	}
+
+	if recordType == "lyrics" {
+		add("lyrics", r.Status)
+		return
+	}
+	add("artist", r.Artist.Status)
+	for _, a := range r.Artists {
+		add("artist", a.Status)
+	}
+	add("album", r.Album.Status)
+	add("track", r.Track.Status)
+}
+
+func (im *CatalogImporter) commit() error {
+	if err := im.s.tx.Commit(); err != nil {
+		return err
+	}
+	im.s.afterCommit()
+	return nil
+}
+
+// Close confirma lo pendiente, o lo descarta todo si es una simulación
+func (im *CatalogImporter) Close() error {
+	if im.DryRun {
+		return im.s.tx.Rollback()
+	}
+	return im.commit()
+}
+
+// validateCatalogRecord revisa los campos obligatorios según el tipo de registro
+func validateCatalogRecord(rec models.CatalogRecord) string {
+	if rec.Type != "lyrics" {
+		return validateBatchItem(rec.SyncBatchItem)
+	}
+
+	kind := rec.Kind
+	if kind == "" {
+		kind = "original"
+	}
+	switch {
+	case strings.TrimSpace(rec.Lyrics) == "":
+		return "lyrics es obligatorio"
+	case !lyricKinds[kind]:
+		return "kind inválido: " + kind
+	case kind != "original" && rec.Language == "":
+		return "las traducciones y romanizaciones necesitan language"
+	case rec.TrackID == "" && rec.ISRC == "" && rec.DeezerID == "" && (rec.Title == "" || rec.ArtistName == ""):
+		return "indica track_id, isrc, deezer_id o title + artist_name"
+	}
+	return ""
+}
+
+// importLyrics publica la letra como revisión aprobada. Si es idéntica a la
+// publicada no hace nada, así reimportar un volcado no llena el historial.
+func (s *catalogSync) importLyrics(rec models.CatalogRecord) (models.SyncResult, error) {
+	var result models.SyncResult
+
+	trackID, err := s.resolveTrack(rec)
+	if err == sql.ErrNoRows {
+		return result, errors.New("canción no encontrada en el catálogo")
+	} else if err != nil {
+		return result, err
+	}
+	result.Track = models.SyncEntity{ID: trackID, Status: "unchanged"}
+
+	doc, err := parseLyricsInput(rec.Lyrics, rec.Format)
+	if err != nil {
+		return result, fmt.Errorf("%w: letra inválida: %v", errInvalidSync, err)
+	}
+	kind, lang := rec.Kind, rec.Language
+	if kind == "" {
+		kind = "original"
+	}
+	if kind == "original" && lang == "" {
+		lang = doc.Tags["la"]
+	}
+
+	// Dentro de la transacción del import, para ver las letras de registros anteriores
+	current := currentCanonical(s.tx, trackID, kind, lang)
+	r := newRevision(s.tx, trackID, kind, lang, doc)
+	switch {
+	case current == r.Content:
+		result.Status = "unchanged"
+		return result, nil
+	case current == "":
+		result.Status = "created"
+	default:
+		result.Status = "updated"
+	}
+
+	r.Status = "approved"
+	r.Source = "manual"
+	revisionID, err := insertRevision(s.tx, r)
+	if err != nil {
+		return result, err
+	}
+	return result, publishLyrics(s.tx, r, revisionID, "", doc)
+}
+
+// resolveTrack encuentra la canción a la que pertenece una letra del volcado
+func (s *catalogSync) resolveTrack(rec models.CatalogRecord) (string, error) {
+	if rec.TrackID != "" {
+		if !utils.IsUUID(rec.TrackID) {
+			return "", fmt.Errorf("%w: track_id inválido", errInvalidSync)
+		}
+		var id string
+		err := s.tx.QueryRow("SELECT id FROM tracks WHERE id = $1::uuid", rec.TrackID).Scan(&id)
+		return id, err
+	}
+
+	id, err := findByExternalID(s.tx, "track", "isrc", rec.ISRC)
+	if err == sql.ErrNoRows {
+		id, err = findByExternalID(s.tx, "track", "deezer", rec.DeezerID)
+	}
+	if err != sql.ErrNoRows || rec.Title == "" {
+		return id, err
+	}
+
+	artist, _ := splitFeaturing(rec.ArtistName)
+	err = s.tx.QueryRow(`
+		SELECT t.id FROM tracks t
+		JOIN artists ar ON ar.id = t.artist_id
+		LEFT JOIN albums al ON al.id = t.album_id
+		WHERE t.title = $1 AND ar.name = $2 AND ($3 = '' OR al.title = $3)
+		LIMIT 1`, rec.Title, artist, rec.AlbumTitle).Scan(&id)
+	return id, err
+}
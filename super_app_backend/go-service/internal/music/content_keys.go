@@ -0,0 +1,129 @@
+package music
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/urlsign"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+// GetContentKey entrega la clave AES-128 de una rendition. La URL llega firmada
+// dentro de la media playlist (usuario, canción, rendition, expiración, IP);
+// además el reproductor tiene que mandar el Access Token del mismo usuario y su
+// plan dar acceso completo a la canción en la calidad que cifra la clave.
+// Cada intento queda en content_key_access.
+func GetContentKey(c *gin.Context) {
+	keyID := c.Param("id")
+	if !validID(c, keyID) {
+		return
+	}
+
+	var trackID string
+	var key []byte
+	err := db.DB.QueryRow("SELECT track_id, key_bytes FROM content_keys WHERE id = $1::uuid", keyID).Scan(&trackID, &key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Clave no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando la clave"})
+		return
+	}
+
+	var cl urlsign.Claims
+	if streamKeys == nil {
+		err = urlsign.ErrUnknown
+	} else {
+		cl, err = streamKeys.Verify(trackID, c.Request.URL.Query(), c.ClientIP(), time.Now())
+	}
+	if err != nil {
+		reason := "invalid_signature"
+		if errors.Is(err, urlsign.ErrExpired) {
+			reason = "expired"
+		} else if errors.Is(err, urlsign.ErrIP) {
+			reason = "ip_mismatch"
+		}
+		denyContentKey(c, keyID, "", reason, "Enlace inválido o expirado: "+err.Error())
+		return
+	}
+	if cl.UserID == "" {
+		denyContentKey(c, keyID, "", "anonymous", "Inicia sesión para escuchar esta canción")
+		return
+	}
+
+	// Una URL firmada filtrada no basta: hace falta la sesión del mismo usuario
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		denyContentKey(c, keyID, cl.UserID, "no_session", "Inicia sesión para escuchar esta canción")
+		return
+	}
+	claims, err := utils.ValidateToken(strings.TrimPrefix(header, "Bearer "))
+	if err != nil || claims["type"] != "access" || claims["user_id"] != cl.UserID {
+		denyContentKey(c, keyID, cl.UserID, "session_mismatch", "La sesión no corresponde al enlace")
+		return
+	}
+
+	var plan string
+	if err := db.DB.QueryRow("SELECT plan FROM users WHERE id = $1::uuid", cl.UserID).Scan(&plan); err != nil {
+		denyContentKey(c, keyID, "", "unknown_user", "Usuario no encontrado")
+		return
+	}
+
+	entitled, err := keyEntitled(keyID, plan, cl.Rendition)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando la clave"})
+		return
+	}
+	if !entitled {
+		denyContentKey(c, keyID, cl.UserID, "no_plan", "Tu plan no incluye esta canción")
+		return
+	}
+
+	logKeyAccess(keyID, cl.UserID, c.ClientIP(), true, "")
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "application/octet-stream", key)
+}
+
+// keyEntitled dice si el plan da acceso completo a la canción y a la rendition
+// cifrada con la clave, que además tiene que ser la de la firma
+func keyEntitled(keyID, plan, rendition string) (bool, error) {
+	rows, err := db.DB.Query(`
+		SELECT r.quality, t.premium_only
+		FROM track_renditions r JOIN tracks t ON t.id = r.track_id
+		WHERE r.key_id = $1::uuid`, keyID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var quality string
+		var premiumOnly bool
+		if err := rows.Scan(&quality, &premiumOnly); err != nil {
+			return false, err
+		}
+		if quality == rendition && playbackMode(plan, premiumOnly, false) == "full" && planQualities[plan][quality] {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func denyContentKey(c *gin.Context, keyID, userID, reason, message string) {
+	logKeyAccess(keyID, userID, c.ClientIP(), false, reason)
+	c.JSON(http.StatusForbidden, gin.H{"error": message})
+}
+
+func logKeyAccess(keyID, userID, ip string, granted bool, reason string) {
+	_, err := db.DB.Exec(`
+		INSERT INTO content_key_access (key_id, user_id, ip, granted, reason)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, NULLIF($5, ''))`, keyID, userID, ip, granted, reason)
+	if err != nil {
+		log.Printf("⚠️  No se pudo registrar el acceso a la clave %s: %v\n", keyID, err)
+	}
+}
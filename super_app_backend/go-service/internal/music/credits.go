@@ -0,0 +1,357 @@
+package music
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+	"github.com/lib/pq"
+)
+
+// loadTrackCredits trae los créditos tipados de varias canciones (track_id -> créditos)
+func loadTrackCredits(trackIDs []string) (map[string][]models.Credit, error) {
+	rows, err := db.DB.Query(`
+		SELECT tc.track_id, c.id, c.name, c.artist_id, tc.role
+		FROM track_contributors tc
+		JOIN contributors c ON c.id = tc.contributor_id
+		WHERE tc.track_id = ANY($1::uuid[])
+		ORDER BY tc.track_id, tc.position, c.name`, pq.Array(trackIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := map[string][]models.Credit{}
+	for rows.Next() {
+		var trackID string
+		var cr models.Credit
+		if err := rows.Scan(&trackID, &cr.ContributorID, &cr.Name, &cr.ArtistID, &cr.Role); err != nil {
+			continue
+		}
+		credits[trackID] = append(credits[trackID], cr)
+	}
+	return credits, nil
+}
+
+// UpdateTrackCredits reemplaza los créditos de una canción (solo curadores)
+// PUT /music/tracks/:id/credits
+func UpdateTrackCredits(c *gin.Context) {
+	trackID := c.Param("id")
+	if !validID(c, trackID) {
+		return
+	}
+	var input struct {
+		Credits []models.CreditInput `json:"credits" binding:"dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	for _, cr := range input.Credits {
+		if !models.CreditRoles[cr.Role] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Rol inválido: " + cr.Role})
+			return
+		}
+		if cr.ContributorID == "" && strings.TrimSpace(cr.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cada crédito necesita contributor_id o name"})
+			return
+		}
+		if (cr.ContributorID != "" && !utils.IsUUID(cr.ContributorID)) || (cr.ArtistID != "" && !utils.IsUUID(cr.ArtistID)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "contributor_id y artist_id deben ser UUID"})
+			return
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error del servidor"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM tracks WHERE id = $1::uuid)", trackID).Scan(&exists); err != nil {
+		log.Printf("⚠️  Créditos de %s: %v\n", trackID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando créditos"})
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
+		return
+	}
+
+	// Un artist_id desconocido es un error del curador, no del servidor
+	missing, err := missingArtists(tx, input.Credits)
+	if err != nil {
+		log.Printf("⚠️  Créditos de %s: %v\n", trackID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando créditos"})
+		return
+	} else if missing != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Artista no encontrado: " + missing})
+		return
+	}
+
+	// Un nombre sin contributor_id se resuelve primero contra los créditos que
+	// ya tenía la canción (guardar dos veces no duplica personas)
+	current, err := trackContributorsByName(tx, trackID)
+	if err != nil {
+		log.Printf("⚠️  Créditos de %s: %v\n", trackID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando créditos"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM track_contributors WHERE track_id = $1", trackID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando créditos"})
+		return
+	}
+
+	// Columnas legacy de track_credits (se mantienen para consultas rápidas),
+	// cada nombre una sola vez aunque tenga varios roles de la misma columna
+	legacy := map[string][]string{"producers": {}, "writers": {}, "engineers": {}}
+	seen := map[string]bool{}
+
+	for i, cr := range input.Credits {
+		contributorID := cr.ContributorID
+		var name string
+
+		if contributorID != "" {
+			err = tx.QueryRow("SELECT name FROM contributors WHERE id = $1::uuid", contributorID).Scan(&name)
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Contribuidor no encontrado: " + contributorID})
+				return
+			}
+		} else {
+			name = strings.TrimSpace(cr.Name)
+			contributorID, name, err = resolveContributor(tx, name, cr.ArtistID, current)
+		}
+		if err != nil {
+			log.Printf("⚠️  Contribuidor %q de %s: %v\n", cr.Name, trackID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando contribuidor"})
+			return
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO track_contributors (track_id, contributor_id, role, position)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING`, trackID, contributorID, cr.Role, i)
+		if err != nil {
+			log.Printf("⚠️  Crédito de %s: %v\n", trackID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando crédito"})
+			return
+		}
+
+		column := ""
+		switch cr.Role {
+		case "producer":
+			column = "producers"
+		case "writer", "composer":
+			column = "writers"
+		case "mixing_engineer":
+			column = "engineers"
+		}
+		if key := column + "\x00" + strings.ToLower(name); column != "" && !seen[key] {
+			seen[key] = true
+			legacy[column] = append(legacy[column], name)
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO track_credits (track_id, producers, writers, engineers) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (track_id) DO UPDATE
+		SET producers = EXCLUDED.producers, writers = EXCLUDED.writers, engineers = EXCLUDED.engineers`,
+		trackID, pq.Array(legacy["producers"]), pq.Array(legacy["writers"]), pq.Array(legacy["engineers"]))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando créditos"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando créditos"})
+		return
+	}
+
+	credits, _ := loadTrackCredits([]string{trackID})
+	if credits[trackID] == nil {
+		credits[trackID] = []models.Credit{}
+	}
+	c.JSON(http.StatusOK, gin.H{"track_id": trackID, "credits": credits[trackID]})
+}
+
+// missingArtists devuelve el primer artist_id de los créditos que no existe ("" si todos existen)
+func missingArtists(tx *sql.Tx, credits []models.CreditInput) (string, error) {
+	var ids []string
+	for _, cr := range credits {
+		if cr.ArtistID != "" {
+			ids = append(ids, cr.ArtistID)
+		}
+	}
+	if len(ids) == 0 {
+		return "", nil
+	}
+
+	rows, err := tx.Query("SELECT id FROM artists WHERE id = ANY($1::uuid[])", pq.Array(ids))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	found := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", err
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	for _, id := range ids {
+		if !found[strings.ToLower(id)] {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+// trackContributorsByName devuelve los contribuidores acreditados hoy en la
+// canción por nombre en minúsculas
+func trackContributorsByName(tx *sql.Tx, trackID string) (map[string]string, error) {
+	rows, err := tx.Query(`
+		SELECT DISTINCT c.id, LOWER(c.name) FROM track_contributors tc
+		JOIN contributors c ON c.id = tc.contributor_id
+		WHERE tc.track_id = $1`, trackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byName := map[string]string{}
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		byName[name] = id
+	}
+	return byName, rows.Err()
+}
+
+// resolveContributor encuentra el contribuidor de un crédito que solo trae
+// nombre. El nombre no identifica a una persona (dos productores pueden
+// llamarse igual), así que solo se reutiliza uno existente si ya estaba en la
+// canción o si el crédito trae artist_id y ese artista ya tiene contribuidor;
+// si no, se crea uno nuevo. Para acreditar a alguien ya conocido en otra
+// canción se manda su contributor_id.
+func resolveContributor(tx *sql.Tx, name, artistID string, current map[string]string) (string, string, error) {
+	if id, ok := current[strings.ToLower(name)]; ok {
+		err := tx.QueryRow(`
+			UPDATE contributors SET artist_id = COALESCE(artist_id, NULLIF($2, '')::uuid)
+			WHERE id = $1 RETURNING name`, id, artistID).Scan(&name)
+		return id, name, err
+	}
+
+	var id string
+	if artistID != "" {
+		err := tx.QueryRow("SELECT id, name FROM contributors WHERE artist_id = $1 ORDER BY created_at LIMIT 1", artistID).
+			Scan(&id, &name)
+		if err != sql.ErrNoRows {
+			return id, name, err
+		}
+	}
+	err := tx.QueryRow("INSERT INTO contributors (name, artist_id) VALUES ($1, NULLIF($2, '')::uuid) RETURNING id",
+		name, artistID).Scan(&id)
+	return id, name, err
+}
+
+// GetContributor devuelve un contribuidor y todo lo que ha hecho
+// GET /music/contributors/:id
+func GetContributor(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	var contributor models.Contributor
+	err := db.DB.QueryRow("SELECT id, name, artist_id FROM contributors WHERE id = $1::uuid", c.Param("id")).
+		Scan(&contributor.ID, &contributor.Name, &contributor.ArtistID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contribuidor no encontrado"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando contribuidor"})
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT tc.role, t.id, t.title, COALESCE(ar.name, ''), COALESCE(al.title, ''), COALESCE(t.cover_url, al.cover_url, '')
+		FROM track_contributors tc
+		JOIN tracks t ON t.id = tc.track_id
+		LEFT JOIN artists ar ON ar.id = t.artist_id
+		LEFT JOIN albums al ON al.id = t.album_id
+		WHERE tc.contributor_id = $1
+		ORDER BY al.release_date DESC NULLS LAST, t.title`, contributor.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando créditos"})
+		return
+	}
+	defer rows.Close()
+
+	works := []models.ContributorWork{}
+	for rows.Next() {
+		var w models.ContributorWork
+		if err := rows.Scan(&w.Role, &w.TrackID, &w.TrackTitle, &w.ArtistName, &w.AlbumTitle, &w.CoverURL); err != nil {
+			continue
+		}
+		works = append(works, w)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"contributor": contributor,
+		"credits":     works,
+	})
+}
+
+// UpdateContributor corrige el nombre o el artista vinculado (solo curadores)
+// PATCH /music/contributors/:id
+func UpdateContributor(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	var input struct {
+		Name     *string `json:"name"`
+		ArtistID *string `json:"artist_id"` // "" para desvincular
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	if input.ArtistID != nil && *input.ArtistID != "" && !utils.IsUUID(*input.ArtistID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "artist_id debe ser UUID"})
+		return
+	}
+
+	var contributor models.Contributor
+	err := db.DB.QueryRow(`
+		UPDATE contributors
+		SET name = COALESCE(NULLIF(TRIM($2), ''), name),
+		    artist_id = CASE WHEN $3::text IS NULL THEN artist_id ELSE NULLIF($3, '')::uuid END
+		WHERE id = $1::uuid
+		RETURNING id, name, artist_id`, c.Param("id"), input.Name, input.ArtistID).
+		Scan(&contributor.ID, &contributor.Name, &contributor.ArtistID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contribuidor no encontrado"})
+		return
+	} else if err != nil {
+		log.Printf("⚠️  Contribuidor %s: %v\n", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando contribuidor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, contributor)
+}
@@ -0,0 +1,200 @@
+package music
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	isrcRe   = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{7}$`)
+	digitsRe = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// normalizeExternalID deja el identificador en la forma en que lo guardamos.
+// Devuelve "" si no es válido, para que se ignore en vez de ensuciar la tabla.
+func normalizeExternalID(namespace, value string) string {
+	value = strings.TrimSpace(value)
+	switch namespace {
+	case "isrc":
+		// "US-RC1-76-07839" -> "USRC17607839"
+		value = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(value))
+		if !isrcRe.MatchString(value) {
+			return ""
+		}
+	case "upc":
+		// UPC-A (12) y EAN-13 son el mismo código: guardamos siempre 13 dígitos
+		value = strings.NewReplacer("-", "", " ", "").Replace(value)
+		if !digitsRe.MatchString(value) || len(value) < 12 || len(value) > 14 {
+			return ""
+		}
+		value = strings.TrimLeft(value, "0")
+		value = strings.Repeat("0", max(13-len(value), 0)) + value
+	default:
+		if value == "0" || !digitsRe.MatchString(value) {
+			return ""
+		}
+	}
+	return value
+}
+
+// querier es lo que comparten *sql.DB y *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// findByExternalID busca la entidad a la que apunta un identificador externo
+func findByExternalID(q querier, entityType, namespace, value string) (string, error) {
+	value = normalizeExternalID(namespace, value)
+	if value == "" {
+		return "", sql.ErrNoRows
+	}
+	var id string
+	err := q.QueryRow(`
+		SELECT entity_id FROM external_ids
+		WHERE entity_type = $1 AND namespace = $2 AND value = $3`,
+		entityType, namespace, value).Scan(&id)
+	return id, err
+}
+
+// linkExternalID asocia un identificador a una entidad. Si ya apuntaba a otra se respeta
+// el vínculo existente: el primero que llegó gana y la fusión es manual.
+func linkExternalID(q querier, entityType, entityID, namespace, value string) error {
+	value = normalizeExternalID(namespace, value)
+	if value == "" {
+		return nil
+	}
+	_, err := q.Exec(`
+		INSERT INTO external_ids (entity_type, namespace, value, entity_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`, entityType, namespace, value, entityID)
+	return err
+}
+
+// loadExternalIDs trae los identificadores externos de varias entidades de un tipo
+func loadExternalIDs(entityType string, ids []string) (map[string]map[string]string, error) {
+	rows, err := db.DB.Query(`
+		SELECT entity_id, namespace, value FROM external_ids
+		WHERE entity_type = $1 AND entity_id = ANY($2::uuid[])
+		ORDER BY created_at`, entityType, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]map[string]string{}
+	for rows.Next() {
+		var id, namespace, value string
+		if err := rows.Scan(&id, &namespace, &value); err != nil {
+			continue
+		}
+		if result[id] == nil {
+			result[id] = map[string]string{}
+		}
+		// Si hay varios del mismo tipo (reediciones) mostramos el primero
+		if _, ok := result[id][namespace]; !ok {
+			result[id][namespace] = value
+		}
+	}
+	return result, nil
+}
+
+// Lookup resuelve un identificador externo a nuestra entidad del catálogo
+// GET /music/lookup?isrc=USRC17607839
+// GET /music/lookup?upc=00602537518357
+// GET /music/lookup?deezer_id=3135556&type=track|album|artist
+func Lookup(c *gin.Context) {
+	var entityType, namespace, value string
+	switch {
+	case c.Query("isrc") != "":
+		entityType, namespace, value = "track", "isrc", c.Query("isrc")
+	case c.Query("upc") != "":
+		entityType, namespace, value = "album", "upc", c.Query("upc")
+	case c.Query("deezer_id") != "":
+		entityType, namespace, value = c.DefaultQuery("type", "track"), "deezer", c.Query("deezer_id")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indica isrc, upc o deezer_id"})
+		return
+	}
+
+	if entityType != "track" && entityType != "album" && entityType != "artist" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type debe ser track, album o artist"})
+		return
+	}
+	if normalizeExternalID(namespace, value) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Identificador " + strings.ToUpper(namespace) + " inválido"})
+		return
+	}
+
+	id, err := findByExternalID(db.DB, entityType, namespace, value)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No hay nada en el catálogo con ese identificador"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando identificador"})
+		return
+	}
+
+	result := models.LookupResult{Type: entityType, ID: id}
+	switch entityType {
+	case "track":
+		t, err := scanTrackDetails(db.DB.QueryRow(trackDetailsQuery+" WHERE t.id = $1", id))
+		if err == nil {
+			enrichTracks([]*models.Track{&t})
+			resolveStreamURLs(c, []*models.Track{&t})
+			result.Track = &t
+		}
+		if err = notFoundAsNil(err); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando canción"})
+			return
+		}
+	case "album":
+		al, err := scanAlbumSummary(db.DB.QueryRow(`
+			SELECT id, title, COALESCE(cover_url, ''), release_date, COALESCE(label, '')
+			FROM albums WHERE id = $1`, id))
+		if err == nil {
+			artists, _ := loadAlbumArtists([]string{id})
+			al.Artists = artists[id]
+			al.ArtistDisplay = artistDisplay(al.Artists)
+			result.Album = &al
+		}
+		if err = notFoundAsNil(err); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando álbum"})
+			return
+		}
+	case "artist":
+		var a models.ArtistSummary
+		err := db.DB.QueryRow("SELECT id, name, COALESCE(image_url, '') FROM artists WHERE id = $1", id).
+			Scan(&a.ID, &a.Name, &a.ImageURL)
+		if err == nil {
+			result.Artist = &a
+		}
+		if err = notFoundAsNil(err); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando artista"})
+			return
+		}
+	}
+
+	// El vínculo quedó huérfano (la entidad se borró)
+	if result.Track == nil && result.Album == nil && result.Artist == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No hay nada en el catálogo con ese identificador"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func notFoundAsNil(err error) error {
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
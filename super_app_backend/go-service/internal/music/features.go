@@ -0,0 +1,98 @@
+package music
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/audiofeatures"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+)
+
+// GetTrackFeatures devuelve tempo, tonalidad, energía y bailabilidad de una canción
+func GetTrackFeatures(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	var f models.AudioFeatures
+	err := db.DB.QueryRow(`
+		SELECT track_id, tempo_bpm, musical_key, mode, key_confidence, energy, danceability, analyzed_at
+		FROM track_audio_features WHERE track_id = $1::uuid`, c.Param("id")).
+		Scan(&f.TrackID, &f.TempoBPM, &f.KeyIndex, &f.Mode, &f.KeyConfidence, &f.Energy, &f.Danceability, &f.AnalyzedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "La canción aún no está analizada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando las características"})
+		return
+	}
+	f.Key = audiofeatures.KeyNames[f.KeyIndex]
+	c.JSON(http.StatusOK, f)
+}
+
+// TracksPendingFeatures devuelve las canciones con master propio que aún no se
+// analizaron con la versión actual del analizador (o todas, con all)
+func TracksPendingFeatures(all bool) ([]string, error) {
+	rows, err := db.DB.Query(`
+		SELECT t.id FROM tracks t
+		LEFT JOIN track_audio_features f ON f.track_id = t.id
+		WHERE EXISTS (SELECT 1 FROM transcode_jobs j WHERE j.track_id = t.id AND j.status = 'done')
+		  AND ($1 OR f.track_id IS NULL OR f.analyzer_version < $2)
+		ORDER BY t.id`, all, audiofeatures.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AnalyzeTrackFeatures decodifica el master del último trabajo terminado de la
+// canción y guarda sus características. Necesita ConfigureTranscoding.
+func AnalyzeTrackFeatures(ctx context.Context, trackID string) (audiofeatures.Features, error) {
+	masterKey, err := latestMasterKey(trackID)
+	if err != nil {
+		return audiofeatures.Features{}, err
+	}
+
+	workDir, err := os.MkdirTemp("", "features-")
+	if err != nil {
+		return audiofeatures.Features{}, err
+	}
+	defer os.RemoveAll(workDir)
+
+	master, err := localMaster(ctx, masterKey, workDir)
+	if err != nil {
+		return audiofeatures.Features{}, fmt.Errorf("no se pudo leer el master: %w", err)
+	}
+	a := audiofeatures.NewAnalyzer()
+	if err := transcodeEncoder.DecodePCM(ctx, master, audiofeatures.SampleRate, 1, a); err != nil {
+		return audiofeatures.Features{}, err
+	}
+	f, err := a.Features()
+	if err != nil {
+		return f, err
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO track_audio_features (track_id, tempo_bpm, musical_key, mode, key_confidence, energy, danceability, analyzer_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (track_id) DO UPDATE SET
+			tempo_bpm = EXCLUDED.tempo_bpm, musical_key = EXCLUDED.musical_key, mode = EXCLUDED.mode,
+			key_confidence = EXCLUDED.key_confidence, energy = EXCLUDED.energy, danceability = EXCLUDED.danceability,
+			analyzer_version = EXCLUDED.analyzer_version, analyzed_at = NOW()`,
+		trackID, f.TempoBPM, f.Key, f.Mode, f.KeyConfidence, f.Energy, f.Danceability, audiofeatures.Version)
+	return f, err
+}
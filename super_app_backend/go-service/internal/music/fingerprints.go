@@ -0,0 +1,226 @@
+package music
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/fingerprint"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	// Términos en común para considerar a otra canción candidata
+	minSharedTerms = 10
+	// Candidatas por canción que se comparan completas
+	maxFingerprintCandidates = 20
+)
+
+// fingerprintMaster calcula la huella de un master ya en disco y la guarda
+// junto con sus términos del índice de similitud
+func fingerprintMaster(ctx context.Context, trackID, master string) error {
+	g := fingerprint.NewGenerator()
+	if err := transcodeEncoder.DecodePCM(ctx, master, fingerprint.SampleRate, 1, g); err != nil {
+		return err
+	}
+	fp := g.Fingerprint()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO track_fingerprints (track_id, fingerprint, duration_ms, version)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (track_id) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint, duration_ms = EXCLUDED.duration_ms,
+			version = EXCLUDED.version, created_at = NOW()`,
+		trackID, fp.Bytes(), g.DurationMs(), fingerprint.Version)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM fingerprint_terms WHERE track_id = $1", trackID); err != nil {
+		return err
+	}
+	terms := fp.Terms()
+	values := make([]int64, len(terms))
+	for i, t := range terms {
+		values[i] = int64(t)
+	}
+	_, err = tx.Exec("INSERT INTO fingerprint_terms (term, track_id) SELECT unnest($1::int[]), $2", pq.Array(values), trackID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FingerprintTrack calcula la huella de una canción a partir del master de su
+// último trabajo terminado. Necesita ConfigureTranscoding.
+func FingerprintTrack(ctx context.Context, trackID string) error {
+	masterKey, err := latestMasterKey(trackID)
+	if err != nil {
+		return err
+	}
+	workDir, err := os.MkdirTemp("", "fingerprint-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	master, err := localMaster(ctx, masterKey, workDir)
+	if err != nil {
+		return fmt.Errorf("no se pudo leer el master: %w", err)
+	}
+	return fingerprintMaster(ctx, trackID, master)
+}
+
+// TracksPendingFingerprint devuelve las canciones con master propio sin
+// huella de la versión actual
+func TracksPendingFingerprint() ([]string, error) {
+	rows, err := db.DB.Query(`
+		SELECT t.id FROM tracks t
+		LEFT JOIN track_fingerprints f ON f.track_id = t.id
+		WHERE EXISTS (SELECT 1 FROM transcode_jobs j WHERE j.track_id = t.id AND j.status = 'done')
+		  AND (f.track_id IS NULL OR f.version <> $1)
+		ORDER BY t.id`, fingerprint.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// latestMasterKey es el master del último trabajo terminado de la canción (la
+// fuente sin pérdida de sus renditions, y sin cifrar)
+func latestMasterKey(trackID string) (string, error) {
+	var masterKey string
+	err := db.DB.QueryRow(`
+		SELECT master_key FROM transcode_jobs
+		WHERE track_id = $1::uuid AND status = 'done'
+		ORDER BY finished_at DESC LIMIT 1`, trackID).Scan(&masterKey)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("la canción no tiene master transcodificado")
+	}
+	return masterKey, err
+}
+
+// FindDuplicates recorre las huellas y devuelve los pares de canciones que
+// parecen la misma grabación, de mayor a menor confianza. El índice de
+// términos elige las candidatas; solo esas se comparan completas.
+func FindDuplicates(minConfidence float64, progress func(done, total int)) ([]models.DuplicateCandidate, error) {
+	rows, err := db.DB.Query("SELECT track_id FROM track_fingerprints WHERE version = $1 ORDER BY track_id", fingerprint.Version)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tracks := map[string]models.DuplicateTrack{}
+	var found []models.DuplicateCandidate
+	for i, id := range ids {
+		pairs, err := duplicatesOf(id, minConfidence)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+		for _, p := range pairs {
+			for j, t := range p.Tracks {
+				if _, ok := tracks[t.ID]; !ok {
+					if tracks[t.ID], err = duplicateTrack(t.ID); err != nil {
+						return nil, err
+					}
+				}
+				p.Tracks[j] = tracks[t.ID]
+			}
+			found = append(found, p)
+		}
+		if progress != nil {
+			progress(i+1, len(ids))
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Confidence > found[j].Confidence })
+	return found, nil
+}
+
+// duplicatesOf compara una canción con las candidatas del índice de id mayor
+// (cada par se revisa una sola vez)
+func duplicatesOf(trackID string, minConfidence float64) ([]models.DuplicateCandidate, error) {
+	var raw []byte
+	err := db.DB.QueryRow("SELECT fingerprint FROM track_fingerprints WHERE track_id = $1", trackID).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	fp := fingerprint.FromBytes(raw)
+
+	rows, err := db.DB.Query(`
+		SELECT b.track_id, COUNT(*), f.fingerprint
+		FROM fingerprint_terms a
+		JOIN fingerprint_terms b ON b.term = a.term AND b.track_id > a.track_id
+		JOIN track_fingerprints f ON f.track_id = b.track_id AND f.version = $4
+		WHERE a.track_id = $1
+		GROUP BY b.track_id, f.fingerprint
+		HAVING COUNT(*) >= $2
+		ORDER BY COUNT(*) DESC
+		LIMIT $3`, trackID, minSharedTerms, maxFingerprintCandidates, fingerprint.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []models.DuplicateCandidate
+	for rows.Next() {
+		var other string
+		var shared int
+		if err := rows.Scan(&other, &shared, &raw); err != nil {
+			return nil, err
+		}
+		confidence, offset := fingerprint.Compare(fp, fingerprint.FromBytes(raw))
+		if confidence < minConfidence {
+			continue
+		}
+		pairs = append(pairs, models.DuplicateCandidate{
+			Tracks:        [2]models.DuplicateTrack{{ID: trackID}, {ID: other}},
+			Confidence:    confidence,
+			OffsetSeconds: offset,
+			SharedTerms:   shared,
+		})
+	}
+	return pairs, rows.Err()
+}
+
+func duplicateTrack(id string) (models.DuplicateTrack, error) {
+	t := models.DuplicateTrack{ID: id}
+	err := db.DB.QueryRow(`
+		SELECT t.title, COALESCE(ar.name, ''), COALESCE(al.title, ''), COALESCE(t.duration_ms, 0)
+		FROM tracks t
+		LEFT JOIN artists ar ON ar.id = t.artist_id
+		LEFT JOIN albums al ON al.id = t.album_id
+		WHERE t.id = $1`, id).Scan(&t.Title, &t.Artist, &t.Album, &t.DurationMs)
+	return t, err
+}
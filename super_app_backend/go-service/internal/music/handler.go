@@ -1,12 +1,29 @@
 package music
 
 import (
+	"database/sql"
+	"fmt"
 	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/loudness"
 	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+	"github.com/lib/pq"
 )
 
+// validID responde 400 si id no es un UUID; las consultas comparan contra la
+// columna uuid (y su índice) y con otro texto Postgres daría error
+func validID(c *gin.Context, id string) bool {
+	if utils.IsUUID(id) {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+	return false
+}
+
 // GetTrendingArtists devuelve artistas para la pantalla de "Gustos" (Req 1.2)
 func GetTrendingArtists(c *gin.Context) {
 	// Consultamos los 20 artistas más populares
@@ -30,53 +47,175 @@ func GetTrendingArtists(c *gin.Context) {
 	c.JSON(http.StatusOK, artists)
 }
 
-// GetTrackDetails devuelve metadatos completos y créditos (Req 3.4)
-func GetTrackDetails(c *gin.Context) {
-	trackID := c.Param("id")
+// trackDetailsQuery trae la canción con su artista, álbum y créditos en una sola consulta
+const trackDetailsQuery = `
+	SELECT t.id, t.title, COALESCE(t.artist_id::text, ''), COALESCE(t.album_id::text, ''), t.duration_ms,
+	       t.stream_url, COALESCE(t.canvas_url, ''), COALESCE(t.cover_url, al.cover_url, ''),
+	       COALESCE(t.has_lyrics, false), COALESCE(t.is_explicit, false),
+	       COALESCE(t.track_number, 0), COALESCE(t.disc_number, 0), t.available_qualities,
+	       COALESCE(t.premium_only, false),
+	       EXISTS (SELECT 1 FROM track_renditions pr WHERE pr.track_id = t.id AND pr.quality = 'PREVIEW'),
+	       t.loudness_lufs, t.true_peak_dbtp, t.gain_db, al.loudness_lufs, al.true_peak_dbtp, al.gain_db,
+	       ar.id, ar.name, ar.image_url,
+	       al.id, al.title, al.cover_url, al.release_date, al.label,
+	       tc.producers, tc.writers, tc.engineers
+	FROM tracks t
+	LEFT JOIN artists ar ON ar.id = t.artist_id
+	LEFT JOIN albums al ON al.id = t.album_id
+	LEFT JOIN track_credits tc ON tc.track_id = t.id`
+
+// rowScanner nos deja reutilizar el escaneo con *sql.Row y *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTrackDetails(row rowScanner) (models.Track, error) {
 	var t models.Track
+	var artistID, artistName, artistImg sql.NullString
+	var albumID, albumTitle, albumCover, albumLabel sql.NullString
+	var releaseDate sql.NullTime
+	var hasPreview bool
+	var lufs, peak, gain, albumLUFS, albumPeak, albumGain sql.NullFloat64
 
-	// Query compleja para traer todo (en la vida real usaríamos un ORM o JOINs, aquí simplificado)
-	query := `
-		SELECT id, title, stream_url, canvas_url, has_lyrics, is_explicit 
-		FROM tracks WHERE id = $1`
-	
-	err := db.DB.QueryRow(query, trackID).Scan(
-		&t.ID, &t.Title, &t.StreamURL, &t.CanvasURL, &t.HasLyrics, &t.IsExplicit,
+	err := row.Scan(
+		&t.ID, &t.Title, &t.ArtistID, &t.AlbumID, &t.DurationMs,
+		&t.StreamURL, &t.CanvasURL, &t.CoverURL, &t.HasLyrics, &t.IsExplicit,
+		&t.TrackNumber, &t.DiscNumber, &t.Qualities,
+		&t.PremiumOnly, &hasPreview,
+		&lufs, &peak, &gain, &albumLUFS, &albumPeak, &albumGain,
+		&artistID, &artistName, &artistImg,
+		&albumID, &albumTitle, &albumCover, &releaseDate, &albumLabel,
+		&t.Producers, &t.Writers, &t.Engineers,
 	)
-
 	if err != nil {
+		return t, err
+	}
+
+	if hasPreview {
+		t.PreviewURL = previewPath(t.ID)
+	}
+	if lufs.Valid {
+		t.Loudness = &models.Loudness{
+			ReferenceLUFS:  loudness.ReferenceLUFS,
+			IntegratedLUFS: lufs.Float64,
+			TruePeakDBTP:   peak.Float64,
+			TrackGainDB:    gain.Float64,
+		}
+		if albumLUFS.Valid {
+			t.Loudness.AlbumLUFS = &albumLUFS.Float64
+			t.Loudness.AlbumPeakDBTP = &albumPeak.Float64
+			t.Loudness.AlbumGainDB = &albumGain.Float64
+		}
+	}
+	if artistID.Valid {
+		t.Artist = &models.ArtistSummary{ID: artistID.String, Name: artistName.String, ImageURL: artistImg.String}
+	}
+	if albumID.Valid {
+		t.Album = &models.AlbumSummary{ID: albumID.String, Title: albumTitle.String, CoverURL: albumCover.String, Label: albumLabel.String}
+		if releaseDate.Valid {
+			t.Album.ReleaseDate = &releaseDate.Time
+		}
+	}
+	return t, nil
+}
+
+// GetTrackDetails devuelve metadatos completos y créditos (Req 3.4)
+func GetTrackDetails(c *gin.Context) {
+	trackID := c.Param("id")
+	if !validID(c, trackID) {
+		return
+	}
+
+	t, err := scanTrackDetails(db.DB.QueryRow(trackDetailsQuery+" WHERE t.id = $1::uuid", trackID))
+	if err == sql.ErrNoRows {
+		// Una canción fusionada responde con la que quedó (el cliente ve otro id)
+		if redirects, _ := trackRedirects([]string{trackID}); redirects[trackID] != "" {
+			t, err = scanTrackDetails(db.DB.QueryRow(trackDetailsQuery+" WHERE t.id = $1", redirects[trackID]))
+		}
+	}
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
 		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando canción"})
+		return
 	}
 
+	enrichTracks([]*models.Track{&t})
+	resolveStreamURLs(c, []*models.Track{&t})
+
 	c.JSON(http.StatusOK, t)
 }
 
-// GetLyrics (Endpoint 3.3)
-func GetLyrics(c *gin.Context) {
-    trackID := c.Param("id")
+// Máximo de canciones por petición batch (la cola del reproductor)
+const maxBatchTracks = 100
 
-    rows, err := db.DB.Query("SELECT time_ms, text FROM lyrics WHERE track_id = $1 ORDER BY time_ms ASC", trackID)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error buscando letras"})
-        return
-    }
-    defer rows.Close()
+// GetTracksBatch devuelve varias canciones completas en el orden pedido
+// GET /music/tracks?ids=id1,id2,id3
+func GetTracksBatch(c *gin.Context) {
+	var ids []string
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			if !validID(c, id) {
+				return
+			}
+			ids = append(ids, id)
+		}
+	}
 
-    var lyrics []models.LyricLine
-    for rows.Next() {
-        var l models.LyricLine
-        if err := rows.Scan(&l.TimeMs, &l.Text); err != nil {
-            continue
-        }
-        lyrics = append(lyrics, l)
-    }
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parámetro ids requerido"})
+		return
+	}
+	if len(ids) > maxBatchTracks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Máximo %d canciones por petición", maxBatchTracks)})
+		return
+	}
 
-    // Si no hay letras, devolvemos array vacío (no 404)
-    if lyrics == nil {
-        lyrics = []models.LyricLine{}
-    }
-    c.JSON(http.StatusOK, lyrics)
+	// Los IDs de canciones fusionadas se sirven con la que quedó
+	redirects, err := trackRedirects(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando canciones"})
+		return
+	}
+	lookup := append([]string{}, ids...)
+	for _, id := range redirects {
+		lookup = append(lookup, id)
+	}
+
+	rows, err := db.DB.Query(trackDetailsQuery+" WHERE t.id = ANY($1::uuid[])", pq.Array(lookup))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando canciones"})
+		return
+	}
+	defer rows.Close()
+
+	found := map[string]*models.Track{}
+	var scanned []*models.Track
+	for rows.Next() {
+		t, err := scanTrackDetails(rows)
+		if err != nil {
+			continue
+		}
+		found[t.ID] = &t
+		scanned = append(scanned, &t)
+	}
+
+	enrichTracks(scanned)
+	resolveStreamURLs(c, scanned)
+
+	// Respetamos el orden de la cola; los IDs inexistentes se omiten
+	tracks := []models.Track{}
+	for _, id := range ids {
+		if redirect, ok := redirects[id]; ok {
+			id = redirect
+		}
+		if t, ok := found[id]; ok {
+			tracks = append(tracks, *t)
+		}
+	}
+
+	c.JSON(http.StatusOK, tracks)
 }
 
 // GenerateWelcomeMix (Endpoint 1.3 - Simulación de Recomendación)
@@ -86,7 +225,9 @@ func GenerateWelcomeMix(c *gin.Context) {
     // Aquí simulamos "Inteligencia" seleccionando canciones aleatorias.
 
     query := `
-        SELECT id, title, artist_id, album_id, duration_ms, stream_url, canvas_url, has_lyrics, is_explicit 
+        SELECT id, title, artist_id, album_id, duration_ms, stream_url, canvas_url, has_lyrics, is_explicit,
+               COALESCE(premium_only, false),
+               EXISTS (SELECT 1 FROM track_renditions pr WHERE pr.track_id = tracks.id AND pr.quality = 'PREVIEW')
         FROM tracks 
         ORDER BY RANDOM() 
         LIMIT 5`
@@ -101,16 +242,27 @@ func GenerateWelcomeMix(c *gin.Context) {
     var tracks []models.Track
     for rows.Next() {
         var t models.Track
+        var hasPreview bool
         // Usamos variables dummy para los campos que no tenemos en el struct simple
         // Ojo: Asegúrate de que tu struct Track coincida con estos campos
         err := rows.Scan(
             &t.ID, &t.Title, &t.ArtistID, &t.AlbumID, &t.DurationMs, 
-            &t.StreamURL, &t.CanvasURL, &t.HasLyrics, &t.IsExplicit,
+            &t.StreamURL, &t.CanvasURL, &t.HasLyrics, &t.IsExplicit, &t.PremiumOnly, &hasPreview,
         )
         if err != nil { continue }
+        // Sin esto los anónimos verían "blocked" aunque haya vista previa
+        if hasPreview {
+            t.PreviewURL = previewPath(t.ID)
+        }
         tracks = append(tracks, t)
     }
 
+    mixTracks := make([]*models.Track, len(tracks))
+    for i := range tracks {
+        mixTracks[i] = &tracks[i]
+    }
+    resolveStreamURLs(c, mixTracks)
+
     playlist := models.Playlist{
         ID:          "mix_welcome_gen",
         Name:        "Tu Mix Diario",
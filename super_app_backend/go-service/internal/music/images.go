@@ -0,0 +1,363 @@
+package music
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/imaging"
+	"github.com/giampier/super-app-api/internal/storage"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// Las variantes no cambian mientras no cambie la URL de origen (va en el ETag)
+	imageCacheControl = "public, max-age=604800, stale-while-revalidate=86400"
+	// El placeholder se vuelve a intentar pronto por si la fuente vuelve
+	placeholderCacheControl = "public, max-age=300"
+	maxImageBytes           = 20 << 20
+	imageFetchTimeout       = 15 * time.Second
+	maxImageRedirects       = 5
+)
+
+// Hosts de los que aceptamos descargar por defecto (y sus subdominios): los
+// CDNs de Tidal y Deezer de los que vienen cover_url e image_url
+var defaultImageHosts = []string{"tidal.com", "dzcdn.net", "deezer.com"}
+
+// Tamaños que se generan: lo pedido se redondea hacia arriba al siguiente para
+// no guardar una variante por cada píxel
+var imageSizes = []int{32, 64, 128, 160, 240, 320, 480, 640, 800, 1024, 1280, 1600, imaging.MaxSide}
+
+// Fuente de cada tipo de imagen; los IDs fusionados resuelven al que quedó
+var imageSources = map[string]string{
+	"artist": `SELECT image_url FROM artists
+		WHERE id = $1::uuid OR id = (SELECT artist_id FROM artist_redirects WHERE old_id = $1::uuid)`,
+	"album": "SELECT cover_url FROM albums WHERE id = $1::uuid",
+	"track": `SELECT COALESCE(NULLIF(t.cover_url, ''), al.cover_url)
+		FROM tracks t LEFT JOIN albums al ON al.id = t.album_id
+		WHERE t.id = $1::uuid OR t.id = (SELECT track_id FROM track_redirects WHERE old_id = $1::uuid)`,
+}
+
+var (
+	imageStore   storage.Storage
+	imageFFmpeg  string   // Vacío si no hay ffmpeg (sin WebP)
+	imageOrigin  *url.URL // Base de las URLs relativas (portadas de catalogctl ingest)
+	imageHosts   []string
+	imageClient  = &http.Client{Timeout: imageFetchTimeout, CheckRedirect: checkImageRedirect}
+	imageFetches singleflight.Group // Una sola descarga a la vez por original
+
+	errImageGone = errors.New("la imagen de origen ya no existe")
+)
+
+// ConfigureImages prepara el proxy de imágenes:
+// IMAGE_ORIGIN es la base de las URLs relativas (p. ej. "/covers/x.jpg") e
+// IMAGE_ALLOWED_HOSTS la lista de hosts permitidos separados por comas
+// (además del de IMAGE_ORIGIN). Usa el almacenamiento y el ffmpeg de
+// ConfigureTranscoding.
+func ConfigureImages() error {
+	imageStore = transcodeStore
+	imageFFmpeg = ""
+	if transcodeEncoder != nil && transcodeEncoder.Available() == nil {
+		imageFFmpeg = transcodeEncoder.FFmpeg
+	}
+
+	imageHosts = defaultImageHosts
+	if hosts := os.Getenv("IMAGE_ALLOWED_HOSTS"); hosts != "" {
+		imageHosts = nil
+		for _, h := range strings.Split(hosts, ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+				imageHosts = append(imageHosts, h)
+			}
+		}
+	}
+
+	imageOrigin = nil
+	if origin := os.Getenv("IMAGE_ORIGIN"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("IMAGE_ORIGIN inválido: %q", origin)
+		}
+		imageOrigin = u
+		imageHosts = append(imageHosts, strings.ToLower(u.Hostname()))
+	}
+	return nil
+}
+
+// GetImage sirve la imagen de un artista, álbum o canción redimensionada
+// GET /images/:kind/:id?w=&h=&fmt=jpeg|webp
+// El original se descarga una sola vez y se guarda; cada variante también.
+func GetImage(c *gin.Context) {
+	query, ok := imageSources[c.Param("kind")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tipo de imagen desconocido"})
+		return
+	}
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	w, errW := imageSize(c.Query("w"))
+	h, errH := imageSize(c.Query("h"))
+	if errW != nil || errH != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("w y h deben ser enteros entre 1 y %d", imaging.MaxSide)})
+		return
+	}
+	w, h = snapImageSize(w, h)
+	format := imaging.JPEG
+	switch strings.ToLower(c.Query("fmt")) {
+	case "", "jpeg", "jpg":
+	case "webp":
+		// Sin ffmpeg se sirve JPEG (el Content-Type lo indica)
+		if imageFFmpeg != "" {
+			format = imaging.WebP
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato no soportado (usa jpeg o webp)"})
+		return
+	}
+
+	var source sql.NullString
+	err := db.DB.QueryRow(query, c.Param("id")).Scan(&source)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Imagen no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando la imagen"})
+		return
+	}
+	serveImage(c, c.Param("kind"), c.Param("id"), source.String, w, h, format)
+}
+
+// serveImage responde la variante pedida de la imagen de origen source ("" =
+// sin imagen), desde el almacenamiento o generándola
+func serveImage(c *gin.Context, kind, id, source string, w, h int, format string) {
+	if source == "" || imageStore == nil {
+		servePlaceholder(c, w, h)
+		return
+	}
+
+	// La carpeta depende de la URL de origen: si cambia la portada se
+	// descarga la nueva y el ETag cambia
+	sum := sha256.Sum256([]byte(source))
+	version := hex.EncodeToString(sum[:8])
+	dir := path.Join("images", kind, id, version)
+	variant := fmt.Sprintf("%dx%d.%s", w, h, format)
+	etag := `"` + version + "-" + variant + `"`
+
+	c.Header("Cache-Control", imageCacheControl)
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if data, err := readStored(ctx, path.Join(dir, variant)); err == nil {
+		c.Data(http.StatusOK, imaging.ContentType(format), data)
+		return
+	}
+
+	data, err := renderImage(ctx, dir, source, w, h, format)
+	if errors.Is(err, imaging.ErrWebPUnavailable) && format == imaging.WebP {
+		format = imaging.JPEG
+		c.Header("ETag", `"`+version+"-"+fmt.Sprintf("%dx%d.%s", w, h, format)+`"`)
+		data, err = renderImage(ctx, dir, source, w, h, format)
+	}
+	if err != nil {
+		if !errors.Is(err, errImageGone) {
+			log.Printf("⚠️  Imagen %s/%s: %v\n", kind, id, err)
+		}
+		servePlaceholder(c, w, h)
+		return
+	}
+	c.Data(http.StatusOK, imaging.ContentType(format), data)
+}
+
+// renderImage genera (y guarda) una variante a partir del original
+func renderImage(ctx context.Context, dir, source string, w, h int, format string) ([]byte, error) {
+	original, err := imageOriginal(ctx, path.Join(dir, "original"), source)
+	if err != nil {
+		return nil, err
+	}
+	img, err := imaging.Decode(ctx, original, imageFFmpeg)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo decodificar el original: %w", err)
+	}
+	b := img.Bounds()
+	fw, fh := imaging.Fit(b.Dx(), b.Dy(), w, h)
+	data, err := imaging.Encode(ctx, imaging.Resize(img, fw, fh), format, imageFFmpeg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Se guarda con el tamaño pedido (no el final) porque es lo que se busca
+	key := path.Join(dir, fmt.Sprintf("%dx%d.%s", w, h, format))
+	if err := imageStore.Put(ctx, key, bytes.NewReader(data), imaging.ContentType(format)); err != nil {
+		log.Printf("⚠️  No se pudo guardar la variante %s: %v\n", key, err)
+	}
+	return data, nil
+}
+
+// imageOriginal devuelve el original guardado o lo descarga y lo guarda. Las
+// peticiones simultáneas por el mismo original comparten una sola descarga,
+// que no se corta si el cliente que la empezó se va.
+func imageOriginal(ctx context.Context, key, source string) ([]byte, error) {
+	if data, err := readStored(ctx, key); err == nil {
+		return data, nil
+	}
+	v, err, _ := imageFetches.Do(key, func() (interface{}, error) {
+		ctx := context.WithoutCancel(ctx)
+		if data, err := readStored(ctx, key); err == nil {
+			return data, nil
+		}
+		data, err := fetchImage(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		if err := imageStore.Put(ctx, key, bytes.NewReader(data), http.DetectContentType(data)); err != nil {
+			log.Printf("⚠️  No se pudo guardar el original %s: %v\n", key, err)
+		}
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// fetchImage descarga la imagen de origen (solo de los hosts permitidos)
+func fetchImage(ctx context.Context, source string) ([]byte, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("URL de origen inválida: %w", err)
+	}
+	if !u.IsAbs() {
+		if imageOrigin == nil {
+			return nil, fmt.Errorf("URL relativa %q sin IMAGE_ORIGIN", source)
+		}
+		u = imageOrigin.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || !imageHostAllowed(u.Hostname()) {
+		return nil, fmt.Errorf("origen no permitido: %s", u.Host)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, errImageGone
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("el origen respondió %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageBytes {
+		return nil, fmt.Errorf("la imagen de origen supera %d MB", maxImageBytes>>20)
+	}
+	return data, nil
+}
+
+// checkImageRedirect vuelve a aplicar la lista de hosts en cada salto: un
+// origen permitido no puede redirigir a la red interna
+func checkImageRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxImageRedirects {
+		return errors.New("demasiadas redirecciones")
+	}
+	if (req.URL.Scheme != "http" && req.URL.Scheme != "https") || !imageHostAllowed(req.URL.Hostname()) {
+		return fmt.Errorf("redirección a un origen no permitido: %s", req.URL.Host)
+	}
+	return nil
+}
+
+func imageHostAllowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range imageHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageSize lee w o h (vacío = 0, libre)
+func imageSize(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > imaging.MaxSide {
+		return 0, fmt.Errorf("tamaño inválido: %q", v)
+	}
+	return n, nil
+}
+
+// snapImageSize redondea hacia arriba al siguiente tamaño generado; con ancho
+// y alto se redondea el ancho y el alto lo sigue para conservar la proporción
+func snapImageSize(w, h int) (int, int) {
+	snap := func(n int) int {
+		for _, size := range imageSizes {
+			if n <= size {
+				return size
+			}
+		}
+		return imaging.MaxSide
+	}
+	switch {
+	case w > 0 && h > 0:
+		sw := snap(w)
+		return sw, min(imaging.MaxSide, max(1, (h*sw+w/2)/w))
+	case w > 0:
+		return snap(w), 0
+	case h > 0:
+		return 0, snap(h)
+	}
+	return 0, 0
+}
+
+func readStored(ctx context.Context, key string) ([]byte, error) {
+	r, err := imageStore.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// servePlaceholder responde el cuadro gris cuando no hay imagen de origen
+func servePlaceholder(c *gin.Context, w, h int) {
+	data, err := imaging.Encode(c.Request.Context(), imaging.Placeholder(w, h), imaging.JPEG, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo generar la imagen"})
+		return
+	}
+	c.Header("Cache-Control", placeholderCacheControl)
+	c.Header("ETag", "")
+	c.Header("X-Image-Placeholder", "1")
+	c.Data(http.StatusOK, imaging.ContentType(imaging.JPEG), data)
+}
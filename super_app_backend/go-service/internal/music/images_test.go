@@ -0,0 +1,188 @@
+package music
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/imaging"
+	"github.com/giampier/super-app-api/internal/storage"
+)
+
+// fakeImageOrigin sirve una portada PNG de 400x300 y cuenta las descargas.
+// Solo 127.0.0.1 queda permitido; /redirect manda a "localhost", que no lo está.
+func fakeImageOrigin(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	var cover bytes.Buffer
+	if err := png.Encode(&cover, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/cover.png":
+			w.Write(cover.Bytes())
+		case "/redirect":
+			http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", "localhost", 1)+"/cover.png", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	imageStore = storage.NewLocal(t.TempDir(), "/media")
+	imageFFmpeg = ""
+	imageOrigin = nil
+	imageHosts = []string{"127.0.0.1"}
+	return srv, &hits
+}
+
+// getImage pide una variante (como GetImage, con la fuente ya consultada)
+func getImage(t *testing.T, id, source, query string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/images/album/"+id+"?"+query, nil)
+	for k, v := range header {
+		c.Request.Header[k] = v
+	}
+	ww, errW := imageSize(c.Query("w"))
+	hh, errH := imageSize(c.Query("h"))
+	if errW != nil || errH != nil {
+		t.Fatalf("tamaño inválido: %s", query)
+	}
+	ww, hh = snapImageSize(ww, hh)
+	serveImage(c, "album", id, source, ww, hh, imaging.JPEG)
+	c.Writer.WriteHeaderNow() // Lo que haría el servidor al terminar (p. ej. un 304 sin cuerpo)
+	return w
+}
+
+func TestImageResize(t *testing.T) {
+	srv, _ := fakeImageOrigin(t)
+
+	// 100 se redondea al tamaño generado siguiente (128) y el alto sigue la proporción
+	w := getImage(t, "a1", srv.URL+"/cover.png", "w=100", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("respuesta inesperada: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("X-Image-Placeholder") != "" {
+		t.Fatal("se sirvió el placeholder")
+	}
+	img, err := jpeg.Decode(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 128 || b.Dy() != 96 {
+		t.Fatalf("tamaño %dx%d, se esperaba 128x96", b.Dx(), b.Dy())
+	}
+
+	// Con ancho y alto se recorta para llenar el recuadro
+	img, err = jpeg.Decode(getImage(t, "a1", srv.URL+"/cover.png", "w=64&h=64", nil).Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 64 {
+		t.Fatalf("tamaño %dx%d, se esperaba 64x64", b.Dx(), b.Dy())
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	srv, hits := fakeImageOrigin(t)
+	source := srv.URL + "/cover.png"
+
+	first := getImage(t, "a2", source, "w=64", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Cache-Control") != imageCacheControl {
+		t.Fatalf("respuesta inesperada: %d etag=%q cache=%q", first.Code, etag, first.Header().Get("Cache-Control"))
+	}
+
+	// La variante sale del almacenamiento y otro tamaño reutiliza el original guardado
+	second := getImage(t, "a2", source, "w=64", nil)
+	if second.Code != http.StatusOK || second.Header().Get("ETag") != etag || !bytes.Equal(second.Body.Bytes(), first.Body.Bytes()) {
+		t.Fatal("la segunda respuesta no coincide con la primera")
+	}
+	getImage(t, "a2", source, "w=320", nil)
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("el origen recibió %d descargas, se esperaba 1", n)
+	}
+
+	if w := getImage(t, "a2", source, "w=64", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Fatalf("con If-None-Match se esperaba 304, llegó %d", w.Code)
+	}
+
+	// Otra portada es otra versión: cambia el ETag
+	if w := getImage(t, "a2", source+"?v=2", "w=64", nil); w.Header().Get("ETag") == etag {
+		t.Fatal("el ETag no cambió con la URL de origen")
+	}
+}
+
+func TestImagePlaceholder(t *testing.T) {
+	srv, _ := fakeImageOrigin(t)
+
+	for _, source := range []string{"", srv.URL + "/gone.png"} {
+		w := getImage(t, "a3", source, "w=128&h=128", nil)
+		if w.Code != http.StatusOK || w.Header().Get("X-Image-Placeholder") != "1" {
+			t.Fatalf("%q: se esperaba el placeholder, llegó %d", source, w.Code)
+		}
+		if w.Header().Get("Cache-Control") != placeholderCacheControl || w.Header().Get("ETag") != "" {
+			t.Fatalf("%q: el placeholder no debe cachearse como una imagen", source)
+		}
+		img, err := jpeg.Decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != 128 || b.Dy() != 128 {
+			t.Fatalf("placeholder de %dx%d, se esperaba 128x128", b.Dx(), b.Dy())
+		}
+		if r, g, b, _ := img.At(64, 64).RGBA(); r != g || g != b {
+			t.Fatalf("el placeholder debería ser gris: %v", color.RGBAModel.Convert(img.At(64, 64)))
+		}
+	}
+}
+
+func TestImageHostAllowList(t *testing.T) {
+	srv, hits := fakeImageOrigin(t)
+
+	imageHosts = []string{"dzcdn.net"}
+	for host, want := range map[string]bool{
+		"dzcdn.net": true, "e-cdns-images.dzcdn.net": true, "DZCDN.NET": true,
+		"evildzcdn.net": false, "dzcdn.net.evil.com": false, "127.0.0.1": false,
+	} {
+		if got := imageHostAllowed(host); got != want {
+			t.Errorf("%s: permitido=%v, se esperaba %v", host, got, want)
+		}
+	}
+
+	// Un host fuera de la lista no se descarga
+	if w := getImage(t, "a4", srv.URL+"/cover.png", "w=64", nil); w.Header().Get("X-Image-Placeholder") != "1" {
+		t.Fatal("se sirvió una imagen de un host no permitido")
+	}
+	if n := hits.Load(); n != 0 {
+		t.Fatalf("el origen recibió %d peticiones, se esperaban 0", n)
+	}
+
+	// Ni siquiera si un origen permitido redirige a otro que no lo está
+	imageHosts = []string{"127.0.0.1"}
+	if w := getImage(t, "a4", srv.URL+"/redirect", "w=64", nil); w.Header().Get("X-Image-Placeholder") != "1" {
+		t.Fatal("se siguió una redirección a un host no permitido")
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("el origen recibió %d peticiones, se esperaba solo la redirección", n)
+	}
+}
@@ -2,80 +2,487 @@ package music
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/giampier/super-app-api/internal/db"
 	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+	"github.com/lib/pq"
 )
 
 // SyncTrack recibe metadata de Deezer y la guarda en Postgres
 func SyncTrack(c *gin.Context) {
 	var input models.SyncTrackInput
-	
+
 	// Validar JSON entrante
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 1. SINCRONIZAR ARTISTA
-	// Intentamos buscarlo primero
-	var artistID string
-	err := db.DB.QueryRow("SELECT id FROM artists WHERE name = $1", input.ArtistName).Scan(&artistID)
-	
-	if err == sql.ErrNoRows {
-		// No existe, lo creamos
-		err = db.DB.QueryRow(`
-			INSERT INTO artists (name, image_url, popularity) 
-			VALUES ($1, $2, 100) 
-			RETURNING id`, 
-			input.ArtistName, input.ArtistImg).Scan(&artistID)
-		
+	result, err := SyncCatalogTrack(input)
+	if errors.Is(err, errInvalidSync) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sincronizando canción: " + err.Error()})
+		return
+	}
+
+	if result.Status == "created" {
+		c.JSON(http.StatusCreated, result)
+	} else {
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+var errInvalidSync = errors.New("datos incompletos")
+
+// Intentos ante deadlocks o carreras de unicidad con otra sincronización
+const syncRetries = 3
+
+// SyncCatalogTrack sincroniza artista, álbum y canción en una sola transacción
+func SyncCatalogTrack(input models.SyncTrackInput) (models.SyncResult, error) {
+	if strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.ArtistName) == "" {
+		return models.SyncResult{}, fmt.Errorf("%w: title y artist_name son obligatorios", errInvalidSync)
+	}
+
+	var result models.SyncResult
+	err := withCatalogTx(func(s *catalogSync) error {
+		var err error
+		result, err = s.syncTrack(input)
+		return err
+	})
+	return result, err
+}
+
+// SyncCatalogArtist sincroniza solo el artista (nombre, imagen e ID de Deezer).
+// De "A feat. B" se da de alta solo A, igual que al sincronizar álbumes y canciones.
+func SyncCatalogArtist(input models.SyncTrackInput) (models.SyncResult, error) {
+	input.ArtistName, _ = splitFeaturing(input.ArtistName)
+	if input.ArtistName == "" {
+		return models.SyncResult{}, fmt.Errorf("%w: artist_name es obligatorio", errInvalidSync)
+	}
+
+	var result models.SyncResult
+	err := withCatalogTx(func(s *catalogSync) error {
+		var err error
+		result.Artist, err = s.upsertArtist(input.ArtistName, input.ArtistImg, input.DeezerArtistID)
+		result.Status = result.Artist.Status
+		return err
+	})
+	return result, err
+}
+
+// SyncCatalogAlbum sincroniza el álbum y su artista principal, sin canciones
+func SyncCatalogAlbum(input models.SyncTrackInput) (models.SyncResult, error) {
+	if strings.TrimSpace(input.AlbumTitle) == "" || strings.TrimSpace(input.ArtistName) == "" {
+		return models.SyncResult{}, fmt.Errorf("%w: album_title y artist_name son obligatorios", errInvalidSync)
+	}
+
+	var result models.SyncResult
+	err := withCatalogTx(func(s *catalogSync) error {
+		var err error
+		input.ArtistName, _ = splitFeaturing(input.ArtistName)
+		if result.Artist, err = s.upsertArtist(input.ArtistName, input.ArtistImg, input.DeezerArtistID); err != nil {
+			return err
+		}
+		result.Album, err = s.upsertAlbum(input, result.Artist.ID)
+		result.Status = result.Album.Status
+		return err
+	})
+	return result, err
+}
+
+// withCatalogTx corre fn en una transacción, la reintenta si chocó con otra
+// sincronización y, tras el commit, actualiza el índice de búsqueda y la cola de letras
+func withCatalogTx(fn func(s *catalogSync) error) error {
+	var err error
+	for attempt := 0; attempt < syncRetries; attempt++ {
+		var tx *sql.Tx
+		tx, err = db.DB.Begin()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creando artista: " + err.Error()})
-			return
+			return err
+		}
+
+		s := &catalogSync{tx: tx}
+		if err = fn(s); err == nil {
+			if err = tx.Commit(); err == nil {
+				s.afterCommit()
+				return nil
+			}
+		}
+		tx.Rollback()
+
+		if !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// isRetryable: deadlock, fallo de serialización o violación de unicidad por carrera
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "40P01", "40001", "23505":
+			return true
+		}
+	}
+	return false
+}
+
+// catalogSync acumula los cambios de una transacción de sincronización.
+// Los efectos fuera de la base (índice, letras) solo se aplican si hace commit.
+type catalogSync struct {
+	tx          *sql.Tx
+	suggestions []models.SearchSuggestion
+	newTracks   []string
+}
+
+func (s *catalogSync) afterCommit() {
+	for _, sug := range s.suggestions {
+		searchIndex.Update(sug, 100)
+	}
+	for _, id := range s.newTracks {
+		EnqueueLyricsFetch(id)
+	}
+}
+
+// syncTrack hace el upsert de artista(s), álbum y canción
+func (s *catalogSync) syncTrack(input models.SyncTrackInput) (models.SyncResult, error) {
+	var result models.SyncResult
+
+	// "A feat. B" en el artista o "Canción (feat. B)" en el título
+	primaryName, featured := splitFeaturing(input.ArtistName)
+	_, fromTitle := splitFeaturing(input.Title)
+	featured = append(append(featured, fromTitle...), input.FeaturedArtists...)
+	input.ArtistName = primaryName
+
+	// 1. SINCRONIZAR ARTISTA
+	artist, err := s.upsertArtist(input.ArtistName, input.ArtistImg, input.DeezerArtistID)
+	if err != nil {
+		return result, err
+	}
+	result.Artist = artist
+
+	// Los invitados y remixers también son artistas del catálogo
+	credits := []models.ArtistCredit{{ID: artist.ID, Role: "primary"}}
+	seen := map[string]bool{artist.ID + "primary": true}
+	for _, group := range []struct {
+		role  string
+		names []string
+	}{{"featured", featured}, {"remixer", input.Remixers}} {
+		for _, name := range group.names {
+			a, err := s.upsertArtist(name, "", "")
+			if err != nil {
+				return result, err
+			}
+			if !seen[a.ID+group.role] {
+				seen[a.ID+group.role] = true
+				credits = append(credits, models.ArtistCredit{ID: a.ID, Role: group.role})
+				result.Artists = append(result.Artists, a)
+			}
 		}
 	}
 
 	// 2. SINCRONIZAR ÁLBUM
-	// Buscamos si existe este álbum para este artista
-	var albumID string
-	err = db.DB.QueryRow("SELECT id FROM albums WHERE title = $1 AND artist_id = $2", input.AlbumTitle, artistID).Scan(&albumID)
+	album, err := s.upsertAlbum(input, artist.ID)
+	if err != nil {
+		return result, err
+	}
+	result.Album = album
 
-	if err == sql.ErrNoRows {
-		// No existe, lo creamos
-		err = db.DB.QueryRow(`
-			INSERT INTO albums (title, artist_id, cover_url) 
-			VALUES ($1, $2, $3) 
-			RETURNING id`, 
-			input.AlbumTitle, artistID, input.Cover).Scan(&albumID)
-		
+	// 3. SINCRONIZAR TRACK
+	track, err := s.upsertTrack(input, artist.ID, album.ID)
+	if err != nil {
+		return result, err
+	}
+	result.Track = track
+	result.Status = track.Status
+
+	// Artistas de la canción (también completa colaboraciones de canciones ya existentes)
+	for i, a := range credits {
+		_, err = s.tx.Exec(`
+			INSERT INTO track_artists (track_id, artist_id, role, position) VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING`, track.ID, a.ID, a.Role, i)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creando álbum: " + err.Error()})
-			return
+			return result, err
 		}
 	}
+	return result, nil
+}
 
-	// 3. SINCRONIZAR TRACK
-	// Verificamos si la canción ya existe en ese álbum
-	var trackID string
-	err = db.DB.QueryRow("SELECT id FROM tracks WHERE title = $1 AND album_id = $2", input.Title, albumID).Scan(&trackID)
+// upsertArtist reconoce al artista por ID de Deezer o por nombre normalizado
+// ("Bad Bunny" = "bad bunny "); solo actualiza la imagen
+func (s *catalogSync) upsertArtist(name, imageURL, deezerID string) (models.SyncEntity, error) {
+	var e models.SyncEntity
+	name = strings.TrimSpace(name)
+	key := utils.NameKey(name)
+
+	// Dos sincronizaciones del mismo artista con nombres distintos ("Bad Bunny" y
+	// "bad bunny") no chocan en name: se turnan por la clave hasta el commit
+	if _, err := s.tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", key); err != nil {
+		return e, err
+	}
 
+	id, err := findByExternalID(s.tx, "artist", "deezer", deezerID)
 	if err == sql.ErrNoRows {
-		// Insertamos el track nuevo
-		_, err = db.DB.Exec(`
-			INSERT INTO tracks (title, artist_id, album_id, duration_ms, stream_url, cover_url, has_lyrics)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-			input.Title, artistID, albumID, input.Duration, input.StreamUrl, input.Cover, true)
+		err = s.tx.QueryRow("SELECT id FROM artists WHERE name_key = $1", key).Scan(&id)
+	}
+	switch {
+	case err == nil:
+		e, err = s.update(id, `
+			UPDATE artists SET image_url = $2
+			WHERE id = $1 AND $2 <> '' AND image_url IS DISTINCT FROM $2`, imageURL)
+	case err == sql.ErrNoRows:
+		e, err = s.upsert(`
+			INSERT INTO artists (name, name_key, image_url, popularity) VALUES ($1, $3, NULLIF($2, ''), 100)
+			ON CONFLICT (name_key) DO UPDATE SET image_url = EXCLUDED.image_url
+			WHERE EXCLUDED.image_url IS NOT NULL AND artists.image_url IS DISTINCT FROM EXCLUDED.image_url
+			RETURNING id, xmax = 0`,
+			[]interface{}{name, imageURL, key},
+			"SELECT id FROM artists WHERE name_key = $1", key)
+	}
+	if err != nil {
+		return e, err
+	}
 
+	if e.Status == "created" {
+		s.suggestions = append(s.suggestions, models.SearchSuggestion{Type: "artist", ID: e.ID, Title: name, ImageURL: imageURL})
+	}
+	return e, linkExternalID(s.tx, "artist", e.ID, "deezer", deezerID)
+}
+
+// upsertAlbum reconoce el álbum por UPC, ID de Deezer o título dentro del artista
+func (s *catalogSync) upsertAlbum(input models.SyncTrackInput, artistID string) (models.SyncEntity, error) {
+	var e models.SyncEntity
+
+	id, err := findByExternalID(s.tx, "album", "upc", input.UPC)
+	if err == sql.ErrNoRows {
+		id, err = findByExternalID(s.tx, "album", "deezer", input.DeezerAlbumID)
+	}
+	switch {
+	case err == nil:
+		e, err = s.update(id, `
+			UPDATE albums SET cover_url = $2
+			WHERE id = $1 AND $2 <> '' AND cover_url IS DISTINCT FROM $2`, input.Cover)
+	case err == sql.ErrNoRows:
+		e, err = s.upsert(`
+			INSERT INTO albums (title, artist_id, cover_url) VALUES ($1, $2, NULLIF($3, ''))
+			ON CONFLICT (artist_id, title) DO UPDATE SET cover_url = EXCLUDED.cover_url
+			WHERE EXCLUDED.cover_url IS NOT NULL AND albums.cover_url IS DISTINCT FROM EXCLUDED.cover_url
+			RETURNING id, xmax = 0`,
+			[]interface{}{input.AlbumTitle, artistID, input.Cover},
+			"SELECT id FROM albums WHERE title = $1 AND artist_id = $2", input.AlbumTitle, artistID)
+	}
+	if err != nil {
+		return e, err
+	}
+
+	if e.Status == "created" {
+		_, err = s.tx.Exec(`
+			INSERT INTO album_artists (album_id, artist_id, role, position) VALUES ($1, $2, 'primary', 0)
+			ON CONFLICT DO NOTHING`, e.ID, artistID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando track: " + err.Error()})
-			return
+			return e, err
 		}
-		c.JSON(http.StatusCreated, gin.H{"status": "saved", "message": "Canción nueva guardada"})
-	} else {
-		// Ya existía
-		c.JSON(http.StatusOK, gin.H{"status": "existing", "message": "Canción ya existía"})
+		s.suggestions = append(s.suggestions, models.SearchSuggestion{Type: "album", ID: e.ID, Title: input.AlbumTitle, Subtitle: input.ArtistName, ImageURL: input.Cover})
+	}
+	for ns, value := range map[string]string{"upc": input.UPC, "deezer": input.DeezerAlbumID} {
+		if err := linkExternalID(s.tx, "album", e.ID, ns, value); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// trackChanges arma el SET y la condición "cambió algo" para los campos que una
+// sincronización puede actualizar en una canción existente (duración, stream,
+// portada, pista y disco en $n...$n+4). Un valor vacío o cero conserva el que ya teníamos.
+func trackChanges(n int) (set, changed string) {
+	columns := []string{"duration_ms", "stream_url", "cover_url", "track_number", "disc_number"}
+	values := []string{
+		fmt.Sprintf("CASE WHEN $%d > 0 THEN $%d ELSE tracks.duration_ms END", n, n),
+		fmt.Sprintf("COALESCE(NULLIF($%d, ''), tracks.stream_url)", n+1),
+		fmt.Sprintf("COALESCE(NULLIF($%d, ''), tracks.cover_url)", n+2),
+		fmt.Sprintf("COALESCE(NULLIF($%d, 0), tracks.track_number)", n+3),
+		fmt.Sprintf("COALESCE(NULLIF($%d, 0), tracks.disc_number)", n+4),
+	}
+
+	sets := make([]string, len(columns))
+	current := make([]string, len(columns))
+	for i, col := range columns {
+		sets[i] = col + " = " + values[i]
+		current[i] = "tracks." + col
+	}
+	set = strings.Join(sets, ", ")
+	changed = "(" + strings.Join(current, ", ") + ") IS DISTINCT FROM (" + strings.Join(values, ", ") + ")"
+	return set, changed
+}
+
+// upsertTrack reconoce la canción por ISRC, ID de Deezer o título dentro del álbum
+// y actualiza duración, stream, portada y posición en el álbum si cambiaron
+func (s *catalogSync) upsertTrack(input models.SyncTrackInput, artistID, albumID string) (models.SyncEntity, error) {
+	var e models.SyncEntity
+
+	// El ISRC identifica la grabación aunque cambie el título
+	id, err := findByExternalID(s.tx, "track", "isrc", input.ISRC)
+	if err == sql.ErrNoRows {
+		id, err = findByExternalID(s.tx, "track", "deezer", input.DeezerID)
+	}
+	switch {
+	case err == nil:
+		// El proveedor pudo renombrarla (salvo que choque con otra canción del álbum)
+		// RETURNING title: la sugerencia lleva el título que quedó guardado
+		set, changed := trackChanges(3)
+		var title string
+		e = models.SyncEntity{ID: id, Status: "updated"}
+		err = s.tx.QueryRow(`
+			UPDATE tracks SET `+set+`,
+			       title = CASE WHEN EXISTS (
+			           SELECT 1 FROM tracks o WHERE o.album_id = tracks.album_id AND o.title = $2 AND o.id <> tracks.id
+			       ) THEN tracks.title ELSE $2 END
+			WHERE id = $1 AND (`+changed+` OR tracks.title <> $2)
+			RETURNING title`,
+			id, input.Title, input.Duration, input.StreamUrl, input.Cover, input.TrackNumber, input.DiscNumber).Scan(&title)
+		switch err {
+		case nil:
+			s.suggestions = append(s.suggestions, models.SearchSuggestion{Type: "track", ID: e.ID, Title: title, Subtitle: input.ArtistName, ImageURL: input.Cover})
+		case sql.ErrNoRows:
+			e.Status, err = "unchanged", nil
+		}
+	case err == sql.ErrNoRows:
+		// Sin letra hasta que alguien la importe o el fetcher la encuentre
+		set, changed := trackChanges(4)
+		e, err = s.upsert(`
+			INSERT INTO tracks (title, album_id, artist_id, duration_ms, stream_url, cover_url,
+			                    track_number, disc_number, has_lyrics)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0), NULLIF($8, 0), false)
+			ON CONFLICT (album_id, title) DO UPDATE SET `+set+`
+			WHERE `+changed+`
+			RETURNING id, xmax = 0`,
+			[]interface{}{input.Title, albumID, artistID, input.Duration, input.StreamUrl, input.Cover,
+				input.TrackNumber, input.DiscNumber},
+			"SELECT id FROM tracks WHERE title = $1 AND album_id = $2", input.Title, albumID)
+		if err == nil && e.Status == "created" {
+			s.suggestions = append(s.suggestions, models.SearchSuggestion{Type: "track", ID: e.ID, Title: input.Title, Subtitle: input.ArtistName, ImageURL: input.Cover})
+			s.newTracks = append(s.newTracks, e.ID)
+		}
+	}
+	if err != nil {
+		return e, err
+	}
+
+	for ns, value := range map[string]string{"isrc": input.ISRC, "deezer": input.DeezerID} {
+		if err := linkExternalID(s.tx, "track", e.ID, ns, value); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// upsert corre un INSERT ... ON CONFLICT DO UPDATE ... WHERE ... RETURNING id, xmax = 0
+// (xmax = 0 solo en filas recién insertadas). Si no devolvió fila es que ya existía
+// sin cambios y la buscamos con selectQuery.
+func (s *catalogSync) upsert(insertQuery string, insertArgs []interface{}, selectQuery string, selectArgs ...interface{}) (models.SyncEntity, error) {
+	e := models.SyncEntity{Status: "updated"}
+	var inserted bool
+	err := s.tx.QueryRow(insertQuery, insertArgs...).Scan(&e.ID, &inserted)
+	if err == sql.ErrNoRows {
+		e.Status = "unchanged"
+		err = s.tx.QueryRow(selectQuery, selectArgs...).Scan(&e.ID)
+	} else if inserted {
+		e.Status = "created"
+	}
+	return e, err
+}
+
+// update corre un UPDATE sobre una entidad ya reconocida ($1 es su id)
+func (s *catalogSync) update(id, query string, args ...interface{}) (models.SyncEntity, error) {
+	e := models.SyncEntity{ID: id, Status: "unchanged"}
+	res, err := s.tx.Exec(query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return e, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		e.Status = "updated"
+	}
+	return e, nil
+}
+
+// featRe separa "A feat. B", "A ft. B", "A featuring B", "Canción (feat. B)" y
+// "Canción (con B)" ("con" solo entre paréntesis: "Bailando con lobos" es un título)
+var featRe = regexp.MustCompile(`(?i)\s*(?:[(\[]\s*\b(?:feat\.?|ft\.|featuring|con)|\b(?:feat\.?|ft\.|featuring))\s+`)
+
+// guestSepRe separa la lista de invitados: "B, C & D", "B y C", "B x C"
+var guestSepRe = regexp.MustCompile(`(?i)\s*,\s*|\s+(?:&|y|and|x)\s+`)
+
+// Grupos con un separador en el nombre: no se parten aunque vengan como invitados.
+// Se comparan con utils.NameKey ("&" = "and").
+var groupNames = map[string]bool{}
+
+func init() {
+	for _, name := range []string{
+		"Simon & Garfunkel", "Hall & Oates", "Earth, Wind & Fire", "Crosby, Stills & Nash",
+		"Crosby, Stills, Nash & Young", "Mumford & Sons", "Sam & Dave", "Brooks & Dunn",
+		"Zion & Lennox", "Wisin & Yandel", "Jesse & Joy", "Chino & Nacho", "Chino y Nacho",
+		"Alexis & Fido", "Alexis y Fido", "Angel & Khriz", "Angel y Khriz", "Jowell & Randy",
+		"Jowell y Randy", "Héctor & Tito", "Héctor y Tito", "Magnate & Valentino", "Magnate y Valentino",
+		"Baby Rasta & Gringo", "Baby Rasta y Gringo", "Mau y Ricky", "Dyland & Lenny",
+	} {
+		groupNames[utils.NameKey(name)] = true
+	}
+}
+
+// splitFeaturing devuelve la parte principal y los artistas invitados
+func splitFeaturing(s string) (string, []string) {
+	loc := featRe.FindStringIndex(s)
+	if loc == nil {
+		return strings.TrimSpace(s), nil
+	}
+
+	main := strings.TrimSpace(s[:loc[0]])
+	rest := s[loc[1]:]
+	if end := strings.IndexAny(rest, ")]"); end >= 0 {
+		rest = rest[:end]
+	}
+	return main, splitGuests(rest)
+}
+
+// splitGuests parte la lista de invitados por sus separadores, salvo donde el
+// tramo completo es un grupo conocido ("Simon & Garfunkel")
+func splitGuests(rest string) []string {
+	seps := guestSepRe.FindAllStringIndex(rest, -1)
+	// Tramos entre separadores: bounds[i] es el inicio del tramo i y ends[i] su fin
+	bounds := []int{0}
+	ends := []int{}
+	for _, sep := range seps {
+		ends = append(ends, sep[0])
+		bounds = append(bounds, sep[1])
+	}
+	ends = append(ends, len(rest))
+
+	var guests []string
+	for i := 0; i < len(bounds); {
+		// El tramo más largo desde i que sea un grupo conocido; si no, solo el i
+		j := i
+		for k := len(bounds) - 1; k > i; k-- {
+			if groupNames[utils.NameKey(rest[bounds[i]:ends[k]])] {
+				j = k
+				break
+			}
+		}
+		if name := strings.TrimSpace(rest[bounds[i]:ends[j]]); name != "" {
+			guests = append(guests, name)
+		}
+		i = j + 1
 	}
-}
\ No newline at end of file
+	return guests
+}
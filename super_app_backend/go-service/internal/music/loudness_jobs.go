@@ -0,0 +1,184 @@
+package music
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/loudness"
+)
+
+const (
+	loudnessQueueSize = 500
+	// Decodificar un álbum entero puede tardar
+	loudnessTimeout = 20 * time.Minute
+)
+
+var loudnessQueue = make(chan string, loudnessQueueSize)
+
+// StartLoudnessAnalyzer lanza los workers que miden la sonoridad de las
+// canciones con master propio y encola las que aún no se midieron.
+// Necesita StartTranscoder (usa su almacenamiento y su ffmpeg).
+func StartLoudnessAnalyzer(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for trackID := range loudnessQueue {
+				if err := analyzeLoudness(trackID); err != nil {
+					log.Printf("⚠️  Sonoridad de %s: %v\n", trackID, err)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		rows, err := db.DB.Query(`
+			SELECT DISTINCT ON (COALESCE(t.album_id, t.id)) t.id
+			FROM tracks t
+			WHERE t.loudness_analyzed_at IS NULL
+			  AND EXISTS (SELECT 1 FROM transcode_jobs j WHERE j.track_id = t.id AND j.status = 'done')`)
+		if err != nil {
+			log.Printf("⚠️  No se pudieron buscar canciones sin analizar: %v\n", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if rows.Scan(&id) == nil {
+				loudnessQueue <- id
+			}
+		}
+	}()
+}
+
+// EnqueueLoudnessAnalysis pide medir una canción (y con ella su álbum)
+func EnqueueLoudnessAnalysis(trackID string) {
+	select {
+	case loudnessQueue <- trackID:
+	default:
+		log.Printf("⚠️  Cola de sonoridad llena, se descarta %s\n", trackID)
+	}
+}
+
+// loudnessTrack es una canción a medir con el master de su último trabajo
+type loudnessTrack struct {
+	id, masterKey string
+	analyzed      bool // Ya medida después de ese trabajo
+}
+
+// analyzeLoudness mide una canción y, si tiene álbum, todas las del álbum: la
+// sonoridad de álbum necesita los bloques de todas juntas
+func analyzeLoudness(trackID string) error {
+	var albumID sql.NullString
+	if err := db.DB.QueryRow("SELECT album_id FROM tracks WHERE id = $1", trackID).Scan(&albumID); err != nil {
+		return err
+	}
+
+	query := `
+		SELECT t.id, COALESCE(j.master_key, ''),
+		       j.finished_at IS NOT NULL AND t.loudness_analyzed_at >= j.finished_at
+		FROM tracks t
+		LEFT JOIN LATERAL (
+			SELECT master_key, finished_at FROM transcode_jobs
+			WHERE track_id = t.id AND status = 'done'
+			ORDER BY finished_at DESC LIMIT 1
+		) j ON true`
+	var rows *sql.Rows
+	var err error
+	if albumID.Valid {
+		rows, err = db.DB.Query(query+" WHERE t.album_id = $1 ORDER BY t.disc_number, t.track_number", albumID.String)
+	} else {
+		rows, err = db.DB.Query(query+" WHERE t.id = $1", trackID)
+	}
+	if err != nil {
+		return err
+	}
+	var tracks []loudnessTrack
+	complete, pending := true, false
+	for rows.Next() {
+		var t loudnessTrack
+		if err := rows.Scan(&t.id, &t.masterKey, &t.analyzed); err != nil {
+			rows.Close()
+			return err
+		}
+		if t.masterKey == "" {
+			complete = false // Sin master no hay valores de álbum
+			continue
+		}
+		pending = pending || !t.analyzed
+		tracks = append(tracks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !pending {
+		return nil // Otro trabajo del mismo álbum ya lo dejó al día
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), loudnessTimeout)
+	defer cancel()
+	workDir, err := os.MkdirTemp("", "loudness-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	album := loudness.NewMeter(2)
+	meters := make([]*loudness.Meter, len(tracks))
+	for i, t := range tracks {
+		master, err := localMaster(ctx, t.masterKey, workDir)
+		if err != nil {
+			return fmt.Errorf("%s: no se pudo leer el master: %w", t.id, err)
+		}
+		meters[i] = loudness.NewMeter(2)
+		if err := transcodeEncoder.DecodePCM(ctx, master, loudness.SampleRate, 2, meters[i]); err != nil {
+			return fmt.Errorf("%s: %w", t.id, err)
+		}
+		album.Add(meters[i])
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, t := range tracks {
+		lufs, peak, gain := loudnessValues(meters[i])
+		_, err := tx.Exec(`
+			UPDATE tracks SET loudness_lufs = $2, true_peak_dbtp = $3, gain_db = $4, loudness_analyzed_at = NOW()
+			WHERE id = $1`, t.id, lufs, peak, gain)
+		if err != nil {
+			return err
+		}
+	}
+	if albumID.Valid {
+		var lufs, peak, gain sql.NullFloat64
+		if complete {
+			lufs, peak, gain = loudnessValues(album)
+		}
+		_, err := tx.Exec("UPDATE albums SET loudness_lufs = $2, true_peak_dbtp = $3, gain_db = $4 WHERE id = $1",
+			albumID.String, lufs, peak, gain)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// loudnessValues pasa una medición a columnas; el silencio queda en NULL
+func loudnessValues(m *loudness.Meter) (lufs, peak, gain sql.NullFloat64) {
+	integrated, truePeak := m.Integrated(), m.TruePeak()
+	if math.IsInf(integrated, -1) {
+		return
+	}
+	lufs = sql.NullFloat64{Float64: integrated, Valid: true}
+	peak = sql.NullFloat64{Float64: truePeak, Valid: !math.IsInf(truePeak, -1)}
+	gain = sql.NullFloat64{Float64: loudness.Gain(integrated), Valid: true}
+	return
+}
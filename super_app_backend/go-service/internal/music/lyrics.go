@@ -0,0 +1,564 @@
+package music
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/auth"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/lyrics"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+// Tamaño máximo aceptado para un archivo de letras
+const maxLyricsBody = 1 << 20
+
+// GetLyrics (Endpoint 3.3)
+// GET /music/tracks/:id/lyrics             -> JSON [{time_ms, text}] (clientes antiguos)
+// GET /music/tracks/:id/lyrics?v=2         -> JSON con finales de línea y palabras
+// GET /music/tracks/:id/lyrics?format=lrc  -> archivo LRC
+// GET /music/tracks/:id/lyrics?format=elrc -> archivo LRC mejorado (<mm:ss.xx> por palabra)
+// Todas aceptan ?lang=en (traducción) o ?lang=ja-Latn (romanización) con los tiempos del original.
+func GetLyrics(c *gin.Context) {
+	trackID := c.Param("id")
+	if !validID(c, trackID) {
+		return
+	}
+	lang := c.Query("lang")
+
+	doc, err := loadLyricsDocument(db.DB, trackID, lang)
+	if err == errVariantNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No hay letra en el idioma " + lang})
+		return
+	} else if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error buscando letras"})
+		return
+	}
+
+	if format := c.Query("format"); format == "lrc" || format == "elrc" {
+		if doc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Esta canción no tiene letra"})
+			return
+		}
+
+		body := doc.FormatLRC()
+		if format == "elrc" {
+			body = doc.FormatEnhancedLRC()
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+trackID+`.lrc"`)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(body))
+		return
+	}
+
+	if c.Query("v") == "2" {
+		getLyricsV2(c, trackID, doc)
+		return
+	}
+
+	// Si no hay letras, devolvemos array vacío (no 404)
+	lines := []models.LyricLine{}
+	if doc != nil {
+		for _, l := range doc.Lines {
+			lines = append(lines, models.LyricLine{TimeMs: l.TimeMs, Text: l.Text})
+		}
+	}
+	c.JSON(http.StatusOK, lines)
+}
+
+// ListLyricsVariants devuelve las letras disponibles de una canción (original, traducciones, romanizaciones)
+// GET /music/tracks/:id/lyrics/variants
+func ListLyricsVariants(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	rows, err := db.DB.Query(`
+		SELECT s.kind, s.language, s.synced, s.source, s.updated_at,
+		       CASE WHEN s.kind = 'original'
+		            THEN (SELECT COUNT(*) FROM lyrics WHERE lyric_set_id = s.id)
+		            ELSE (SELECT COUNT(*) FROM lyric_variant_lines WHERE lyric_set_id = s.id) END,
+		       u.id, u.username
+		FROM lyric_sets s
+		LEFT JOIN users u ON u.id = s.contributed_by
+		WHERE s.track_id = $1::uuid
+		ORDER BY (s.kind = 'original') DESC, s.kind, s.language`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error buscando letras"})
+		return
+	}
+	defer rows.Close()
+
+	variants := []models.LyricsVariant{}
+	for rows.Next() {
+		var v models.LyricsVariant
+		var userID, username sql.NullString
+		if err := rows.Scan(&v.Kind, &v.Language, &v.Synced, &v.Source, &v.UpdatedAt, &v.Lines, &userID, &username); err != nil {
+			continue
+		}
+		if userID.Valid {
+			v.Contributor = &models.UserRef{ID: userID.String, Username: username.String}
+		}
+		variants = append(variants, v)
+	}
+
+	c.JSON(http.StatusOK, variants)
+}
+
+// ImportLyrics reemplaza la letra de una canción con un LRC o texto plano (solo curadores)
+// PUT /music/tracks/:id/lyrics?format=lrc|text|ttml (LRC admite marcas <mm:ss.xx> por palabra)
+// Para variantes: ?kind=translation&lang=en o ?kind=romanization&lang=ja-Latn
+func ImportLyrics(c *gin.Context) {
+	trackID := c.Param("id")
+	if !validID(c, trackID) {
+		return
+	}
+	kind := c.DefaultQuery("kind", "original")
+	lang := c.Query("lang")
+
+	if !lyricKinds[kind] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de letra inválido: " + kind})
+		return
+	}
+	if kind != "original" && lang == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Las traducciones y romanizaciones necesitan ?lang="})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLyricsBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer la letra"})
+		return
+	}
+
+	// También aceptamos JSON: {"lyrics": "...", "format": "lrc"}
+	raw, format := string(body), c.Query("format")
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		var input struct {
+			Lyrics string `json:"lyrics"`
+			Format string `json:"format"`
+		}
+		if err := json.Unmarshal(body, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "JSON inválido"})
+			return
+		}
+		raw = input.Lyrics
+		if input.Format != "" {
+			format = input.Format
+		}
+	}
+
+	doc, err := parseLyricsInput(raw, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Letra inválida: " + err.Error()})
+		return
+	}
+	if kind == "original" && lang == "" {
+		lang = doc.Tags["la"] // [la:] del LRC o xml:lang del TTML
+	}
+
+	// Lo que importa un curador se publica directamente, pero queda en el historial
+	r := newRevision(db.DB, trackID, kind, lang, doc)
+	r.Status = "approved"
+	r.Source = "curator"
+	r.SubmittedBy = auth.CurrentUserID(c)
+	r.ReviewedBy = r.SubmittedBy
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error del servidor"})
+		return
+	}
+	defer tx.Rollback()
+
+	revisionID, err := insertRevision(tx, r)
+	if err == nil {
+		err = publishLyrics(tx, r, revisionID, "", doc)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
+		return
+	} else if errors.Is(err, errBadVariant) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Printf("⚠️  Letras de %s: %v\n", trackID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando letras"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando letras"})
+		return
+	}
+
+	words := 0
+	for _, l := range doc.Lines {
+		words += len(l.Words)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "saved",
+		"revision_id": revisionID,
+		"kind":     kind,
+		"language": lang,
+		"lines":    len(doc.Lines),
+		"words":    words,
+		"synced":   doc.Synced,
+		"tags":     doc.Tags,
+	})
+}
+
+// parseLyricsInput interpreta la letra según el formato (si no viene, lo deducimos)
+func parseLyricsInput(raw, format string) (*lyrics.Document, error) {
+	if format == "" && strings.HasPrefix(strings.TrimSpace(raw), "<") {
+		format = "ttml"
+	}
+
+	switch format {
+	case "text":
+		return lyrics.ParsePlain(raw)
+	case "ttml":
+		return lyrics.ParseTTML(raw)
+	default:
+		return lyrics.Parse(raw)
+	}
+}
+
+var lyricKinds = map[string]bool{"original": true, "translation": true, "romanization": true}
+
+var (
+	errBadVariant      = errors.New("variante de letra inválida")
+	errVariantNotFound = errors.New("variante de letra no encontrada")
+)
+
+// replaceLyrics guarda la letra completa de una canción dentro de la transacción.
+// El original actualiza tracks.has_lyrics; las variantes se alinean línea a línea
+// con el original. Devuelve sql.ErrNoRows si la canción no existe.
+func replaceLyrics(tx *sql.Tx, trackID, kind, lang string, doc *lyrics.Document) error {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM tracks WHERE id = $1::uuid)", trackID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	if kind != "original" {
+		return replaceLyricsVariant(tx, trackID, kind, lang, doc)
+	}
+
+	tags, err := json.Marshal(doc.Tags)
+	if err != nil {
+		return err
+	}
+
+	var setID string
+	err = tx.QueryRow(`
+		INSERT INTO lyric_sets (track_id, kind, language, synced, tags, offset_ms) VALUES ($1, 'original', $2, $3, $4, $5)
+		ON CONFLICT (track_id) WHERE kind = 'original' DO UPDATE
+		SET language = COALESCE(NULLIF(EXCLUDED.language, ''), lyric_sets.language),
+		    synced = EXCLUDED.synced, tags = EXCLUDED.tags, offset_ms = EXCLUDED.offset_ms, updated_at = CURRENT_TIMESTAMP
+		RETURNING id`, trackID, lang, doc.Synced, tags, doc.Offset).Scan(&setID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM lyrics WHERE lyric_set_id = $1", setID); err != nil {
+		return err
+	}
+
+	lineStmt, err := tx.Prepare(`
+		INSERT INTO lyrics (track_id, lyric_set_id, time_ms, end_ms, text, search_text, line_no)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7) RETURNING id`)
+	if err != nil {
+		return err
+	}
+	defer lineStmt.Close()
+
+	wordStmt, err := tx.Prepare("INSERT INTO lyric_words (lyric_id, position, start_ms, end_ms, text) VALUES ($1, $2, $3, NULLIF($4, 0), $5)")
+	if err != nil {
+		return err
+	}
+	defer wordStmt.Close()
+
+	for i, l := range doc.Lines {
+		var lineID string
+		if err := lineStmt.QueryRow(trackID, setID, l.TimeMs, l.EndMs, l.Text, utils.SearchText(l.Text), i).Scan(&lineID); err != nil {
+			return err
+		}
+		for j, w := range l.Words {
+			if _, err := wordStmt.Exec(lineID, j, w.StartMs, w.EndMs, w.Text); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec("UPDATE tracks SET has_lyrics = $2 WHERE id = $1", trackID, len(doc.Lines) > 0)
+	return err
+}
+
+type originalLine struct{ lineNo, timeMs int }
+
+// replaceLyricsVariant guarda una traducción o romanización en
+// lyric_variant_lines. Cada línea se asocia a una línea distinta del original
+// (mismo line_no) y hereda sus tiempos: por posición si la variante es texto
+// plano, o con alignVariant si trae marcas.
+func replaceLyricsVariant(tx *sql.Tx, trackID, kind, lang string, doc *lyrics.Document) error {
+	var originalSetID, originalLang string
+	err := tx.QueryRow("SELECT id, language FROM lyric_sets WHERE track_id = $1::uuid AND kind = 'original'", trackID).
+		Scan(&originalSetID, &originalLang)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: la canción todavía no tiene letra original", errBadVariant)
+	} else if err != nil {
+		return err
+	}
+	if kind == "translation" && originalLang != "" && strings.EqualFold(originalLang, lang) {
+		return fmt.Errorf("%w: el original ya está en %s", errBadVariant, lang)
+	}
+
+	var original []originalLine
+	rows, err := tx.Query("SELECT line_no, time_ms FROM lyrics WHERE lyric_set_id = $1 ORDER BY time_ms, line_no", originalSetID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var o originalLine
+		if err := rows.Scan(&o.lineNo, &o.timeMs); err != nil {
+			rows.Close()
+			return err
+		}
+		original = append(original, o)
+	}
+	rows.Close()
+	if len(original) == 0 {
+		return fmt.Errorf("%w: la letra original está vacía", errBadVariant)
+	}
+
+	// Emparejamos cada línea de la variante con una del original
+	aligned := make([]originalLine, len(doc.Lines))
+	if doc.Synced {
+		if len(doc.Lines) > len(original) {
+			return fmt.Errorf("%w: la variante tiene %d líneas y el original solo %d", errBadVariant, len(doc.Lines), len(original))
+		}
+		aligned = alignVariant(original, doc.Lines)
+	} else {
+		if len(doc.Lines) != len(original) {
+			return fmt.Errorf("%w: la variante tiene %d líneas y el original %d", errBadVariant, len(doc.Lines), len(original))
+		}
+		copy(aligned, original)
+	}
+
+	var setID string
+	err = tx.QueryRow(`
+		INSERT INTO lyric_sets (track_id, kind, language, synced, tags) VALUES ($1, $2, $3, $4, '{}')
+		ON CONFLICT (track_id, kind, language) DO UPDATE
+		SET synced = EXCLUDED.synced, updated_at = CURRENT_TIMESTAMP
+		RETURNING id`, trackID, kind, lang, doc.Synced).Scan(&setID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM lyric_variant_lines WHERE lyric_set_id = $1", setID); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO lyric_variant_lines (lyric_set_id, line_no, text, search_text) VALUES ($1, $2, $3, $4)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, l := range doc.Lines {
+		if _, err := stmt.Exec(setID, aligned[i].lineNo, l.Text, utils.SearchText(l.Text)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alignVariant empareja las líneas con tiempo de una variante con las del
+// original (ordenadas por tiempo): cada línea original recibe a lo sumo una,
+// se respeta el orden de ambas y se minimiza la suma de las distancias en
+// tiempo. Requiere len(lines) <= len(original).
+func alignVariant(original []originalLine, lines []lyrics.Line) []originalLine {
+	// Las líneas de la variante en orden de tiempo (el parser ya las ordena,
+	// pero no dependemos de eso)
+	order := make([]int, len(lines))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return lines[order[a]].TimeMs < lines[order[b]].TimeMs })
+
+	// cost[i][j]: mejor suma con las primeras i líneas de la variante puestas
+	// en las primeras j del original
+	n, m := len(lines), len(original)
+	const unreachable = math.MaxInt64 / 2
+	cost := make([][]int64, n+1)
+	for i := range cost {
+		cost[i] = make([]int64, m+1)
+		for j := range cost[i] {
+			if i > j {
+				cost[i][j] = unreachable
+			}
+		}
+	}
+	for i := 1; i <= n; i++ {
+		for j := i; j <= m; j++ {
+			d := int64(lines[order[i-1]].TimeMs - original[j-1].timeMs)
+			if d < 0 {
+				d = -d
+			}
+			cost[i][j] = min(cost[i][j-1], cost[i-1][j-1]+d)
+		}
+	}
+
+	aligned := make([]originalLine, n)
+	for i, j := n, m; i > 0; j-- {
+		if cost[i][j] != cost[i][j-1] || j == i {
+			aligned[order[i-1]] = original[j-1]
+			i--
+		}
+	}
+	return aligned
+}
+
+// loadLyricsDocument reconstruye la letra guardada (con sus metadatos). Con lang
+// distinto del idioma original devuelve la variante en ese idioma, con los tiempos
+// del original (sin palabras).
+func loadLyricsDocument(q querier, trackID, lang string) (*lyrics.Document, error) {
+	doc := &lyrics.Document{Tags: map[string]string{}}
+
+	var setID, originalLang string
+	var tags []byte
+	err := q.QueryRow(`
+		SELECT id, synced, tags, offset_ms, language FROM lyric_sets
+		WHERE track_id = $1::uuid AND kind = 'original'`, trackID).
+		Scan(&setID, &doc.Synced, &tags, &doc.Offset, &originalLang)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal(tags, &doc.Tags)
+	if _, ok := doc.Tags["la"]; !ok && originalLang != "" {
+		doc.Tags["la"] = originalLang
+	}
+
+	rows, err := q.Query(`
+		SELECT l.id, l.line_no, l.time_ms, COALESCE(l.end_ms, 0), l.text, w.start_ms, COALESCE(w.end_ms, 0), w.text
+		FROM lyrics l
+		LEFT JOIN lyric_words w ON w.lyric_id = l.id
+		WHERE l.lyric_set_id = $1
+		ORDER BY l.time_ms ASC, l.line_no ASC, w.position ASC`, setID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lineNos []int
+	lastID := ""
+	for rows.Next() {
+		var id string
+		var lineNo int
+		var l lyrics.Line
+		var wordStart, wordEnd sql.NullInt64
+		var wordText sql.NullString
+		if err := rows.Scan(&id, &lineNo, &l.TimeMs, &l.EndMs, &l.Text, &wordStart, &wordEnd, &wordText); err != nil {
+			continue
+		}
+
+		if id != lastID {
+			doc.Lines = append(doc.Lines, l)
+			lineNos = append(lineNos, lineNo)
+			lastID = id
+		}
+		if wordStart.Valid {
+			cur := &doc.Lines[len(doc.Lines)-1]
+			cur.Words = append(cur.Words, lyrics.Word{StartMs: int(wordStart.Int64), EndMs: int(wordEnd.Int64), Text: wordText.String})
+		}
+	}
+
+	if len(doc.Lines) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if lang == "" || strings.EqualFold(lang, originalLang) {
+		return doc, nil
+	}
+
+	// Variante: mismo esqueleto de tiempos, texto traducido/romanizado
+	var variantSetID string
+	err = q.QueryRow(`
+		SELECT id FROM lyric_sets
+		WHERE track_id = $1::uuid AND kind <> 'original' AND LOWER(language) = LOWER($2)
+		ORDER BY kind DESC LIMIT 1`, trackID, lang).Scan(&variantSetID)
+	if err == sql.ErrNoRows {
+		return nil, errVariantNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	variantRows, err := q.Query("SELECT line_no, text FROM lyric_variant_lines WHERE lyric_set_id = $1", variantSetID)
+	if err != nil {
+		return nil, err
+	}
+	defer variantRows.Close()
+
+	texts := map[int]string{}
+	for variantRows.Next() {
+		var lineNo int
+		var text string
+		if err := variantRows.Scan(&lineNo, &text); err != nil {
+			continue
+		}
+		texts[lineNo] = text
+	}
+
+	doc.Tags["la"] = lang
+	for i := range doc.Lines {
+		// Las líneas sin traducir (p. ej. "♪") se quedan con el texto original
+		if text, ok := texts[lineNos[i]]; ok {
+			doc.Lines[i].Text = text
+		}
+		doc.Lines[i].Words = nil
+	}
+	return doc, nil
+}
+
+// getLyricsV2 responde con la estructura enriquecida (finales de línea y palabras)
+func getLyricsV2(c *gin.Context, trackID string, doc *lyrics.Document) {
+	resp := models.LyricsV2{Version: 2, TrackID: trackID, Lines: []models.LyricLineV2{}}
+
+	// Igual que v1: sin letra no es un error
+	if doc == nil {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	resp.Synced = doc.Synced
+	resp.Language = doc.Tags["la"]
+	for _, l := range doc.Lines {
+		line := models.LyricLineV2{TimeMs: l.TimeMs, EndMs: optionalMs(l.EndMs), Text: l.Text, Words: []models.LyricWord{}}
+		for _, w := range l.Words {
+			line.Words = append(line.Words, models.LyricWord{StartMs: w.StartMs, EndMs: optionalMs(w.EndMs), Text: w.Text})
+			resp.WordSynced = true
+		}
+		resp.Lines = append(resp.Lines, line)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// optionalMs convierte el 0 ("no se sabe") en null para el JSON
+func optionalMs(ms int) *int {
+	if ms <= 0 {
+		return nil
+	}
+	return &ms
+}
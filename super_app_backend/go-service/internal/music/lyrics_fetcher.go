@@ -0,0 +1,228 @@
+package music
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/lyrics"
+)
+
+const (
+	lyricsQueueSize    = 500
+	lyricsFetchTimeout = 15 * time.Second
+	// Tras un "no encontrado" esperamos 7 días por intento (máximo 30)
+	lyricsMissBackoff = 7 * 24 * time.Hour
+	lyricsMissMax     = 30 * 24 * time.Hour
+	// Si el proveedor falló (red, 5xx) reintentamos pronto
+	lyricsErrorBackoff = time.Hour
+	// Cada cuánto se buscan canciones sin letra (las de antes del fetcher, los
+	// fallos con retry_after vencido y lo que se perdió en un reinicio)
+	lyricsSweepInterval = time.Hour
+	lyricsSweepBatch    = 200
+)
+
+var (
+	lyricsProvider lyrics.Provider
+	lyricsQueue    = make(chan string, lyricsQueueSize)
+)
+
+// StartLyricsFetcher lanza los workers que buscan letras en segundo plano y
+// el barrido periódico que les pasa las canciones pendientes
+func StartLyricsFetcher(p lyrics.Provider, workers int) {
+	lyricsProvider = p
+	for i := 0; i < workers; i++ {
+		go func() {
+			for trackID := range lyricsQueue {
+				if err := fetchLyrics(trackID); err != nil {
+					log.Printf("⚠️  Letras de %s: %v\n", trackID, err)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for {
+			if err := sweepLyrics(); err != nil {
+				log.Printf("⚠️  No se pudieron buscar canciones sin letra: %v\n", err)
+			}
+			time.Sleep(lyricsSweepInterval)
+		}
+	}()
+}
+
+// sweepLyrics encola canciones sin letra original cuyo último fallo (si lo
+// hubo) ya venció; primero las que nunca se intentaron. Espera a que haya
+// sitio en la cola: no compite con las canciones recién creadas.
+func sweepLyrics() error {
+	rows, err := db.DB.Query(`
+		SELECT t.id FROM tracks t
+		LEFT JOIN lyrics_fetch_misses m ON m.track_id = t.id
+		WHERE NOT EXISTS (SELECT 1 FROM lyric_sets ls WHERE ls.track_id = t.id AND ls.kind = 'original')
+		  AND (m.track_id IS NULL OR m.retry_after <= NOW())
+		ORDER BY m.retry_after NULLS FIRST, t.id
+		LIMIT $1`, lyricsSweepBatch)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		lyricsQueue <- id
+	}
+	return nil
+}
+
+// EnqueueLyricsFetch pide buscar la letra de una canción sin bloquear la petición
+func EnqueueLyricsFetch(trackID string) {
+	if lyricsProvider == nil {
+		return
+	}
+	select {
+	case lyricsQueue <- trackID:
+	default:
+		log.Printf("⚠️  Cola de letras llena, se descarta %s\n", trackID)
+	}
+}
+
+// fetchLyrics descarga y guarda la letra original de una canción si aún no la tiene
+func fetchLyrics(trackID string) error {
+	var hasLyrics, cachedMiss bool
+	err := db.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM lyric_sets WHERE track_id = $1 AND kind = 'original'),
+		       EXISTS (SELECT 1 FROM lyrics_fetch_misses WHERE track_id = $1 AND retry_after > NOW())`, trackID).
+		Scan(&hasLyrics, &cachedMiss)
+	if err != nil || hasLyrics || cachedMiss {
+		return err
+	}
+
+	var q lyrics.Query
+	err = db.DB.QueryRow(`
+		SELECT t.title, COALESCE(ar.name, ''), COALESCE(al.title, ''), t.duration_ms
+		FROM tracks t
+		LEFT JOIN artists ar ON ar.id = t.artist_id
+		LEFT JOIN albums al ON al.id = t.album_id
+		WHERE t.id = $1`, trackID).Scan(&q.TrackName, &q.ArtistName, &q.AlbumName, &q.DurationMs)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lyricsFetchTimeout)
+	defer cancel()
+
+	result, err := lyricsProvider.Fetch(ctx, q)
+	doc, reason := lyricsFetchOutcome(result, err)
+	if reason != "" {
+		if missErr := recordLyricsMiss(trackID, reason); missErr != nil {
+			log.Printf("⚠️  No se pudo registrar la falta de letra de %s: %v\n", trackID, missErr)
+		}
+		// Un fallo del proveedor se informa; que no haya letra no es un error
+		if reason == "error" {
+			return err
+		}
+		return nil
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Otro proceso (o un curador) pudo guardar una letra mientras consultábamos
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM lyric_sets WHERE track_id = $1 AND kind = 'original')", trackID).Scan(&hasLyrics); err != nil || hasLyrics {
+		return err
+	}
+	r := newRevision(tx, trackID, "original", "", doc)
+	r.Status = "approved"
+	r.Source = lyricsProvider.Name()
+	revisionID, err := insertRevision(tx, r)
+	if err != nil {
+		return err
+	}
+	if err := publishLyrics(tx, r, revisionID, result.SourceID, doc); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM lyrics_fetch_misses WHERE track_id = $1", trackID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lyricsFetchOutcome interpreta la respuesta del proveedor: la letra lista
+// para guardar, o el motivo para la caché negativa ("not_found",
+// "instrumental" o "error")
+func lyricsFetchOutcome(result *lyrics.Result, err error) (*lyrics.Document, string) {
+	if errors.Is(err, lyrics.ErrNotFound) {
+		return nil, "not_found"
+	} else if err != nil {
+		return nil, "error"
+	}
+	if result.Instrumental {
+		return nil, "instrumental"
+	}
+	doc, err := result.Document()
+	if err != nil {
+		return nil, "not_found"
+	}
+	return doc, ""
+}
+
+// lyricsBackoff es cuánto esperar antes de volver a preguntar tras el intento
+// número attempts (empieza en 1) que terminó con reason
+func lyricsBackoff(reason string, attempts int) time.Duration {
+	backoff := lyricsErrorBackoff
+	switch reason {
+	case "not_found":
+		backoff = time.Duration(attempts) * lyricsMissBackoff
+	case "instrumental":
+		backoff = lyricsMissMax
+	}
+	return min(backoff, lyricsMissMax)
+}
+
+// recordLyricsMiss guarda en la caché negativa cuándo volver a intentarlo.
+// retry_after se calcula en SQL para que compare bien con NOW() en cualquier
+// zona horaria de la sesión.
+func recordLyricsMiss(trackID, reason string) error {
+	var attempts int
+	err := db.DB.QueryRow("SELECT attempts FROM lyrics_fetch_misses WHERE track_id = $1", trackID).Scan(&attempts)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	attempts++
+
+	_, err = db.DB.Exec(`
+		INSERT INTO lyrics_fetch_misses (track_id, provider, reason, attempts, last_checked_at, retry_after)
+		VALUES ($1, $2, $3, $4, NOW(), NOW() + $5 * INTERVAL '1 second')
+		ON CONFLICT (track_id) DO UPDATE
+		SET provider = EXCLUDED.provider, reason = EXCLUDED.reason, attempts = EXCLUDED.attempts,
+		    last_checked_at = NOW(), retry_after = EXCLUDED.retry_after`,
+		trackID, lyricsProvider.Name(), reason, attempts, int64(lyricsBackoff(reason, attempts)/time.Second))
+	return err
+}
+
+// setLyricsSource registra la procedencia de un set de letras
+func setLyricsSource(tx *sql.Tx, trackID, kind, lang, source, sourceID string) error {
+	_, err := tx.Exec(`
+		UPDATE lyric_sets SET source = $4, source_id = NULLIF($5, ''),
+		       fetched_at = CASE WHEN $4 IN ('curator', 'community', 'manual') THEN NULL ELSE NOW() END
+		WHERE track_id = $1::uuid AND kind = $2 AND (kind = 'original' OR language = $3)`,
+		trackID, kind, lang, source, sourceID)
+	return err
+}
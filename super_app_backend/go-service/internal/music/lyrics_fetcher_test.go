@@ -0,0 +1,80 @@
+package music
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/giampier/super-app-api/internal/lyrics"
+)
+
+// El proveedor falso responde según el título: letra, 404, instrumental o 500
+func fakeLyricsProvider(t *testing.T) lyrics.Provider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("track_name") {
+		case "Con letra":
+			w.Write([]byte(`{"id": 1, "syncedLyrics": "[00:01.00]uno\n[00:02.00]dos"}`))
+		case "Solo texto":
+			w.Write([]byte(`{"id": 2, "plainLyrics": "uno\ndos\ntres"}`))
+		case "Vacia":
+			w.Write([]byte(`{"id": 3}`))
+		case "Instrumental":
+			w.Write([]byte(`{"id": 4, "instrumental": true}`))
+		case "Falla":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return lyrics.NewLRCLIB(srv.URL)
+}
+
+func TestLyricsFetchOutcome(t *testing.T) {
+	p := fakeLyricsProvider(t)
+	cases := []struct {
+		track  string
+		reason string
+		lines  int
+	}{
+		{"Con letra", "", 2},
+		{"Solo texto", "", 3},
+		{"Vacia", "not_found", 0},
+		{"No existe", "not_found", 0},
+		{"Instrumental", "instrumental", 0},
+		{"Falla", "error", 0},
+	}
+	for _, tc := range cases {
+		doc, reason := lyricsFetchOutcome(p.Fetch(context.Background(), lyrics.Query{TrackName: tc.track, ArtistName: "Artista"}))
+		if reason != tc.reason {
+			t.Errorf("%s: motivo %q, se esperaba %q", tc.track, reason, tc.reason)
+			continue
+		}
+		if tc.reason == "" && (doc == nil || len(doc.Lines) != tc.lines) {
+			t.Errorf("%s: se esperaban %d líneas, llegó %+v", tc.track, tc.lines, doc)
+		}
+	}
+}
+
+func TestLyricsBackoff(t *testing.T) {
+	cases := []struct {
+		reason   string
+		attempts int
+		want     time.Duration
+	}{
+		{"error", 1, lyricsErrorBackoff},
+		{"error", 9, lyricsErrorBackoff},
+		{"not_found", 1, lyricsMissBackoff},
+		{"not_found", 3, 3 * lyricsMissBackoff},
+		{"not_found", 10, lyricsMissMax},
+		{"instrumental", 1, lyricsMissMax},
+	}
+	for _, tc := range cases {
+		if got := lyricsBackoff(tc.reason, tc.attempts); got != tc.want {
+			t.Errorf("%s (intento %d): %v, se esperaba %v", tc.reason, tc.attempts, got, tc.want)
+		}
+	}
+}
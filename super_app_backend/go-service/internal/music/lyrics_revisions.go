@@ -0,0 +1,442 @@
+package music
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/auth"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/lyrics"
+	"github.com/giampier/super-app-api/internal/models"
+)
+
+// revision es lo que guardamos en lyric_revisions
+type revision struct {
+	TrackID     string
+	Kind        string
+	Language    string
+	Content     string
+	Format      string
+	Diff        string
+	Note        string
+	Status      string
+	Source      string
+	SubmittedBy string // "" = sistema (p. ej. LRCLIB)
+	ReviewedBy  string
+	RollbackOf  string
+	// Revisión publicada cuando se propuso ("" si no había letra)
+	BaseRevision string
+}
+
+// currentCanonical devuelve la letra publicada en forma canónica ("" si no hay).
+// Recibe la transacción en curso para ver lo que ella misma ya publicó.
+func currentCanonical(q querier, trackID, kind, lang string) string {
+	if kind == "original" {
+		lang = ""
+	}
+	doc, err := loadLyricsDocument(q, trackID, lang)
+	if err != nil {
+		return ""
+	}
+	content, _ := doc.Canonical()
+	return content
+}
+
+// newRevision prepara una revisión a partir de una letra ya interpretada, con su diff
+func newRevision(q querier, trackID, kind, lang string, doc *lyrics.Document) revision {
+	content, format := doc.Canonical()
+	return revision{
+		TrackID:  trackID,
+		Kind:     kind,
+		Language: lang,
+		Content:  content,
+		Format:   format,
+		Diff:     lyrics.Diff(currentCanonical(q, trackID, kind, lang), content),
+	}
+}
+
+func insertRevision(tx *sql.Tx, r revision) (string, error) {
+	var id string
+	err := tx.QueryRow(`
+		INSERT INTO lyric_revisions
+			(track_id, kind, language, content, format, diff, note, status, source,
+			 submitted_by, reviewed_by, reviewed_at, rollback_of, base_revision_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9,
+		        NULLIF($10, '')::uuid, NULLIF($11, '')::uuid,
+		        CASE WHEN $8 = 'pending' THEN NULL ELSE NOW() END, NULLIF($12, '')::uuid, NULLIF($13, '')::uuid)
+		RETURNING id`,
+		r.TrackID, r.Kind, r.Language, r.Content, r.Format, r.Diff, r.Note, r.Status, r.Source,
+		r.SubmittedBy, r.ReviewedBy, r.RollbackOf, r.BaseRevision).Scan(&id)
+	return id, err
+}
+
+// publishedRevision devuelve la revisión publicada de una letra ("" si no hay).
+// Con forUpdate bloquea el set para que dos aprobaciones no se pisen.
+func publishedRevision(q querier, trackID, kind, lang string, forUpdate bool) (string, error) {
+	query := `
+		SELECT revision_id FROM lyric_sets
+		WHERE track_id = $1::uuid AND kind = $2 AND (kind = 'original' OR language = $3)`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var id sql.NullString
+	err := q.QueryRow(query, trackID, kind, lang).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id.String, err
+}
+
+// publishLyrics reemplaza la letra publicada y deja constancia de qué revisión
+// es y de quién la aportó
+func publishLyrics(tx *sql.Tx, r revision, revisionID, sourceID string, doc *lyrics.Document) error {
+	if err := replaceLyrics(tx, r.TrackID, r.Kind, r.Language, doc); err != nil {
+		return err
+	}
+	if err := setLyricsSource(tx, r.TrackID, r.Kind, r.Language, r.Source, sourceID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		UPDATE lyric_sets SET revision_id = $4, contributed_by = NULLIF($5, '')::uuid
+		WHERE track_id = $1::uuid AND kind = $2 AND (kind = 'original' OR language = $3)`,
+		r.TrackID, r.Kind, r.Language, revisionID, r.SubmittedBy)
+	return err
+}
+
+// SubmitLyricsRevision permite a cualquier oyente proponer (o corregir) una letra
+// POST /music/tracks/:id/lyrics/revisions
+func SubmitLyricsRevision(c *gin.Context) {
+	trackID := c.Param("id")
+	if !validID(c, trackID) {
+		return
+	}
+	var input struct {
+		Lyrics string `json:"lyrics" binding:"required"`
+		Format string `json:"format"` // "lrc" (por defecto), "text" o "ttml"
+		Kind   string `json:"kind"`
+		Lang   string `json:"lang"`
+		Note   string `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+	if input.Kind == "" {
+		input.Kind = "original"
+	}
+	if !lyricKinds[input.Kind] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de letra inválido: " + input.Kind})
+		return
+	}
+	if input.Kind != "original" && input.Lang == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Las traducciones y romanizaciones necesitan lang"})
+		return
+	}
+
+	doc, err := parseLyricsInput(input.Lyrics, input.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Letra inválida: " + err.Error()})
+		return
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM tracks WHERE id = $1::uuid)", trackID).Scan(&exists); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
+		return
+	}
+
+	// La versión que vio quien propone: si al aprobar ya es otra, la propuesta quedó vieja
+	base, err := publishedRevision(db.DB, trackID, input.Kind, input.Lang, false)
+	if err != nil {
+		log.Printf("⚠️  Letra publicada de %s: %v\n", trackID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando la propuesta"})
+		return
+	}
+	r := newRevision(db.DB, trackID, input.Kind, input.Lang, doc)
+	r.BaseRevision = base
+	if added, removed := lyrics.DiffStats(r.Diff); added == 0 && removed == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "La letra es igual a la publicada"})
+		return
+	}
+	r.Status = "pending"
+	r.Source = "community"
+	r.Note = input.Note
+	r.SubmittedBy = auth.CurrentUserID(c)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error del servidor"})
+		return
+	}
+	defer tx.Rollback()
+
+	id, err := insertRevision(tx, r)
+	if err != nil || tx.Commit() != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando la propuesta"})
+		return
+	}
+
+	added, removed := lyrics.DiffStats(r.Diff)
+	c.JSON(http.StatusCreated, gin.H{
+		"id":            id,
+		"status":        r.Status,
+		"lines_added":   added,
+		"lines_removed": removed,
+		"diff":          r.Diff,
+	})
+}
+
+// revisionColumns es el SELECT común de las consultas de revisiones
+const revisionColumns = `
+	SELECT r.id, r.track_id, t.title, r.kind, r.language, r.status, r.source, COALESCE(r.note, ''),
+	       r.diff, r.content, r.submitted_at, r.reviewed_at, COALESCE(r.review_note, ''), r.rollback_of,
+	       su.id, su.username, ru.id, ru.username,
+	       EXISTS (SELECT 1 FROM lyric_sets s WHERE s.revision_id = r.id)
+	FROM lyric_revisions r
+	JOIN tracks t ON t.id = r.track_id
+	LEFT JOIN users su ON su.id = r.submitted_by
+	LEFT JOIN users ru ON ru.id = r.reviewed_by`
+
+func scanRevision(row rowScanner) (models.LyricsRevision, error) {
+	var r models.LyricsRevision
+	var subID, subName, revID, revName sql.NullString
+	err := row.Scan(&r.ID, &r.TrackID, &r.TrackTitle, &r.Kind, &r.Language, &r.Status, &r.Source, &r.Note,
+		&r.Diff, &r.Content, &r.SubmittedAt, &r.ReviewedAt, &r.ReviewNote, &r.RollbackOf,
+		&subID, &subName, &revID, &revName, &r.IsCurrent)
+	if err != nil {
+		return r, err
+	}
+	if subID.Valid {
+		r.SubmittedBy = &models.UserRef{ID: subID.String, Username: subName.String}
+	}
+	if revID.Valid {
+		r.ReviewedBy = &models.UserRef{ID: revID.String, Username: revName.String}
+	}
+	r.Added, r.Removed = lyrics.DiffStats(r.Diff)
+	return r, nil
+}
+
+func listRevisions(c *gin.Context, where string, args ...interface{}) {
+	rows, err := db.DB.Query(revisionColumns+" WHERE "+where, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando revisiones"})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []models.LyricsRevision{}
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			continue
+		}
+		// En los listados no mandamos la letra completa
+		r.Content = ""
+		r.Diff = ""
+		revisions = append(revisions, r)
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetLyricsReviewQueue lista las propuestas pendientes, las más antiguas primero (curadores)
+// GET /music/lyrics/revisions?status=pending
+func GetLyricsReviewQueue(c *gin.Context) {
+	listRevisions(c, "r.status = $1 ORDER BY r.submitted_at ASC LIMIT 100", c.DefaultQuery("status", "pending"))
+}
+
+// GetLyricsHistory devuelve el historial de revisiones de la letra de una canción.
+// Las pendientes y rechazadas solo las ven quien las envió y los curadores.
+// GET /music/tracks/:id/lyrics/revisions
+func GetLyricsHistory(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	listRevisions(c, `r.track_id = $1::uuid
+		AND (r.status = 'approved' OR $2 OR r.submitted_by = NULLIF($3, '')::uuid)
+		ORDER BY r.submitted_at DESC`, c.Param("id"), auth.IsModerator(c), auth.CurrentUserID(c))
+}
+
+// GetLyricsRevision devuelve una revisión con su contenido y su diff. Una no
+// aprobada solo la ven quien la envió y los curadores (para el resto no existe).
+// GET /music/lyrics/revisions/:id
+func GetLyricsRevision(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	r, err := scanRevision(db.DB.QueryRow(revisionColumns+" WHERE r.id = $1::uuid", c.Param("id")))
+	if err == nil && r.Status != "approved" && !auth.IsModerator(c) {
+		if userID := auth.CurrentUserID(c); r.SubmittedBy == nil || userID == "" || r.SubmittedBy.ID != userID {
+			err = sql.ErrNoRows
+		}
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revisión no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando revisión"})
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// loadRevisionForUpdate bloquea la revisión dentro de la transacción
+func loadRevisionForUpdate(tx *sql.Tx, id string) (revision, error) {
+	var r revision
+	var submittedBy, base sql.NullString
+	err := tx.QueryRow(`
+		SELECT track_id, kind, language, content, format, diff, COALESCE(note, ''), status, source, submitted_by, base_revision_id
+		FROM lyric_revisions WHERE id = $1::uuid FOR UPDATE`, id).
+		Scan(&r.TrackID, &r.Kind, &r.Language, &r.Content, &r.Format, &r.Diff, &r.Note, &r.Status, &r.Source, &submittedBy, &base)
+	r.SubmittedBy = submittedBy.String
+	r.BaseRevision = base.String
+	return r, err
+}
+
+// ApproveLyricsRevision publica una propuesta pendiente (curadores)
+// POST /music/lyrics/revisions/:id/approve
+func ApproveLyricsRevision(c *gin.Context) {
+	reviewLyricsRevision(c, "approved")
+}
+
+// RejectLyricsRevision descarta una propuesta pendiente (curadores)
+// POST /music/lyrics/revisions/:id/reject
+func RejectLyricsRevision(c *gin.Context) {
+	reviewLyricsRevision(c, "rejected")
+}
+
+func reviewLyricsRevision(c *gin.Context, status string) {
+	id := c.Param("id")
+	if !validID(c, id) {
+		return
+	}
+	var input struct {
+		Note string `json:"note"`
+	}
+	// El comentario es opcional
+	_ = c.ShouldBindJSON(&input)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error del servidor"})
+		return
+	}
+	defer tx.Rollback()
+
+	r, err := loadRevisionForUpdate(tx, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revisión no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando revisión"})
+		return
+	}
+	if r.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "La revisión ya fue " + r.Status})
+		return
+	}
+
+	if status == "approved" {
+		// Aprobar una propuesta hecha sobre otra versión pisaría la edición
+		// o el rollback publicados después
+		current, err := publishedRevision(tx, r.TrackID, r.Kind, r.Language, true)
+		if err != nil {
+			log.Printf("⚠️  Letra publicada de la revisión %s: %v\n", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando revisión"})
+			return
+		}
+		if current != r.BaseRevision {
+			c.JSON(http.StatusConflict, gin.H{"error": "La letra cambió desde que se propuso esta revisión; hay que proponerla de nuevo"})
+			return
+		}
+
+		doc, err := lyrics.ParseCanonical(r.Content, r.Format)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "La revisión no es una letra válida: " + err.Error()})
+			return
+		}
+		if err := publishLyrics(tx, r, id, "", doc); errors.Is(err, errBadVariant) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			log.Printf("⚠️  Publicando la revisión %s: %v\n", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error publicando letras"})
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE lyric_revisions SET status = $2, reviewed_by = $3, reviewed_at = NOW(), review_note = NULLIF($4, '')
+		WHERE id = $1`, id, status, auth.CurrentUserID(c), input.Note)
+	if err != nil || tx.Commit() != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando la revisión"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "status": status})
+}
+
+// RollbackLyricsRevision vuelve a publicar una revisión aprobada anterior (curadores).
+// No borra historial: crea una revisión nueva con el mismo contenido.
+// POST /music/lyrics/revisions/:id/rollback
+func RollbackLyricsRevision(c *gin.Context) {
+	targetID := c.Param("id")
+	if !validID(c, targetID) {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error del servidor"})
+		return
+	}
+	defer tx.Rollback()
+
+	target, err := loadRevisionForUpdate(tx, targetID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revisión no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando revisión"})
+		return
+	}
+	if target.Status != "approved" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Solo se puede volver a una revisión aprobada"})
+		return
+	}
+
+	doc, err := lyrics.ParseCanonical(target.Content, target.Format)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "La revisión no es una letra válida: " + err.Error()})
+		return
+	}
+
+	// La atribución sigue siendo de quien escribió esa versión
+	r := newRevision(tx, target.TrackID, target.Kind, target.Language, doc)
+	r.Status = "approved"
+	r.Source = target.Source
+	r.SubmittedBy = target.SubmittedBy
+	r.ReviewedBy = auth.CurrentUserID(c)
+	r.RollbackOf = targetID
+	r.Note = "Rollback"
+
+	newID, err := insertRevision(tx, r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando la revisión"})
+		return
+	}
+	if err := publishLyrics(tx, r, newID, "", doc); err != nil {
+		log.Printf("⚠️  Volviendo a la revisión %s: %v\n", targetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error publicando letras"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error publicando letras"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": newID, "status": "approved", "rollback_of": targetID})
+}
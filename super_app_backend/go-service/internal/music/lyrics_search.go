@@ -0,0 +1,155 @@
+package music
+
+import (
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/lyrics"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+// SearchByLyrics busca canciones por un fragmento de la letra
+// GET /music/search/lyrics?q=tryna+cal&limit=20
+// Tolera tildes, apóstrofos, signos y pequeñas faltas de ortografía (trigramas de pg_trgm).
+func SearchByLyrics(c *gin.Context) {
+	// La misma normalización con la que se guardó search_text
+	q := utils.SearchText(c.Query("q"))
+	if utf8.RuneCountInString(q) < 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La búsqueda necesita al menos 3 caracteres"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 50 {
+		limit = 20
+	}
+
+	// Por canción nos quedamos con la mejor línea: primero frase exacta, luego la más parecida
+	query := `
+		SELECT m.track_id, t.title, COALESCE(ar.name, ''), COALESCE(t.cover_url, al.cover_url, ''),
+		       m.time_ms, m.text, m.language, m.phrase, m.score
+		FROM (
+			SELECT DISTINCT ON (x.track_id) x.track_id, x.time_ms, x.text, x.language,
+			       x.search_text LIKE $2 AS phrase,
+			       word_similarity($1, x.search_text) AS score
+			FROM (
+				SELECT l.track_id, l.time_ms, l.text, l.search_text, s.language, TRUE AS original
+				FROM lyrics l
+				JOIN lyric_sets s ON s.id = l.lyric_set_id
+				WHERE l.search_text LIKE $2 OR $1 <% l.search_text
+				UNION ALL
+				-- Traducciones y romanizaciones, con el tiempo de la línea original
+				SELECT s.track_id, o.time_ms, v.text, v.search_text, s.language, FALSE
+				FROM lyric_variant_lines v
+				JOIN lyric_sets s ON s.id = v.lyric_set_id
+				JOIN lyric_sets os ON os.track_id = s.track_id AND os.kind = 'original'
+				JOIN lyrics o ON o.lyric_set_id = os.id AND o.line_no = v.line_no
+				WHERE v.search_text LIKE $2 OR $1 <% v.search_text
+			) x
+			ORDER BY x.track_id, phrase DESC, score DESC, x.original DESC, x.time_ms
+		) m
+		JOIN tracks t ON t.id = m.track_id
+		LEFT JOIN artists ar ON ar.id = t.artist_id
+		LEFT JOIN albums al ON al.id = t.album_id
+		ORDER BY m.phrase DESC, m.score DESC, ar.popularity DESC NULLS LAST
+		LIMIT $3`
+
+	rows, err := db.DB.Query(query, q, "%"+escapeLike(q)+"%", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error buscando letras"})
+		return
+	}
+	defer rows.Close()
+
+	results := []models.LyricsMatch{}
+	for rows.Next() {
+		var m models.LyricsMatch
+		if err := rows.Scan(&m.TrackID, &m.Title, &m.ArtistName, &m.CoverURL,
+			&m.TimeMs, &m.Line, &m.Language, &m.ExactPhrase, &m.Score); err != nil {
+			continue
+		}
+		m.Highlights = lyrics.Highlight(m.Line, q)
+		m.Highlighted = lyrics.Mark(m.Line, m.Highlights)
+		results = append(results, m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   c.Query("q"),
+		"results": results,
+	})
+}
+
+// Líneas por lote al recalcular search_text
+const reindexBatch = 1000
+
+// ReindexLyricsSearch calcula search_text de las líneas que no lo tienen y
+// devuelve cuántas actualizó. Si cambia utils.SearchText basta con poner
+// search_text a NULL y volver a correrlo.
+func ReindexLyricsSearch() (int, error) {
+	total := 0
+	// Cada tabla con su clave primaria (dos columnas en las variantes)
+	for _, t := range []struct{ table, key, where string }{
+		{"lyrics", "id::text, 0", "id = $1::uuid"},
+		{"lyric_variant_lines", "lyric_set_id::text, line_no", "lyric_set_id = $1::uuid AND line_no = $3"},
+	} {
+		for {
+			n, err := reindexBatchOf(t.table, t.key, t.where)
+			if err != nil {
+				return total, err
+			}
+			total += n
+			if n < reindexBatch {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+func reindexBatchOf(table, key, where string) (int, error) {
+	type line struct {
+		id, text string
+		lineNo   int
+	}
+	rows, err := db.DB.Query("SELECT "+key+", text FROM "+table+" WHERE search_text IS NULL LIMIT $1", reindexBatch)
+	if err != nil {
+		return 0, err
+	}
+	var lines []line
+	for rows.Next() {
+		var l line
+		if err := rows.Scan(&l.id, &l.lineNo, &l.text); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(lines) == 0 {
+		return 0, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("UPDATE " + table + " SET search_text = $2 WHERE " + where)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, l := range lines {
+		args := []interface{}{l.id, utils.SearchText(l.text)}
+		if table == "lyric_variant_lines" {
+			args = append(args, l.lineNo)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return 0, err
+		}
+	}
+	return len(lines), tx.Commit()
+}
@@ -0,0 +1,85 @@
+package music
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/auth"
+	"github.com/giampier/super-app-api/internal/db"
+)
+
+// Presupuesto para consultar las búsquedas recientes sin frenar el autocompletado
+const recentSearchBudget = 50 * time.Millisecond
+
+// SearchSuggest devuelve sugerencias mientras el usuario escribe
+// GET /music/search/suggest?q=bad&limit=8
+func SearchSuggest(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "8"))
+	if err != nil || limit <= 0 || limit > 20 {
+		limit = 8
+	}
+
+	results := searchIndex.Lookup(q, limit)
+
+	// Si está logueado, sumamos sus búsquedas recientes que empiecen igual
+	recent := []string{}
+	if userID := auth.CurrentUserID(c); userID != "" && q != "" {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), recentSearchBudget)
+		defer cancel()
+
+		rows, err := db.DB.QueryContext(ctx, `
+			SELECT query FROM search_history
+			WHERE user_id = $1 AND query ILIKE $2 || '%' ESCAPE '\'
+			GROUP BY query
+			ORDER BY MAX(created_at) DESC
+			LIMIT 3`, userID, escapeLike(q))
+		if err == nil {
+			defer rows.Close()
+			for rows.Next() {
+				var s string
+				if err := rows.Scan(&s); err != nil {
+					continue
+				}
+				recent = append(recent, s)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   q,
+		"recent":  recent,
+		"results": results,
+	})
+}
+
+// SaveSearch guarda una búsqueda confirmada por el usuario (para sus "recientes")
+func SaveSearch(c *gin.Context) {
+	var input struct {
+		Query string `json:"query" binding:"required"`
+	}
+
+	// Solo espacios también cuenta como vacía
+	if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query requerida"})
+		return
+	}
+
+	_, err := db.DB.Exec("INSERT INTO search_history (user_id, query) VALUES ($1, $2)",
+		auth.CurrentUserID(c), strings.TrimSpace(input.Query))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando búsqueda"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": "saved"})
+}
+
+// escapeLike evita que % y _ de la búsqueda se interpreten como comodines
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
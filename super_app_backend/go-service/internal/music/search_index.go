@@ -0,0 +1,245 @@
+package music
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+// Límite de claves que revisamos por consulta, para mantener la latencia acotada
+const maxPrefixScan = 300
+
+type indexKey struct {
+	key   string
+	entry *indexEntry
+}
+
+type indexEntry struct {
+	suggestion models.SearchSuggestion
+	name       string // Nombre normalizado completo
+	popularity int
+}
+
+// prefixIndex es un índice en memoria de claves normalizadas ordenadas.
+// Cada nombre se indexa por cada palabra con la que empieza un sufijo,
+// así "lig" encuentra "Blinding Lights".
+type prefixIndex struct {
+	mu      sync.RWMutex
+	keys    []indexKey
+	entries map[string]*indexEntry // "tipo:id" -> entrada
+}
+
+var searchIndex = &prefixIndex{entries: map[string]*indexEntry{}}
+
+// LoadSearchIndex construye el índice de sugerencias a partir del catálogo
+func LoadSearchIndex() {
+	var loaded []models.SearchSuggestion
+	var popularity []int
+
+	rows, err := db.DB.Query("SELECT id, name, COALESCE(image_url, ''), COALESCE(popularity, 0) FROM artists")
+	if err != nil {
+		log.Println("⚠️  No se pudo cargar el índice de artistas:", err)
+		return
+	}
+	for rows.Next() {
+		s := models.SearchSuggestion{Type: "artist"}
+		var pop int
+		if err := rows.Scan(&s.ID, &s.Title, &s.ImageURL, &pop); err != nil {
+			continue
+		}
+		loaded = append(loaded, s)
+		popularity = append(popularity, pop)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT al.id, al.title, COALESCE(ar.name, ''), COALESCE(al.cover_url, ''), COALESCE(ar.popularity, 0)
+		FROM albums al LEFT JOIN artists ar ON ar.id = al.artist_id`)
+	if err != nil {
+		log.Println("⚠️  No se pudo cargar el índice de álbumes:", err)
+		return
+	}
+	for rows.Next() {
+		s := models.SearchSuggestion{Type: "album"}
+		var pop int
+		if err := rows.Scan(&s.ID, &s.Title, &s.Subtitle, &s.ImageURL, &pop); err != nil {
+			continue
+		}
+		loaded = append(loaded, s)
+		popularity = append(popularity, pop)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT t.id, t.title, COALESCE(ar.name, ''), COALESCE(t.cover_url, al.cover_url, ''), COALESCE(ar.popularity, 0)
+		FROM tracks t
+		LEFT JOIN artists ar ON ar.id = t.artist_id
+		LEFT JOIN albums al ON al.id = t.album_id`)
+	if err != nil {
+		log.Println("⚠️  No se pudo cargar el índice de canciones:", err)
+		return
+	}
+	for rows.Next() {
+		s := models.SearchSuggestion{Type: "track"}
+		var pop int
+		if err := rows.Scan(&s.ID, &s.Title, &s.Subtitle, &s.ImageURL, &pop); err != nil {
+			continue
+		}
+		loaded = append(loaded, s)
+		popularity = append(popularity, pop)
+	}
+	rows.Close()
+
+	searchIndex.reset(loaded, popularity)
+	log.Printf("🔎 Índice de búsqueda listo (%d entradas)\n", len(loaded))
+}
+
+func (idx *prefixIndex) reset(items []models.SearchSuggestion, popularity []int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.keys = nil
+	idx.entries = map[string]*indexEntry{}
+	for i, s := range items {
+		idx.keys = append(idx.keys, idx.newEntry(s, popularity[i])...)
+	}
+	sort.Slice(idx.keys, func(i, j int) bool { return idx.keys[i].key < idx.keys[j].key })
+}
+
+// newEntry registra la entrada y devuelve sus claves (sin ordenar). Requiere el lock.
+func (idx *prefixIndex) newEntry(s models.SearchSuggestion, popularity int) []indexKey {
+	id := s.Type + ":" + s.ID
+	if _, exists := idx.entries[id]; exists {
+		return nil
+	}
+
+	e := &indexEntry{suggestion: s, name: utils.NormalizeText(s.Title), popularity: popularity}
+	idx.entries[id] = e
+
+	words := strings.Fields(e.name)
+	keys := make([]indexKey, 0, len(words))
+	for i := range words {
+		keys = append(keys, indexKey{key: strings.Join(words[i:], " "), entry: e})
+	}
+	return keys
+}
+
+// Add inserta una entrada nueva manteniendo el orden (actualización incremental)
+func (idx *prefixIndex) Add(s models.SearchSuggestion, popularity int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.insert(s, popularity)
+}
+
+// Update inserta la entrada o reemplaza la que ya existe (p. ej. una canción
+// renombrada) conservando su popularidad; Add ignora las que ya existen
+func (idx *prefixIndex) Update(s models.SearchSuggestion, popularity int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if e, ok := idx.entries[s.Type+":"+s.ID]; ok {
+		popularity = e.popularity
+		idx.remove(s.Type, s.ID)
+	}
+	idx.insert(s, popularity)
+}
+
+// Remove quita una entrada (p. ej. una canción fusionada con otra)
+func (idx *prefixIndex) Remove(typ, id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(typ, id)
+}
+
+// insert agrega las claves de una entrada nueva en su posición. Requiere el lock.
+func (idx *prefixIndex) insert(s models.SearchSuggestion, popularity int) {
+	for _, k := range idx.newEntry(s, popularity) {
+		pos := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i].key >= k.key })
+		idx.keys = append(idx.keys, indexKey{})
+		copy(idx.keys[pos+1:], idx.keys[pos:])
+		idx.keys[pos] = k
+	}
+}
+
+// remove quita la entrada y sus claves. Requiere el lock.
+func (idx *prefixIndex) remove(typ, id string) {
+	e, ok := idx.entries[typ+":"+id]
+	if !ok {
+		return
+	}
+	delete(idx.entries, typ+":"+id)
+	keys := idx.keys[:0]
+	for _, k := range idx.keys {
+		if k.entry != e {
+			keys = append(keys, k)
+		}
+	}
+	idx.keys = keys
+}
+
+// Lookup devuelve las mejores coincidencias para el prefijo dado
+func (idx *prefixIndex) Lookup(prefix string, limit int) []models.SearchSuggestion {
+	prefix = utils.NormalizeText(prefix)
+	if prefix == "" {
+		return []models.SearchSuggestion{}
+	}
+
+	idx.mu.RLock()
+	start := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i].key >= prefix })
+	seen := map[*indexEntry]bool{}
+	var matches []*indexEntry
+	for i := start; i < len(idx.keys) && i-start < maxPrefixScan; i++ {
+		if !strings.HasPrefix(idx.keys[i].key, prefix) {
+			break
+		}
+		if e := idx.keys[i].entry; !seen[e] {
+			seen[e] = true
+			matches = append(matches, e)
+		}
+	}
+	idx.mu.RUnlock()
+
+	// Primero lo que empieza por el prefijo, luego lo más popular, luego lo más corto
+	sort.SliceStable(matches, func(i, j int) bool {
+		pi, pj := strings.HasPrefix(matches[i].name, prefix), strings.HasPrefix(matches[j].name, prefix)
+		if pi != pj {
+			return pi
+		}
+		if matches[i].popularity != matches[j].popularity {
+			return matches[i].popularity > matches[j].popularity
+		}
+		return len(matches[i].name) < len(matches[j].name)
+	})
+
+	// Resultados mixtos: garantizamos el mejor de cada tipo y rellenamos por ranking
+	picked := map[*indexEntry]bool{}
+	types := map[string]bool{}
+	for _, e := range matches {
+		if len(picked) == limit {
+			break
+		}
+		if !types[e.suggestion.Type] {
+			types[e.suggestion.Type] = true
+			picked[e] = true
+		}
+	}
+	for _, e := range matches {
+		if len(picked) == limit {
+			break
+		}
+		picked[e] = true
+	}
+
+	results := make([]models.SearchSuggestion, 0, len(picked))
+	for _, e := range matches {
+		if picked[e] {
+			results = append(results, e.suggestion)
+		}
+	}
+	return results
+}
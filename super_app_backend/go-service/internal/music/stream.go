@@ -0,0 +1,390 @@
+package music
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/auth"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/internal/storage"
+	"github.com/giampier/super-app-api/internal/transcode"
+	"github.com/giampier/super-app-api/internal/urlsign"
+)
+
+const (
+	hlsContentType = "application/vnd.apple.mpegurl"
+	// Una media playlist de un tema muy largo no llega ni a 100 KB
+	maxPlaylistBytes = 1 << 20
+)
+
+// Calidades que puede escuchar cada plan con acceso completo a la canción
+var planQualities = map[string]map[string]bool{
+	"free":    {"AAC_64": true, "AAC_160": true, "AAC_320": true},
+	"premium": {"AAC_64": true, "AAC_160": true, "AAC_320": true, "FLAC": true},
+}
+
+var (
+	streamKeys *urlsign.Keyring
+	// Vida de las URLs firmadas (STREAM_URL_TTL) y si se atan a la IP del cliente (STREAM_BIND_IP)
+	streamURLTTL = 6 * time.Hour
+	streamBindIP bool
+)
+
+// ConfigureStreamSigning activa la firma de las URLs de streaming
+func ConfigureStreamSigning(keys *urlsign.Keyring) {
+	streamKeys = keys
+	if ttl, err := time.ParseDuration(os.Getenv("STREAM_URL_TTL")); err == nil && ttl > 0 {
+		streamURLTTL = ttl
+	}
+	streamBindIP, _ = strconv.ParseBool(os.Getenv("STREAM_BIND_IP"))
+}
+
+// trackRendition es una fila de track_renditions
+type trackRendition struct {
+	transcode.Variant
+	PlaylistKey string
+}
+
+// callerPlan devuelve el plan del usuario autenticado, o "anonymous"
+func callerPlan(c *gin.Context) string {
+	userID := auth.CurrentUserID(c)
+	if userID == "" {
+		return "anonymous"
+	}
+	var plan string
+	if err := db.DB.QueryRow("SELECT plan FROM users WHERE id = $1", userID).Scan(&plan); err != nil {
+		return "anonymous"
+	}
+	return plan
+}
+
+// playbackMode decide qué puede escuchar un plan de una canción: "full",
+// "preview" (solo el fragmento) o "blocked". Los anónimos y los free en
+// canciones premium_only se quedan con la vista previa.
+func playbackMode(plan string, premiumOnly, hasPreview bool) string {
+	if plan == "premium" || (plan == "free" && !premiumOnly) {
+		return "full"
+	}
+	if hasPreview {
+		return "preview"
+	}
+	return "blocked"
+}
+
+// trackPremiumOnly dice si una canción es solo para premium
+func trackPremiumOnly(trackID string) (bool, error) {
+	var premiumOnly bool
+	err := db.DB.QueryRow("SELECT premium_only FROM tracks WHERE id = $1::uuid", trackID).Scan(&premiumOnly)
+	return premiumOnly, err
+}
+
+// loadRenditions devuelve las renditions publicadas de una canción, de menor a mayor bitrate
+func loadRenditions(trackID string) ([]trackRendition, error) {
+	rows, err := db.DB.Query(`
+		SELECT quality, codecs, bandwidth, average_bandwidth, playlist_key
+		FROM track_renditions WHERE track_id = $1::uuid
+		ORDER BY bandwidth`, trackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var renditions []trackRendition
+	for rows.Next() {
+		var r trackRendition
+		if err := rows.Scan(&r.Quality, &r.Codecs, &r.Bandwidth, &r.AverageBandwidth, &r.PlaylistKey); err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, r)
+	}
+	return renditions, rows.Err()
+}
+
+// StreamMaster arma el master playlist de una canción solo con las calidades
+// que el plan del usuario permite escuchar
+func StreamMaster(c *gin.Context) {
+	trackID := c.Param("trackId")
+	if !validID(c, trackID) {
+		return
+	}
+	renditions, err := loadRenditions(trackID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando las renditions"})
+		return
+	}
+	if len(renditions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "La canción no tiene streaming disponible"})
+		return
+	}
+
+	premiumOnly, err := trackPremiumOnly(trackID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando la canción"})
+		return
+	}
+	hasPreview := false
+	for _, r := range renditions {
+		hasPreview = hasPreview || r.Quality == transcode.PreviewQuality
+	}
+	plan := callerPlan(c)
+	if mode := playbackMode(plan, premiumOnly, hasPreview); mode != "full" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tu plan solo incluye la vista previa de esta canción", "playback_mode": mode})
+		return
+	}
+
+	allowed := planQualities[plan]
+	var variants []transcode.Variant
+	for _, r := range renditions {
+		if allowed[r.Quality] {
+			variants = append(variants, r.Variant)
+		}
+	}
+	if len(variants) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tu plan no incluye ninguna calidad de esta canción"})
+		return
+	}
+
+	base := publicBaseURL(c) + path.Dir(streamPath(trackID)) + "/"
+	playlist := transcode.MasterPlaylist(variants, func(v transcode.Variant) string {
+		return base + v.Quality + "/index.m3u8" + signedQuery(c, v.Quality)
+	})
+	servePlaylist(c, playlist)
+}
+
+// StreamMediaPlaylist sirve la media playlist de una calidad con las URLs de
+// los segmentos ya absolutas
+func StreamMediaPlaylist(c *gin.Context) {
+	trackID, quality := c.Param("trackId"), c.Param("quality")
+	if !validID(c, trackID) {
+		return
+	}
+	// La vista previa es para todos; el resto exige acceso completo y la calidad en el plan
+	if quality != transcode.PreviewQuality {
+		premiumOnly, err := trackPremiumOnly(trackID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
+			return
+		}
+		plan := callerPlan(c)
+		if playbackMode(plan, premiumOnly, true) != "full" || !planQualities[plan][quality] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Tu plan no incluye esta calidad"})
+			return
+		}
+	}
+
+	var playlistKey string
+	err := db.DB.QueryRow("SELECT playlist_key FROM track_renditions WHERE track_id = $1::uuid AND quality = $2", trackID, quality).
+		Scan(&playlistKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calidad no disponible para esta canción"})
+		return
+	}
+
+	f, err := transcodeStore.Open(c.Request.Context(), playlistKey)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calidad no disponible para esta canción"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error leyendo la playlist"})
+		return
+	}
+	defer f.Close()
+	body, err := io.ReadAll(io.LimitReader(f, maxPlaylistBytes))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error leyendo la playlist"})
+		return
+	}
+
+	// Segmentos y clave van firmados solo para esta calidad (ya comprobada con el plan)
+	dir, query := path.Dir(playlistKey), signedQuery(c, quality)
+	playlist := transcode.RewriteURIs(string(body), func(tag, uri string) string {
+		if tag == "#EXT-X-KEY" {
+			return publicBaseURL(c) + "/stream/keys/" + url.PathEscape(uri) + query
+		}
+		return absoluteURL(c, transcodeStore.URL(path.Join(dir, uri))) + query
+	})
+	servePlaylist(c, playlist)
+}
+
+// streamPath es el stream_url de las canciones con renditions propias: el
+// master que arma StreamMaster, relativo al API
+func streamPath(trackID string) string {
+	return "/stream/" + trackID + "/master.m3u8"
+}
+
+// previewPath es la media playlist de la vista previa de una canción
+func previewPath(trackID string) string {
+	return "/stream/" + trackID + "/" + transcode.PreviewQuality + "/index.m3u8"
+}
+
+// resolveStreamURLs decide el playback_mode de cada canción para quien hace la
+// petición, quita el stream_url si no tiene acceso completo y firma los nuestros
+func resolveStreamURLs(c *gin.Context, tracks []*models.Track) {
+	plan := callerPlan(c)
+	for _, t := range tracks {
+		t.PlayMode = playbackMode(plan, t.PremiumOnly, t.PreviewURL != "")
+		if t.PlayMode != "full" {
+			t.StreamURL = ""
+		}
+		t.StreamURL = signStreamURL(c, t.ID, t.StreamURL, t.StreamURL == streamPath(t.ID))
+		t.PreviewURL = signStreamURL(c, t.ID, t.PreviewURL, true)
+	}
+}
+
+// signStreamURL completa una URL relativa al API y, si es nuestra, la firma
+func signStreamURL(c *gin.Context, trackID, u string, own bool) string {
+	if u == "" {
+		return ""
+	}
+	u = absoluteURL(c, u)
+	if own && streamKeys != nil {
+		cl := urlsign.Claims{UserID: auth.CurrentUserID(c), TrackID: trackID, Expires: time.Now().Add(streamURLTTL)}
+		if streamBindIP {
+			cl.IP = c.ClientIP()
+		}
+		u += "?" + streamKeys.Sign(cl).Encode()
+	}
+	return u
+}
+
+// RequireStreamSignature deja pasar solo URLs firmadas para la canción de la
+// ruta (playlists y segmentos). El usuario sale de la firma, no de un token:
+// los reproductores no mandan Authorization al pedir segmentos.
+func RequireStreamSignature() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl, err := verifyStreamURL(c.Request.URL, c.ClientIP())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Enlace inválido o expirado: " + err.Error()})
+			return
+		}
+		if cl.UserID != "" {
+			c.Set("user_id", cl.UserID)
+		}
+		c.Set("stream_claims", cl)
+		c.Next()
+	}
+}
+
+// VerifyStreamURL responde 204 o 403 para la URL de X-Original-URI, para que
+// un proxy delante del almacenamiento (nginx auth_request) valide los enlaces
+func VerifyStreamURL(c *gin.Context) {
+	u, err := url.Parse(c.GetHeader("X-Original-URI"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if _, err := verifyStreamURL(u, c.ClientIP()); err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// verifyStreamURL comprueba la firma y que la rendition de la ruta sea la
+// firmada. Los segmentos del almacenamiento solo se sirven con una firma atada
+// a su rendition; las playlists de /stream revisan el plan por su cuenta.
+func verifyStreamURL(u *url.URL, clientIP string) (urlsign.Claims, error) {
+	if streamKeys == nil {
+		return urlsign.Claims{}, urlsign.ErrUnknown
+	}
+	route, ok := parseStreamPath(u.Path)
+	if !ok {
+		return urlsign.Claims{}, urlsign.ErrMissing
+	}
+	cl, err := streamKeys.Verify(route.trackID, u.Query(), clientIP, time.Now())
+	if err != nil {
+		return cl, err
+	}
+	if (route.storage || cl.Rendition != "") && cl.Rendition != route.rendition {
+		return urlsign.Claims{}, urlsign.ErrSignature
+	}
+	return cl, nil
+}
+
+// streamRoute es lo que dice una ruta de streaming sobre lo que se pide
+type streamRoute struct {
+	trackID   string
+	rendition string // "" en el master
+	storage   bool   // Archivo del almacenamiento (segmentos), no una playlist del API
+}
+
+// parseStreamPath reconoce /stream/<track>/<rendition>/index.m3u8 (o el master)
+// y <almacenamiento>/hls/<track>/<trabajo>/<rendition>/<archivo>
+func parseStreamPath(p string) (streamRoute, bool) {
+	p = path.Clean(p)
+	if rest, ok := strings.CutPrefix(p, "/stream/"); ok {
+		parts := strings.Split(rest, "/")
+		route := streamRoute{trackID: parts[0]}
+		if len(parts) == 3 {
+			route.rendition = parts[1]
+		}
+		return route, route.trackID != ""
+	}
+	if transcodeStore == nil {
+		return streamRoute{}, false
+	}
+	base, err := url.Parse(transcodeStore.URL("hls"))
+	if err != nil {
+		return streamRoute{}, false
+	}
+	if rest, ok := strings.CutPrefix(p, base.Path+"/"); ok {
+		parts := strings.Split(rest, "/")
+		route := streamRoute{trackID: parts[0], storage: true}
+		if len(parts) == 4 {
+			route.rendition = parts[2]
+		}
+		return route, route.trackID != ""
+	}
+	return streamRoute{}, false
+}
+
+// signedQuery vuelve a firmar, con la clave actual, lo que garantizaba la URL
+// recibida, limitado a una rendition; se usa en las URLs que salen dentro de
+// una playlist
+func signedQuery(c *gin.Context, rendition string) string {
+	v, ok := c.Get("stream_claims")
+	if !ok {
+		return ""
+	}
+	cl := v.(urlsign.Claims)
+	cl.Rendition = rendition
+	return "?" + streamKeys.Sign(cl).Encode()
+}
+
+// servePlaylist responde un .m3u8 que depende del usuario: nada de cachés compartidas
+func servePlaylist(c *gin.Context, playlist string) {
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, hlsContentType, []byte(playlist))
+}
+
+// publicBaseURL es el origen con el que los clientes llegan al API
+// (PUBLIC_BASE_URL si está detrás de un proxy que reescribe el host)
+func publicBaseURL(c *gin.Context) string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// absoluteURL completa las URLs relativas al API (p. ej. el almacenamiento local en /media)
+func absoluteURL(c *gin.Context, u string) string {
+	if strings.HasPrefix(u, "/") {
+		return publicBaseURL(c) + u
+	}
+	return u
+}
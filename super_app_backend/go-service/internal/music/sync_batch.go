@@ -0,0 +1,195 @@
+package music
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/pkg/utils"
+)
+
+const (
+	maxBatchSyncItems = 500
+	// Sincronizaciones en paralelo por batch (cada una ocupa una conexión)
+	syncBatchWorkers = 8
+)
+
+// SyncBatch sincroniza muchas canciones, álbumes y artistas en una sola petición
+// POST /music/sync/batch  {"items": [{"type": "track", "title": ..., "artist_name": ...}, ...]}
+//
+// Los artistas y álbumes compartidos se sincronizan una sola vez antes de las
+// canciones, así los elementos no compiten por crear la misma fila.
+func SyncBatch(c *gin.Context) {
+	var body struct {
+		Items []models.SyncBatchItem `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(body.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "items no puede estar vacío"})
+		return
+	}
+	if len(body.Items) > maxBatchSyncItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Máximo %d elementos por batch", maxBatchSyncItems)})
+		return
+	}
+
+	results := make([]models.SyncBatchItemResult, len(body.Items))
+	for i := range body.Items {
+		item := &body.Items[i]
+		if item.Type == "" {
+			item.Type = "track"
+		}
+		results[i] = models.SyncBatchItemResult{Index: i, Type: item.Type}
+		if msg := validateBatchItem(*item); msg != "" {
+			results[i].Status = "error"
+			results[i].Error = msg
+		}
+	}
+
+	// 1. Artistas principales distintos (los elementos "artist" se responden con el suyo)
+	artists := map[string][]int{}
+	for i, item := range body.Items {
+		if results[i].Status == "" {
+			key := artistBatchKey(item.SyncTrackInput)
+			artists[key] = append(artists[key], i)
+		}
+	}
+	runBatchGroups(body.Items, results, artists, "artist", SyncCatalogArtist)
+
+	// 2. Álbumes distintos
+	albums := map[string][]int{}
+	for i, item := range body.Items {
+		if results[i].Status == "" && item.Type != "artist" && strings.TrimSpace(item.AlbumTitle) != "" {
+			key := albumBatchKey(item.SyncTrackInput)
+			albums[key] = append(albums[key], i)
+		}
+	}
+	runBatchGroups(body.Items, results, albums, "album", SyncCatalogAlbum)
+
+	// 3. Canciones, cada una en su transacción
+	tracks := map[string][]int{}
+	for i, item := range body.Items {
+		if results[i].Status == "" && item.Type == "track" {
+			tracks[fmt.Sprint(i)] = []int{i}
+		}
+	}
+	runBatchGroups(body.Items, results, tracks, "track", SyncCatalogTrack)
+
+	summary := map[string]int{"created": 0, "updated": 0, "unchanged": 0, "error": 0}
+	for _, r := range results {
+		summary[r.Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "summary": summary})
+}
+
+// validateBatchItem revisa los campos obligatorios según el tipo
+func validateBatchItem(item models.SyncBatchItem) string {
+	switch {
+	case item.Type != "track" && item.Type != "album" && item.Type != "artist":
+		return "type debe ser track, album o artist"
+	case strings.TrimSpace(item.ArtistName) == "":
+		return "artist_name es obligatorio"
+	case item.Type == "album" && strings.TrimSpace(item.AlbumTitle) == "":
+		return "album_title es obligatorio"
+	case item.Type == "track" && strings.TrimSpace(item.Title) == "":
+		return "title es obligatorio"
+	}
+	return ""
+}
+
+// runBatchGroups sincroniza un elemento representativo por grupo con concurrencia
+// limitada. El resultado se asigna a los elementos del grupo del mismo tipo; a los
+// demás (p. ej. canciones que comparten el álbum) solo se les propaga un error.
+func runBatchGroups(items []models.SyncBatchItem, results []models.SyncBatchItemResult, groups map[string][]int,
+	itemType string, syncFn func(models.SyncTrackInput) (models.SyncResult, error)) {
+	sem := make(chan struct{}, syncBatchWorkers)
+	var wg sync.WaitGroup
+
+	for _, indexes := range groups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(indexes []int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result, err := syncFn(mergeBatchInputs(items, indexes))
+			// Los errores de la base van al log, no a la respuesta
+			msg := ""
+			if errors.Is(err, errInvalidSync) {
+				msg = err.Error()
+			} else if err != nil {
+				log.Printf("⚠️  Error sincronizando %s en batch: %v\n", itemType, err)
+				msg = "Error sincronizando " + batchTypeNames[itemType]
+			}
+			// Cada goroutine escribe solo en los índices de su grupo
+			for _, i := range indexes {
+				switch {
+				case err != nil:
+					results[i].Status = "error"
+					results[i].Error = msg
+				case items[i].Type == itemType:
+					r := result
+					results[i].Status = r.Status
+					results[i].Result = &r
+				}
+			}
+		}(indexes)
+	}
+	wg.Wait()
+}
+
+var batchTypeNames = map[string]string{"artist": "artista", "album": "álbum", "track": "canción"}
+
+// mergeBatchInputs toma el primer elemento del grupo y completa los campos vacíos
+// (imagen, portada, identificadores) con los de los demás
+func mergeBatchInputs(items []models.SyncBatchItem, indexes []int) models.SyncTrackInput {
+	input := items[indexes[0]].SyncTrackInput
+	for _, i := range indexes[1:] {
+		other := items[i].SyncTrackInput
+		for _, f := range []struct {
+			dst *string
+			src string
+		}{
+			{&input.ArtistImg, other.ArtistImg},
+			{&input.DeezerArtistID, other.DeezerArtistID},
+			{&input.Cover, other.Cover},
+			{&input.UPC, other.UPC},
+			{&input.DeezerAlbumID, other.DeezerAlbumID},
+		} {
+			if *f.dst == "" {
+				*f.dst = f.src
+			}
+		}
+	}
+	return input
+}
+
+// artistBatchKey agrupa por ID de Deezer o, si no hay, por nombre normalizado del
+// artista principal (la misma clave con la que upsertArtist lo reconoce)
+func artistBatchKey(input models.SyncTrackInput) string {
+	if id := normalizeExternalID("deezer", input.DeezerArtistID); id != "" {
+		return "deezer:" + id
+	}
+	name, _ := splitFeaturing(input.ArtistName)
+	return "name:" + utils.NameKey(name)
+}
+
+// albumBatchKey agrupa por UPC, ID de Deezer o artista + título
+func albumBatchKey(input models.SyncTrackInput) string {
+	if upc := normalizeExternalID("upc", input.UPC); upc != "" {
+		return "upc:" + upc
+	}
+	if id := normalizeExternalID("deezer", input.DeezerAlbumID); id != "" {
+		return "deezer:" + id
+	}
+	return artistBatchKey(input) + "\x00" + input.AlbumTitle
+}
@@ -0,0 +1,221 @@
+package music
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/auth"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	errMergeSame     = errors.New("no se puede fusionar algo consigo mismo")
+	errMergeNotFound = errors.New("no encontrado")
+)
+
+// MergeTrack fusiona una canción duplicada en la que queda (solo admins)
+// POST /music/tracks/:id/merge {"duplicate_id": "..."}
+func MergeTrack(c *gin.Context) {
+	var input struct {
+		DuplicateID string `json:"duplicate_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	if !validID(c, c.Param("id")) || !validID(c, input.DuplicateID) {
+		return
+	}
+
+	result, err := mergeTracks(c.Param("id"), input.DuplicateID, auth.CurrentUserID(c))
+	switch {
+	case errors.Is(err, errMergeSame):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se puede fusionar una canción consigo misma"})
+		return
+	case errors.Is(err, errMergeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fusionando las canciones"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// mergeTracks pasa a keepID todo lo que apuntaba a dupID y borra dupID,
+// dejando una redirección. Lo que ya tiene la que queda gana: del duplicado
+// solo se aprovecha lo que a ella le falta.
+func mergeTracks(keepID, dupID, mergedBy string) (models.TrackMergeResult, error) {
+	result := models.TrackMergeResult{TrackID: keepID, MergedID: dupID}
+	if keepID == dupID {
+		return result, errMergeSame
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	// Bloqueamos las dos para que no se fusionen en paralelo en sentidos opuestos
+	var locked int
+	err = tx.QueryRow("SELECT COUNT(*) FROM (SELECT id FROM tracks WHERE id IN ($1::uuid, $2::uuid) ORDER BY id FOR UPDATE) t",
+		keepID, dupID).Scan(&locked)
+	if err != nil {
+		return result, err
+	}
+	if locked != 2 {
+		return result, errMergeNotFound
+	}
+
+	if result, err = mergeTrackTx(tx, keepID, dupID, mergedBy); err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	cleanupMergedTrack(dupID)
+	return result, nil
+}
+
+// rowsAffected devuelve cuántas filas tocó un Exec
+func rowsAffected(res sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// mergeTrackTx hace la fusión dentro de una transacción ya abierta (también
+// la usa la fusión de artistas para sus álbumes repetidos)
+func mergeTrackTx(tx *sql.Tx, keepID, dupID, mergedBy string) (models.TrackMergeResult, error) {
+	result := models.TrackMergeResult{TrackID: keepID, MergedID: dupID}
+	var err error
+
+	// Playlists: la que queda ocupa el lugar del duplicado; si la playlist ya
+	// tenía las dos, sobra el duplicado
+	result.PlaylistsMoved, err = rowsAffected(tx.Exec(`
+		UPDATE playlist_tracks SET track_id = $1
+		WHERE track_id = $2
+		  AND playlist_id NOT IN (SELECT playlist_id FROM playlist_tracks WHERE track_id = $1)`, keepID, dupID))
+	if err != nil {
+		return result, err
+	}
+	if _, err := tx.Exec("DELETE FROM playlist_tracks WHERE track_id = $1", dupID); err != nil {
+		return result, err
+	}
+
+	// Letras: solo si la que queda no tiene original (las traducciones van
+	// alineadas con las líneas de su original, no se pueden mezclar)
+	result.LyricsMoved, err = rowsAffected(tx.Exec(`
+		UPDATE lyric_sets SET track_id = $1
+		WHERE track_id = $2
+		  AND NOT EXISTS (SELECT 1 FROM lyric_sets WHERE track_id = $1 AND kind = 'original')
+		  AND NOT EXISTS (SELECT 1 FROM lyric_sets s WHERE s.track_id = $1 AND s.kind = lyric_sets.kind AND s.language = lyric_sets.language)`,
+		keepID, dupID))
+	if err != nil {
+		return result, err
+	}
+	_, err = tx.Exec(`
+		UPDATE lyrics SET track_id = $1
+		WHERE track_id = $2 AND lyric_set_id IN (SELECT id FROM lyric_sets WHERE track_id = $1)`, keepID, dupID)
+	if err != nil {
+		return result, err
+	}
+	// lyrics.track_id no tiene ON DELETE CASCADE
+	if _, err := tx.Exec("DELETE FROM lyrics WHERE track_id = $1", dupID); err != nil {
+		return result, err
+	}
+	_, err = tx.Exec(`
+		UPDATE tracks SET has_lyrics = TRUE
+		WHERE id = $1 AND EXISTS (
+			SELECT 1 FROM lyrics l JOIN lyric_sets s ON s.id = l.lyric_set_id
+			WHERE s.track_id = $1 AND s.kind = 'original')`, keepID)
+	if err != nil {
+		return result, err
+	}
+	// El historial de revisiones se conserva completo
+	result.RevisionsMoved, err = rowsAffected(tx.Exec("UPDATE lyric_revisions SET track_id = $1 WHERE track_id = $2", keepID, dupID))
+	if err != nil {
+		return result, err
+	}
+
+	result.ExternalIDs, err = rowsAffected(tx.Exec(
+		"UPDATE external_ids SET entity_id = $1 WHERE entity_type = 'track' AND entity_id = $2", keepID, dupID))
+	if err != nil {
+		return result, err
+	}
+
+	// Créditos: los del duplicado solo si la que queda no tiene
+	_, err = tx.Exec(`
+		INSERT INTO track_contributors (track_id, contributor_id, role, position)
+		SELECT $1, contributor_id, role, position FROM track_contributors
+		WHERE track_id = $2 AND NOT EXISTS (SELECT 1 FROM track_contributors WHERE track_id = $1)`, keepID, dupID)
+	if err != nil {
+		return result, err
+	}
+	_, err = tx.Exec(`
+		UPDATE track_credits SET track_id = $1
+		WHERE track_id = $2 AND NOT EXISTS (SELECT 1 FROM track_credits WHERE track_id = $1)`, keepID, dupID)
+	if err != nil {
+		return result, err
+	}
+	if _, err := tx.Exec("DELETE FROM track_credits WHERE track_id = $1", dupID); err != nil {
+		return result, err
+	}
+
+	// Redirecciones: la del duplicado y las que ya apuntaban a él
+	if _, err := tx.Exec("UPDATE track_redirects SET track_id = $1 WHERE track_id = $2", keepID, dupID); err != nil {
+		return result, err
+	}
+	_, err = tx.Exec("INSERT INTO track_redirects (old_id, track_id, merged_by) VALUES ($2, $1, NULLIF($3, '')::uuid)",
+		keepID, dupID, mergedBy)
+	if err != nil {
+		return result, err
+	}
+
+	// El resto (artistas, huella, trabajos, renditions, claves...) cae en cascada
+	_, err = tx.Exec("DELETE FROM tracks WHERE id = $1", dupID)
+	return result, err
+}
+
+// cleanupMergedTrack quita del índice y del almacenamiento lo de una canción
+// ya fusionada (después del commit)
+func cleanupMergedTrack(dupID string) {
+	searchIndex.Remove("track", dupID)
+	if transcodeStore == nil {
+		return
+	}
+	for _, prefix := range []string{path.Join("hls", dupID), path.Join("masters", dupID)} {
+		if err := transcodeStore.DeletePrefix(context.Background(), prefix); err != nil {
+			log.Printf("⚠️  No se pudo borrar %s de la canción fusionada: %v\n", prefix, err)
+		}
+	}
+}
+
+// trackRedirects devuelve a qué canción apunta hoy cada ID fusionado
+func trackRedirects(ids []string) (map[string]string, error) {
+	rows, err := db.DB.Query("SELECT old_id, track_id FROM track_redirects WHERE old_id = ANY($1::uuid[])", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	redirects := map[string]string{}
+	for rows.Next() {
+		var oldID, trackID string
+		if err := rows.Scan(&oldID, &trackID); err != nil {
+			return nil, err
+		}
+		redirects[oldID] = trackID
+	}
+	return redirects, rows.Err()
+}
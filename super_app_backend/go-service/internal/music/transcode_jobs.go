@@ -0,0 +1,565 @@
+package music
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giampier/super-app-api/internal/auth"
+	"github.com/giampier/super-app-api/internal/db"
+	"github.com/giampier/super-app-api/internal/models"
+	"github.com/giampier/super-app-api/internal/storage"
+	"github.com/giampier/super-app-api/internal/transcode"
+)
+
+const (
+	transcodeQueueSize = 100
+	transcodeTimeout   = 30 * time.Minute
+	// Un trabajo 'running' más viejo que esto quedó huérfano (el proceso murió):
+	// ningún worker vivo pasa de transcodeTimeout más la subida y la publicación
+	transcodeLease = transcodeTimeout + 15*time.Minute
+	// Un master FLAC/WAV de un álbum largo cabe de sobra
+	maxMasterBytes = 1 << 30
+)
+
+var (
+	transcodeStore   storage.Storage
+	transcodeEncoder *transcode.Encoder
+	transcodeQueue   = make(chan string, transcodeQueueSize)
+
+	errTranscodeQueueFull = errors.New("cola de transcodificación llena")
+)
+
+// Extensiones de master que aceptamos (ffmpeg detecta el formato real)
+var masterExtensions = map[string]bool{
+	".wav": true, ".flac": true, ".aif": true, ".aiff": true, ".mp3": true, ".m4a": true, ".ogg": true, ".opus": true,
+}
+
+// Content-Type de lo que genera el pipeline
+var hlsContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".m4s":  "audio/mp4",
+	".mp4":  "audio/mp4",
+}
+
+// ConfigureTranscoding fija el almacenamiento y el ffmpeg que usan la
+// transcodificación y los análisis de audio, sin lanzar workers (catalogctl)
+func ConfigureTranscoding(store storage.Storage, enc *transcode.Encoder) {
+	transcodeStore = store
+	transcodeEncoder = enc
+}
+
+// StartTranscoder lanza los workers de transcodificación y retoma los trabajos
+// pendientes. Los que quedaron a medias solo se retoman cuando vence su lease,
+// así un arranque no le roba el trabajo a otra instancia que sigue viva.
+func StartTranscoder(store storage.Storage, enc *transcode.Encoder, workers int) {
+	ConfigureTranscoding(store, enc)
+	if err := enc.Available(); err != nil {
+		log.Printf("⚠️  Transcodificación deshabilitada hasta instalar ffmpeg: %v\n", err)
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for jobID := range transcodeQueue {
+				if err := runTranscodeJob(jobID); err != nil {
+					log.Printf("⚠️  Transcodificación %s: %v\n", jobID, err)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		recoverTranscodeJobs(true)
+		for range time.Tick(transcodeLease / 3) {
+			recoverTranscodeJobs(false)
+		}
+	}()
+}
+
+// recoverTranscodeJobs vuelve a encolar los trabajos con el lease vencido y,
+// si se pide (arranque), también los que siguen en 'queued'. Tomarlos dos veces
+// no es un problema: runTranscodeJob los reclama con un UPDATE atómico.
+func recoverTranscodeJobs(includeQueued bool) {
+	rows, err := db.DB.Query(`
+		UPDATE transcode_jobs SET status = 'queued', started_at = NULL
+		WHERE (status = 'queued' AND $2) OR (status = 'running' AND started_at < NOW() - $1 * INTERVAL '1 second')
+		RETURNING id`, int(transcodeLease.Seconds()), includeQueued)
+	if err != nil {
+		log.Printf("⚠️  No se pudieron recuperar los trabajos de transcodificación: %v\n", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		transcodeQueue <- id
+	}
+}
+
+// enqueueTranscodeJob pasa un trabajo a los workers. Si la cola está llena lo
+// marca como fallido para que se pueda reintentar, en vez de dejarlo en 'queued'
+// sin nadie que lo vaya a tomar.
+func enqueueTranscodeJob(jobID string) error {
+	select {
+	case transcodeQueue <- jobID:
+		return nil
+	default:
+		if _, err := db.DB.Exec(`
+			UPDATE transcode_jobs SET status = 'failed', error = $2, finished_at = NOW()
+			WHERE id = $1 AND status = 'queued'`, jobID, errTranscodeQueueFull.Error()+", reintenta más tarde"); err != nil {
+			log.Printf("⚠️  No se pudo marcar %s como fallido: %v\n", jobID, err)
+		}
+		return errTranscodeQueueFull
+	}
+}
+
+// UploadMaster recibe el master de una canción y encola su transcodificación a HLS
+func UploadMaster(c *gin.Context) {
+	trackID := c.Param("id")
+	if !validID(c, trackID) {
+		return
+	}
+	if transcodeStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "La transcodificación no está configurada"})
+		return
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM tracks WHERE id = $1::uuid)", trackID).Scan(&exists); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxMasterBytes)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Falta el archivo master (campo 'file')"})
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !masterExtensions[ext] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de master no soportado: " + ext})
+		return
+	}
+
+	// Inicio opcional de la vista previa (si no, el del servidor)
+	previewStart := -1
+	if v := c.Request.FormValue("preview_start_ms"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "preview_start_ms inválido"})
+			return
+		}
+		previewStart = ms
+	}
+
+	masterKey := path.Join("masters", trackID, randomHex(8)+ext)
+	if err := transcodeStore.Put(c.Request.Context(), masterKey, file, header.Header.Get("Content-Type")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo guardar el master"})
+		return
+	}
+
+	// Solo con el master ya guardado: una subida fallida no cambia la vista previa actual
+	if previewStart >= 0 {
+		if _, err := db.DB.Exec("UPDATE tracks SET preview_start_ms = $2 WHERE id = $1::uuid", trackID, previewStart); err != nil {
+			transcodeStore.DeletePrefix(c.Request.Context(), masterKey)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo guardar el inicio de la vista previa"})
+			return
+		}
+	}
+
+	var requestedBy sql.NullString
+	if userID := auth.CurrentUserID(c); userID != "" {
+		requestedBy = sql.NullString{String: userID, Valid: true}
+	}
+
+	var job models.TranscodeJob
+	err = db.DB.QueryRow(`
+		INSERT INTO transcode_jobs (track_id, master_key, requested_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, track_id, status, created_at`, trackID, masterKey, requestedBy).
+		Scan(&job.ID, &job.TrackID, &job.Status, &job.CreatedAt)
+	if err != nil {
+		transcodeStore.DeletePrefix(c.Request.Context(), masterKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo crear el trabajo"})
+		return
+	}
+
+	if err := enqueueTranscodeJob(job.ID); err != nil {
+		// El master queda guardado: POST /music/transcode/jobs/:id/retry lo vuelve a intentar
+		job.Status = "failed"
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "La cola de transcodificación está llena, reintenta más tarde", "job": job})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// RetryTranscodeJob vuelve a encolar un trabajo fallido con el mismo master
+// POST /music/transcode/jobs/:id/retry
+func RetryTranscodeJob(c *gin.Context) {
+	jobID := c.Param("id")
+	if !validID(c, jobID) {
+		return
+	}
+
+	var status string
+	err := db.DB.QueryRow(`
+		UPDATE transcode_jobs SET status = 'queued', error = NULL, started_at = NULL, finished_at = NULL
+		WHERE id = $1::uuid AND status = 'failed'
+		RETURNING status`, jobID).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "Solo se pueden reintentar trabajos fallidos"})
+		return
+	} else if err != nil {
+		log.Printf("⚠️  Error reintentando la transcodificación %s: %v\n", jobID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo reintentar el trabajo"})
+		return
+	}
+	if err := enqueueTranscodeJob(jobID); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "La cola de transcodificación está llena, reintenta más tarde"})
+		return
+	}
+
+	job, err := getTranscodeJob(jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando el trabajo"})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetTranscodeJob devuelve el estado de un trabajo
+func GetTranscodeJob(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	job, err := getTranscodeJob(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trabajo no encontrado"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando el trabajo"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// ListTrackTranscodeJobs devuelve los trabajos de una canción, del más reciente al más antiguo
+func ListTrackTranscodeJobs(c *gin.Context) {
+	if !validID(c, c.Param("id")) {
+		return
+	}
+	rows, err := db.DB.Query(transcodeJobQuery+" WHERE j.track_id = $1::uuid ORDER BY j.created_at DESC LIMIT 50", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando los trabajos"})
+		return
+	}
+	defer rows.Close()
+
+	jobs := []models.TranscodeJob{}
+	for rows.Next() {
+		job, err := scanTranscodeJob(rows)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+const transcodeJobQuery = `
+	SELECT j.id, j.track_id, j.status, COALESCE(j.error, ''), COALESCE(j.output_prefix, ''),
+	       j.created_at, j.started_at, j.finished_at
+	FROM transcode_jobs j`
+
+func scanTranscodeJob(row interface{ Scan(...interface{}) error }) (models.TranscodeJob, error) {
+	var job models.TranscodeJob
+	var prefix string
+	var started, finished sql.NullTime
+	err := row.Scan(&job.ID, &job.TrackID, &job.Status, &job.Error, &prefix, &job.CreatedAt, &started, &finished)
+	if started.Valid {
+		job.StartedAt = &started.Time
+	}
+	if finished.Valid {
+		job.FinishedAt = &finished.Time
+	}
+	if prefix != "" && transcodeStore != nil {
+		job.StreamURL = transcodeStore.URL(prefix + "/master.m3u8")
+	}
+	return job, err
+}
+
+func getTranscodeJob(id string) (models.TranscodeJob, error) {
+	job, err := scanTranscodeJob(db.DB.QueryRow(transcodeJobQuery+" WHERE j.id = $1::uuid", id))
+	if err != nil || job.Status != "done" {
+		return job, err
+	}
+
+	// Las renditions publicadas solo son las de este trabajo si nadie lo reemplazó
+	rows, err := db.DB.Query(`
+		SELECT quality, codecs, bandwidth, average_bandwidth
+		FROM track_renditions WHERE job_id = $1 ORDER BY bandwidth`, job.ID)
+	if err != nil {
+		return job, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r models.Rendition
+		if err := rows.Scan(&r.Quality, &r.Codecs, &r.Bandwidth, &r.AverageBandwidth); err == nil {
+			job.Renditions = append(job.Renditions, r)
+		}
+	}
+	return job, rows.Err()
+}
+
+// runTranscodeJob codifica el master de un trabajo y publica el resultado
+func runTranscodeJob(jobID string) error {
+	var trackID, masterKey string
+	err := db.DB.QueryRow(`
+		UPDATE transcode_jobs SET status = 'running', started_at = NOW(), error = NULL
+		WHERE id = $1 AND status = 'queued'
+		RETURNING track_id, master_key`, jobID).Scan(&trackID, &masterKey)
+	if err == sql.ErrNoRows {
+		return nil // Otro worker lo tomó o ya no está pendiente
+	} else if err != nil {
+		return err
+	}
+
+	if err := transcodeJob(jobID, trackID, masterKey); err != nil {
+		msg := err.Error()
+		if len(msg) > 1000 {
+			msg = msg[:1000]
+		}
+		db.DB.Exec("UPDATE transcode_jobs SET status = 'failed', error = $2, finished_at = NOW() WHERE id = $1", jobID, msg)
+		return err
+	}
+	return nil
+}
+
+func transcodeJob(jobID, trackID, masterKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), transcodeTimeout)
+	defer cancel()
+
+	workDir, err := os.MkdirTemp("", "transcode-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	master, err := localMaster(ctx, masterKey, workDir)
+	if err != nil {
+		return fmt.Errorf("no se pudo leer el master: %w", err)
+	}
+
+	// Una clave AES-128 por rendition de este trabajo; las playlists guardan su
+	// id como URI y StreamMediaPlaylist lo convierte en la URL de /stream/keys/:id
+	published := false
+	defer func() {
+		if !published {
+			db.DB.Exec("DELETE FROM content_keys WHERE job_id = $1", jobID)
+		}
+	}()
+	keys := map[string]*transcode.Encryption{}
+	keyIDs := map[string]string{}
+	for _, r := range transcode.Renditions {
+		key, err := transcode.GenerateKey()
+		if err != nil {
+			return err
+		}
+		var keyID string
+		err = db.DB.QueryRow("INSERT INTO content_keys (track_id, job_id, quality, key_bytes) VALUES ($1, $2, $3, $4) RETURNING id",
+			trackID, jobID, r.Quality, key).Scan(&keyID)
+		if err != nil {
+			return err
+		}
+		keys[r.Quality] = &transcode.Encryption{KeyURI: keyID, Key: key}
+		keyIDs[r.Quality] = keyID
+	}
+
+	outDir := filepath.Join(workDir, "hls")
+	out, err := transcodeEncoder.Encode(ctx, master, outDir, keys)
+	if err != nil {
+		return err
+	}
+
+	// La vista previa va sin cifrar: la escuchan también los anónimos. Si falla
+	// se publica igual el tema completo, solo que sin vista previa
+	preview, err := encodePreview(ctx, trackID, master, outDir, out.DurationMs)
+	if err != nil {
+		log.Printf("⚠️  No se pudo generar la vista previa de %s: %v\n", trackID, err)
+		os.RemoveAll(filepath.Join(outDir, transcode.PreviewQuality)) // Nada a medias en el almacenamiento
+	}
+
+	// Cada trabajo escribe en su propia carpeta: la versión anterior sigue
+	// sirviéndose hasta que la base de datos apunte a la nueva
+	prefix := path.Join("hls", trackID, jobID)
+	if err := uploadDir(ctx, outDir, prefix); err != nil {
+		transcodeStore.DeletePrefix(context.Background(), prefix)
+		return fmt.Errorf("no se pudieron subir las renditions: %w", err)
+	}
+
+	previous, err := publishRenditions(jobID, trackID, keyIDs, prefix, out, preview)
+	if err != nil {
+		transcodeStore.DeletePrefix(context.Background(), prefix)
+		return err
+	}
+	published = true
+	EnqueueLoudnessAnalysis(trackID)
+
+	// La huella sale del mismo master que ya está en disco; si falla, el
+	// trabajo sigue publicado y catalogctl duplicates la recalcula
+	if err := fingerprintMaster(ctx, trackID, master); err != nil {
+		log.Printf("⚠️  No se pudo calcular la huella de %s: %v\n", trackID, err)
+	}
+
+	if previous != "" && previous != prefix {
+		if err := transcodeStore.DeletePrefix(context.Background(), previous); err != nil {
+			log.Printf("⚠️  No se pudieron borrar las renditions anteriores (%s): %v\n", previous, err)
+		}
+	}
+	return nil
+}
+
+// encodePreview corta la vista previa desde el preview_start_ms de la canción
+// (o el inicio por defecto del encoder)
+func encodePreview(ctx context.Context, trackID, master, outDir string, durationMs int) (*transcode.Variant, error) {
+	var previewStart sql.NullInt64
+	if err := db.DB.QueryRow("SELECT preview_start_ms FROM tracks WHERE id = $1", trackID).Scan(&previewStart); err != nil {
+		return nil, err
+	}
+	start := time.Duration(-1)
+	if previewStart.Valid {
+		start = time.Duration(previewStart.Int64) * time.Millisecond
+	}
+	return transcodeEncoder.EncodePreview(ctx, master, outDir, start, durationMs)
+}
+
+// localMaster devuelve una ruta en disco al master; si el almacenamiento no es
+// local lo descarga a la carpeta de trabajo
+func localMaster(ctx context.Context, key, workDir string) (string, error) {
+	if local, ok := transcodeStore.(*storage.Local); ok {
+		return local.LocalPath(key)
+	}
+
+	src, err := transcodeStore.Open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst := filepath.Join(workDir, "master"+path.Ext(key))
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return "", err
+	}
+	return dst, f.Close()
+}
+
+// uploadDir sube todo lo que generó ffmpeg bajo el prefijo dado
+func uploadDir(ctx context.Context, dir, prefix string) error {
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return transcodeStore.Put(ctx, path.Join(prefix, filepath.ToSlash(rel)), f, hlsContentTypes[filepath.Ext(p)])
+	})
+}
+
+// publishRenditions apunta la canción a las nuevas renditions (cada una con su
+// clave) y devuelve el prefijo del trabajo anterior (para borrarlo)
+func publishRenditions(jobID, trackID string, keyIDs map[string]string, prefix string, out *transcode.Output, preview *transcode.Variant) (string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullString
+	err = tx.QueryRow(`
+		SELECT j.output_prefix FROM track_renditions r
+		JOIN transcode_jobs j ON j.id = r.job_id
+		WHERE r.track_id = $1 LIMIT 1`, trackID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	if _, err := tx.Exec("DELETE FROM track_renditions WHERE track_id = $1", trackID); err != nil {
+		return "", err
+	}
+	qualities := models.StringArray{}
+	for _, v := range out.Variants {
+		_, err := tx.Exec(`
+			INSERT INTO track_renditions (track_id, quality, codecs, bandwidth, average_bandwidth, playlist_key, job_id, key_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			trackID, v.Quality, v.Codecs, v.Bandwidth, v.AverageBandwidth, path.Join(prefix, v.Playlist), jobID, keyIDs[v.Quality])
+		if err != nil {
+			return "", err
+		}
+		qualities = append(qualities, v.Quality)
+	}
+	if preview != nil {
+		_, err = tx.Exec(`
+			INSERT INTO track_renditions (track_id, quality, codecs, bandwidth, average_bandwidth, playlist_key, job_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			trackID, preview.Quality, preview.Codecs, preview.Bandwidth, preview.AverageBandwidth, path.Join(prefix, preview.Playlist), jobID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tracks SET stream_url = $2, available_qualities = $3,
+		       duration_ms = CASE WHEN COALESCE(duration_ms, 0) = 0 THEN $4 ELSE duration_ms END
+		WHERE id = $1`, trackID, streamPath(trackID), qualities, out.DurationMs)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		UPDATE transcode_jobs SET status = 'done', output_prefix = $2, finished_at = NOW()
+		WHERE id = $1`, jobID, prefix)
+	if err != nil {
+		return "", err
+	}
+	return previous.String, tx.Commit()
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,41 @@
+// Package storage guarda los archivos que genera el backend (masters,
+// segmentos HLS, playlists) detrás de una interfaz, para poder pasar del disco
+// local a un bucket sin tocar el resto del código.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrNotFound indica que la clave no existe
+var ErrNotFound = errors.New("archivo no encontrado en el almacenamiento")
+
+// Storage es cualquier backend de archivos. Las claves usan "/" como separador
+// (p. ej. "hls/<track>/<job>/AAC_64/index.m3u8").
+type Storage interface {
+	// Put guarda el contenido de r en la clave (reemplaza si ya existía)
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Open abre el archivo guardado en la clave
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// DeletePrefix borra todo lo que cuelga de un prefijo
+	DeletePrefix(ctx context.Context, prefix string) error
+	// URL es la dirección pública (o relativa al API) de la clave
+	URL(key string) string
+}
+
+// FromEnv arma el almacenamiento configurado:
+// STORAGE_DIR (por defecto ./media) servido en STORAGE_URL (por defecto /media)
+func FromEnv() Storage {
+	dir := os.Getenv("STORAGE_DIR")
+	if dir == "" {
+		dir = "media"
+	}
+	baseURL := os.Getenv("STORAGE_URL")
+	if baseURL == "" {
+		baseURL = "/media"
+	}
+	return NewLocal(dir, baseURL)
+}
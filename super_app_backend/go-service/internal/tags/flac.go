@@ -0,0 +1,170 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Bloques de metadatos FLAC
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+var errBadFLAC = errors.New("archivo FLAC inválido")
+
+// readFLAC lee desde la posición actual, que debe apuntar a "fLaC"
+func readFLAC(r io.Reader) (*Metadata, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, []byte("fLaC")) {
+		return nil, errBadFLAC
+	}
+
+	m := &Metadata{Format: "flac"}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, errBadFLAC
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		switch blockType {
+		case flacStreamInfo, flacVorbisComment, flacPicture:
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, errBadFLAC
+			}
+			switch blockType {
+			case flacStreamInfo:
+				m.DurationMs = streamInfoDuration(block)
+			case flacVorbisComment:
+				parseVorbisComment(m, block)
+			case flacPicture:
+				m.setCover(parseFLACPicture(block))
+			}
+		default:
+			// Saltamos el bloque (PADDING, SEEKTABLE...) sin cargarlo en memoria
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return nil, errBadFLAC
+			}
+		}
+
+		if last {
+			return m, nil
+		}
+	}
+}
+
+// streamInfoDuration: frecuencia (20 bits) y total de muestras (36 bits)
+func streamInfoDuration(b []byte) int {
+	if len(b) < 18 {
+		return 0
+	}
+	sampleRate := int64(b[10])<<12 | int64(b[11])<<4 | int64(b[12])>>4
+	samples := int64(b[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(b[14:18]))
+	if sampleRate == 0 {
+		return 0
+	}
+	return int(samples * 1000 / sampleRate)
+}
+
+// parseFLACPicture: tipo, MIME, descripción, dimensiones y datos (todo big endian).
+// Es el mismo formato que METADATA_BLOCK_PICTURE en Ogg, allí en base64.
+func parseFLACPicture(b []byte) (*Picture, bool) {
+	read32 := func() (int, bool) {
+		if len(b) < 4 {
+			return 0, false
+		}
+		v := int(binary.BigEndian.Uint32(b))
+		b = b[4:]
+		return v, true
+	}
+	readBytes := func() ([]byte, bool) {
+		n, ok := read32()
+		if !ok || n < 0 || n > len(b) {
+			return nil, false
+		}
+		v := b[:n]
+		b = b[n:]
+		return v, true
+	}
+
+	picType, ok := read32()
+	mime, ok2 := readBytes()
+	_, ok3 := readBytes() // Descripción
+	if !ok || !ok2 || !ok3 || len(b) < 16 {
+		return nil, false
+	}
+	b = b[16:] // Ancho, alto, profundidad de color y colores indexados
+	data, ok := readBytes()
+	if !ok {
+		return nil, false
+	}
+	return &Picture{MIMEType: sniffMIME(data, string(mime)), Data: data}, picType == 3
+}
+
+// parseVorbisComment lee un bloque de comentarios Vorbis (FLAC, Ogg Vorbis y Opus):
+// proveedor y una lista de "CLAVE=valor" con longitudes little endian
+func parseVorbisComment(m *Metadata, b []byte) {
+	read := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n < 0 || 4+n > len(b) {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+
+	if _, ok := read(); !ok { // Proveedor
+		return
+	}
+	if len(b) < 4 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+
+	for i := 0; i < count; i++ {
+		field, ok := read()
+		if !ok {
+			return
+		}
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			m.Title = value
+		case "ARTIST", "ARTISTS":
+			m.addArtists(value)
+		case "ALBUM":
+			m.Album = value
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			m.AlbumArtist = value
+		case "TRACKNUMBER":
+			m.TrackNumber = parseNumber(value)
+		case "DISCNUMBER":
+			m.DiscNumber = parseNumber(value)
+		case "ISRC":
+			m.ISRC = value
+		case "METADATA_BLOCK_PICTURE":
+			if raw, err := base64.StdEncoding.DecodeString(value); err == nil {
+				m.setCover(parseFLACPicture(raw))
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package tags
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Tamaño máximo de etiqueta ID3 que aceptamos (portadas incluidas)
+const maxID3Size = 32 << 20
+
+var errBadID3 = errors.New("etiqueta ID3v2 inválida")
+
+// readID3v2 lee la etiqueta ID3v2 del inicio del archivo y devuelve cuántos bytes ocupa.
+// Soporta las versiones 2.2, 2.3 y 2.4.
+func readID3v2(r io.Reader, m *Metadata) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(header, []byte("ID3")) {
+		return 0, errBadID3
+	}
+
+	version, flags := header[3], header[5]
+	size := syncsafe(header[6:10])
+	total := int64(10 + size)
+	if flags&0x10 != 0 {
+		total += 10 // Pie de etiqueta (solo 2.4)
+	}
+	if size > maxID3Size || version < 2 || version > 4 {
+		return total, errBadID3
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return total, err
+	}
+
+	// En 2.2 y 2.3 la desincronización se aplica a toda la etiqueta; en 2.4, por frame
+	if flags&0x80 != 0 && version < 4 {
+		body = unsynchronise(body)
+	}
+	if flags&0x40 != 0 && version > 2 {
+		body = skipExtendedHeader(body, version)
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var frameSize int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			frameSize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(body[4:8]))
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		case 4:
+			frameSize = syncsafe(body[4:8])
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		}
+		if frameSize < 0 || headerLen+frameSize > len(body) {
+			break
+		}
+
+		data := body[headerLen : headerLen+frameSize]
+		body = body[headerLen+frameSize:]
+
+		data, ok := frameContent(data, version, frameFlags, flags&0x80 != 0)
+		if ok {
+			applyID3Frame(m, id, data, version)
+		}
+	}
+	return total, nil
+}
+
+// frameContent quita agrupación, indicador de longitud, desincronización y compresión
+func frameContent(data []byte, version byte, flags uint16, globalUnsync bool) ([]byte, bool) {
+	var grouped, compressed, encrypted, unsync, lengthIndicator bool
+	switch version {
+	case 3:
+		compressed, encrypted, grouped = flags&0x0080 != 0, flags&0x0040 != 0, flags&0x0020 != 0
+		lengthIndicator = compressed // En 2.3 la compresión añade el tamaño descomprimido
+	case 4:
+		grouped, compressed, encrypted = flags&0x0040 != 0, flags&0x0008 != 0, flags&0x0004 != 0
+		unsync, lengthIndicator = flags&0x0002 != 0 || globalUnsync, flags&0x0001 != 0
+	}
+	if encrypted {
+		return nil, false
+	}
+	if grouped {
+		if len(data) < 1 {
+			return nil, false
+		}
+		data = data[1:]
+	}
+	if lengthIndicator {
+		if len(data) < 4 {
+			return nil, false
+		}
+		data = data[4:]
+	}
+	if unsync {
+		data = unsynchronise(data)
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, false
+		}
+		defer zr.Close()
+		out, err := io.ReadAll(io.LimitReader(zr, maxID3Size))
+		if err != nil {
+			return nil, false
+		}
+		data = out
+	}
+	return data, true
+}
+
+// applyID3Frame copia a Metadata los frames que nos interesan
+func applyID3Frame(m *Metadata, id string, data []byte, version byte) {
+	switch id {
+	case "TIT2", "TT2":
+		m.Title = firstValue(decodeID3Text(data))
+	case "TPE1", "TP1":
+		m.addArtists(decodeID3Text(data)...)
+	case "TALB", "TAL":
+		m.Album = firstValue(decodeID3Text(data))
+	case "TPE2", "TP2":
+		m.AlbumArtist = firstValue(decodeID3Text(data))
+	case "TRCK", "TRK":
+		m.TrackNumber = parseNumber(firstValue(decodeID3Text(data)))
+	case "TPOS", "TPA":
+		m.DiscNumber = parseNumber(firstValue(decodeID3Text(data)))
+	case "TSRC", "TRC":
+		m.ISRC = firstValue(decodeID3Text(data))
+	case "TLEN", "TLE":
+		// Duración en milisegundos; solo como respaldo si no podemos calcularla
+		if ms, err := strconv.Atoi(firstValue(decodeID3Text(data))); err == nil && m.DurationMs == 0 {
+			m.DurationMs = ms
+		}
+	case "APIC":
+		m.setCover(parseAPIC(data))
+	case "PIC":
+		m.setCover(parsePIC(data))
+	}
+}
+
+// parseAPIC: codificación, MIME\0, tipo de imagen, descripción\0, datos
+func parseAPIC(data []byte) (*Picture, bool) {
+	if len(data) < 4 {
+		return nil, false
+	}
+	enc := data[0]
+	mime, rest := splitTerminated(0, data[1:])
+	if len(rest) < 1 {
+		return nil, false
+	}
+	picType := rest[0]
+	_, image := splitTerminated(enc, rest[1:])
+	return &Picture{MIMEType: sniffMIME(image, string(mime)), Data: image}, picType == 3
+}
+
+// parsePIC (ID3v2.2): codificación, formato de 3 letras, tipo, descripción\0, datos
+func parsePIC(data []byte) (*Picture, bool) {
+	if len(data) < 6 {
+		return nil, false
+	}
+	enc, format, picType := data[0], string(data[1:4]), data[4]
+	_, image := splitTerminated(enc, data[5:])
+	return &Picture{MIMEType: sniffMIME(image, format), Data: image}, picType == 3
+}
+
+// decodeID3Text decodifica un frame de texto; 2.4 permite varios valores separados por \0
+func decodeID3Text(data []byte) []string {
+	if len(data) < 1 {
+		return nil
+	}
+	enc, raw := data[0], data[1:]
+
+	var values []string
+	for len(raw) > 0 {
+		var value []byte
+		value, raw = splitTerminated(enc, raw)
+		if s := strings.TrimSpace(decodeString(enc, value)); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// splitTerminated corta en el primer terminador (\0, o \0\0 alineado en UTF-16)
+func splitTerminated(enc byte, b []byte) (value, rest []byte) {
+	if enc == 1 || enc == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+		return b, nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
+// decodeString: 0 = ISO-8859-1, 1 = UTF-16 con BOM, 2 = UTF-16BE, 3 = UTF-8
+func decodeString(enc byte, b []byte) string {
+	switch enc {
+	case 0:
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	case 1, 2:
+		bigEndian := enc == 2
+		if len(b) >= 2 {
+			switch {
+			case b[0] == 0xFF && b[1] == 0xFE:
+				bigEndian, b = false, b[2:]
+			case b[0] == 0xFE && b[1] == 0xFF:
+				bigEndian, b = true, b[2:]
+			}
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			if bigEndian {
+				units[i] = binary.BigEndian.Uint16(b[2*i:])
+			} else {
+				units[i] = binary.LittleEndian.Uint16(b[2*i:])
+			}
+		}
+		return string(utf16.Decode(units))
+	}
+	return string(b)
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// syncsafe decodifica un entero de 28 bits repartido en 4 bytes de 7 bits
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// unsynchronise deshace el esquema de desincronización (0xFF 0x00 -> 0xFF)
+func unsynchronise(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+func skipExtendedHeader(body []byte, version byte) []byte {
+	if len(body) < 4 {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint32(body[:4])) + 4 // 2.3: el tamaño no se incluye a sí mismo
+	if version == 4 {
+		size = syncsafe(body[:4])
+	}
+	if size > len(body) {
+		return nil
+	}
+	return body[size:]
+}
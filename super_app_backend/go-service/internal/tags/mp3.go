@@ -0,0 +1,201 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Cuánto buscamos el primer frame MPEG después de la etiqueta
+const mp3SyncSearch = 64 << 10
+
+var errNoMPEGFrame = errors.New("no se encontró audio MPEG")
+
+// Kbps por índice [versión MPEG1?][capa 1..3]
+var mpegBitrates = map[bool][3][16]int{
+	true: {
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	false: {
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// Hz por índice según la versión (bits 19-20 de la cabecera: 3 = MPEG1, 2 = MPEG2, 0 = MPEG2.5)
+var mpegSampleRates = map[uint32][3]int{
+	3: {44100, 48000, 32000},
+	2: {22050, 24000, 16000},
+	0: {11025, 12000, 8000},
+}
+
+func readMP3(r io.ReadSeeker) (*Metadata, error) {
+	m := &Metadata{Format: "mp3"}
+
+	var audioStart int64
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(head, []byte("ID3")) {
+		n, err := readID3v2(r, m)
+		if err != nil && n == 0 {
+			return nil, err
+		}
+		audioStart = n
+	}
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Algunos FLAC llevan una etiqueta ID3 delante
+	if _, err := r.Seek(audioStart, io.SeekStart); err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err == nil && bytes.Equal(magic, []byte("fLaC")) {
+		if _, err := r.Seek(audioStart, io.SeekStart); err != nil {
+			return nil, err
+		}
+		flac, err := readFLAC(r)
+		if err != nil {
+			return nil, err
+		}
+		mergeMissing(flac, m)
+		return flac, nil
+	}
+
+	// Una etiqueta ID3v1 al final no es audio
+	audioEnd := size
+	if size >= 128 {
+		tag := make([]byte, 3)
+		if _, err := r.Seek(size-128, io.SeekStart); err == nil {
+			if _, err := io.ReadFull(r, tag); err == nil && bytes.Equal(tag, []byte("TAG")) {
+				audioEnd -= 128
+			}
+		}
+	}
+
+	if ms, err := mp3Duration(r, audioStart, audioEnd); err == nil {
+		m.DurationMs = ms
+	} else if m.DurationMs == 0 {
+		return m, err
+	}
+	return m, nil
+}
+
+// mp3Duration usa la cabecera Xing/Info o VBRI si existe (VBR) y si no estima
+// por el bitrate del primer frame (CBR)
+func mp3Duration(r io.ReadSeeker, start, end int64) (int, error) {
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, mp3SyncSearch)
+	n, _ := io.ReadFull(r, buf)
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		h := binary.BigEndian.Uint32(buf[i:])
+		version := (h >> 19) & 3
+		layer := 4 - int((h>>17)&3) // 1, 2 o 3
+		bitrateIdx := (h >> 12) & 0xF
+		rateIdx := (h >> 10) & 3
+		mono := (h>>6)&3 == 3
+		if version == 1 || layer == 4 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+			continue // Cabecera imposible: falso positivo
+		}
+
+		mpeg1 := version == 3
+		sampleRate := mpegSampleRates[version][rateIdx]
+		bitrate := mpegBitrates[mpeg1][layer-1][bitrateIdx] * 1000
+		samplesPerFrame := 1152
+		switch {
+		case layer == 1:
+			samplesPerFrame = 384
+		case layer == 3 && !mpeg1:
+			samplesPerFrame = 576
+		}
+
+		frame := buf[i:]
+		if frames := vbrFrameCount(frame, mpeg1, mono); frames > 0 {
+			return int(int64(frames) * int64(samplesPerFrame) * 1000 / int64(sampleRate)), nil
+		}
+
+		audioBytes := end - start - int64(i)
+		if audioBytes <= 0 {
+			return 0, errNoMPEGFrame
+		}
+		return int(audioBytes * 8 * 1000 / int64(bitrate)), nil
+	}
+	return 0, errNoMPEGFrame
+}
+
+// vbrFrameCount lee el total de frames de la cabecera Xing/Info o VBRI (0 si no hay)
+func vbrFrameCount(frame []byte, mpeg1, mono bool) uint32 {
+	// La cabecera Xing va después de la información lateral
+	sideInfo := 32
+	switch {
+	case mpeg1 && mono:
+		sideInfo = 17
+	case !mpeg1 && mono:
+		sideInfo = 9
+	case !mpeg1:
+		sideInfo = 17
+	}
+	if x := frame[min(4+sideInfo, len(frame)):]; len(x) >= 12 &&
+		(bytes.HasPrefix(x, []byte("Xing")) || bytes.HasPrefix(x, []byte("Info"))) {
+		flags := binary.BigEndian.Uint32(x[4:8])
+		if flags&1 != 0 {
+			return binary.BigEndian.Uint32(x[8:12])
+		}
+	}
+
+	// VBRI (Fraunhofer) siempre a 32 bytes de la cabecera
+	if v := frame[min(36, len(frame)):]; len(v) >= 18 && bytes.HasPrefix(v, []byte("VBRI")) {
+		return binary.BigEndian.Uint32(v[14:18])
+	}
+	return 0
+}
+
+// mergeMissing completa los campos vacíos de dst con los de src
+func mergeMissing(dst, src *Metadata) {
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if len(dst.Artists) == 0 {
+		dst.Artists = src.Artists
+	}
+	if dst.Album == "" {
+		dst.Album = src.Album
+	}
+	if dst.AlbumArtist == "" {
+		dst.AlbumArtist = src.AlbumArtist
+	}
+	if dst.TrackNumber == 0 {
+		dst.TrackNumber = src.TrackNumber
+	}
+	if dst.DiscNumber == 0 {
+		dst.DiscNumber = src.DiscNumber
+	}
+	if dst.ISRC == "" {
+		dst.ISRC = src.ISRC
+	}
+	if dst.DurationMs == 0 {
+		dst.DurationMs = src.DurationMs
+	}
+	if dst.Cover == nil {
+		dst.Cover = src.Cover
+	}
+}
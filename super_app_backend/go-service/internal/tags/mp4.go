@@ -0,0 +1,204 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// El átomo moov (con portada) cabe de sobra en esto; el audio (mdat) lo saltamos
+const maxMoovSize = 64 << 20
+
+var errBadMP4 = errors.New("archivo MP4 inválido")
+
+// atom es una caja MP4: tamaño, tipo y contenido
+type atom struct {
+	kind string
+	data []byte
+}
+
+func readMP4(r io.ReadSeeker) (*Metadata, error) {
+	moov, err := findTopLevelAtom(r, "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{Format: "mp4"}
+	for _, a := range parseAtoms(moov) {
+		switch a.kind {
+		case "mvhd":
+			m.DurationMs = mvhdDuration(a.data)
+		case "meta":
+			parseMeta(m, a.data)
+		case "udta":
+			for _, u := range parseAtoms(a.data) {
+				if u.kind == "meta" {
+					parseMeta(m, u.data)
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// findTopLevelAtom recorre las cajas de primer nivel saltando las que no interesan
+func findTopLevelAtom(r io.ReadSeeker, kind string) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, errBadMP4
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		headerLen := int64(8)
+		switch size {
+		case 1: // Tamaño de 64 bits a continuación
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(r, ext); err != nil {
+				return nil, errBadMP4
+			}
+			size, headerLen = int64(binary.BigEndian.Uint64(ext)), 16
+		case 0: // Hasta el final del archivo
+			if string(header[4:]) != kind {
+				return nil, errBadMP4
+			}
+			return io.ReadAll(io.LimitReader(r, maxMoovSize))
+		}
+		if size < headerLen {
+			return nil, errBadMP4
+		}
+
+		if string(header[4:]) == kind {
+			if size-headerLen > maxMoovSize {
+				return nil, errBadMP4
+			}
+			data := make([]byte, size-headerLen)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, errBadMP4
+			}
+			return data, nil
+		}
+		if _, err := r.Seek(size-headerLen, io.SeekCurrent); err != nil {
+			return nil, errBadMP4
+		}
+	}
+}
+
+// parseAtoms separa las cajas hijas de un contenido ya leído
+func parseAtoms(b []byte) []atom {
+	var atoms []atom
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		headerLen := 8
+		if size == 1 && len(b) >= 16 {
+			size, headerLen = int(binary.BigEndian.Uint64(b[8:16])), 16
+		} else if size == 0 {
+			size = len(b)
+		}
+		if size < headerLen || size > len(b) {
+			break
+		}
+		atoms = append(atoms, atom{kind: string(b[4:8]), data: b[headerLen:size]})
+		b = b[size:]
+	}
+	return atoms
+}
+
+// mvhdDuration: versión 0 con campos de 32 bits, versión 1 con campos de 64 bits
+func mvhdDuration(b []byte) int {
+	if len(b) < 20 {
+		return 0
+	}
+	var timescale, duration uint64
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+	if timescale == 0 {
+		return 0
+	}
+	return int(duration * 1000 / timescale)
+}
+
+// parseMeta lee la lista de etiquetas de iTunes (meta/ilst)
+func parseMeta(m *Metadata, b []byte) {
+	// meta es una "full box" (4 bytes de versión y flags), salvo en algunos
+	// archivos de QuickTime que empiezan directamente con las cajas hijas
+	if len(b) >= 8 && string(b[4:8]) != "hdlr" {
+		b = b[min(4, len(b)):]
+	}
+
+	for _, a := range parseAtoms(b) {
+		if a.kind != "ilst" {
+			continue
+		}
+		for _, item := range parseAtoms(a.data) {
+			applyMP4Item(m, item)
+		}
+	}
+}
+
+func applyMP4Item(m *Metadata, item atom) {
+	var name string
+	var values []atom
+	for _, child := range parseAtoms(item.data) {
+		switch child.kind {
+		case "data":
+			values = append(values, child)
+		case "name":
+			if len(child.data) > 4 {
+				name = string(child.data[4:])
+			}
+		}
+	}
+
+	for _, v := range values {
+		// data: tipo (4 bytes), idioma (4 bytes), valor
+		if len(v.data) < 8 {
+			continue
+		}
+		dataType := binary.BigEndian.Uint32(v.data[:4]) & 0xFFFFFF
+		value := v.data[8:]
+		text := strings.TrimSpace(string(value))
+
+		switch item.kind {
+		case "\xa9nam":
+			m.Title = text
+		case "\xa9ART":
+			m.addArtists(text)
+		case "\xa9alb":
+			m.Album = text
+		case "aART":
+			m.AlbumArtist = text
+		case "trkn":
+			if len(value) >= 4 {
+				m.TrackNumber = int(binary.BigEndian.Uint16(value[2:4]))
+			}
+		case "disk":
+			if len(value) >= 4 {
+				m.DiscNumber = int(binary.BigEndian.Uint16(value[2:4]))
+			}
+		case "covr":
+			mime := "image/jpeg"
+			if dataType == 14 {
+				mime = "image/png"
+			}
+			m.setCover(&Picture{MIMEType: sniffMIME(value, mime), Data: bytes.Clone(value)}, true)
+		case "----":
+			// Etiquetas libres: ----:com.apple.iTunes:ISRC
+			if strings.EqualFold(name, "ISRC") {
+				m.ISRC = text
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// Las cabeceras con portada pueden ocupar varias páginas
+	maxOggHeader = 32 << 20
+	// Cuánto leemos del final para encontrar la última página
+	oggTailSearch = 128 << 10
+)
+
+var errBadOgg = errors.New("archivo Ogg inválido")
+
+// oggReader reconstruye los paquetes del primer flujo lógico de un Ogg
+type oggReader struct {
+	r       io.Reader
+	serial  uint32
+	started bool
+	pending []byte
+	packets [][]byte
+	read    int
+}
+
+// nextPacket devuelve el siguiente paquete completo
+func (o *oggReader) nextPacket() ([]byte, error) {
+	for len(o.packets) == 0 {
+		if err := o.readPage(); err != nil {
+			return nil, err
+		}
+	}
+	p := o.packets[0]
+	o.packets = o.packets[1:]
+	return p, nil
+}
+
+func (o *oggReader) readPage() error {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		return errBadOgg
+	}
+	if !bytes.HasPrefix(header, []byte("OggS")) {
+		return errBadOgg
+	}
+	serial := binary.LittleEndian.Uint32(header[14:18])
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(o.r, segments); err != nil {
+		return errBadOgg
+	}
+	size := 0
+	for _, s := range segments {
+		size += int(s)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(o.r, body); err != nil {
+		return errBadOgg
+	}
+
+	if !o.started {
+		o.serial, o.started = serial, true
+	}
+	if serial != o.serial {
+		return nil // Otro flujo multiplexado
+	}
+
+	o.read += size
+	if o.read > maxOggHeader {
+		return errBadOgg
+	}
+
+	// Un segmento de 255 significa que el paquete sigue en el siguiente segmento
+	offset := 0
+	for _, s := range segments {
+		o.pending = append(o.pending, body[offset:offset+int(s)]...)
+		offset += int(s)
+		if s < 255 {
+			o.packets = append(o.packets, o.pending)
+			o.pending = nil
+		}
+	}
+	return nil
+}
+
+func readOgg(r io.ReadSeeker) (*Metadata, error) {
+	o := &oggReader{r: r}
+
+	id, err := o.nextPacket()
+	if err != nil {
+		return nil, err
+	}
+	comments, err := o.nextPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{}
+	var sampleRate, preSkip int64
+	switch {
+	case bytes.HasPrefix(id, []byte("\x01vorbis")) && len(id) >= 16:
+		m.Format = "vorbis"
+		sampleRate = int64(binary.LittleEndian.Uint32(id[12:16]))
+		if !bytes.HasPrefix(comments, []byte("\x03vorbis")) {
+			return nil, errBadOgg
+		}
+		parseVorbisComment(m, comments[7:])
+	case bytes.HasPrefix(id, []byte("OpusHead")) && len(id) >= 12:
+		m.Format = "opus"
+		sampleRate = 48000 // La posición en Opus siempre va a 48 kHz
+		preSkip = int64(binary.LittleEndian.Uint16(id[10:12]))
+		if !bytes.HasPrefix(comments, []byte("OpusTags")) {
+			return nil, errBadOgg
+		}
+		parseVorbisComment(m, comments[8:])
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	if granule := lastGranule(r, o.serial); granule > preSkip && sampleRate > 0 {
+		m.DurationMs = int((granule - preSkip) * 1000 / sampleRate)
+	}
+	return m, nil
+}
+
+// lastGranule busca la última página del flujo: su posición es el total de muestras
+func lastGranule(r io.ReadSeeker, serial uint32) int64 {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0
+	}
+	start := max(size-oggTailSearch, 0)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil {
+		return 0
+	}
+
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		page := tail[i:]
+		if len(page) < 27 || binary.LittleEndian.Uint32(page[14:18]) != serial {
+			continue
+		}
+		granule := int64(binary.LittleEndian.Uint64(page[6:14]))
+		if granule >= 0 {
+			return granule
+		}
+	}
+	return 0
+}
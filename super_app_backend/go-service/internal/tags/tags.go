@@ -0,0 +1,126 @@
+// Package tags lee los metadatos de archivos de audio (ID3v2, comentarios
+// Vorbis de FLAC/Ogg y átomos de MP4) y calcula su duración, sin dependencias
+// externas ni decodificar el audio.
+package tags
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownFormat indica que el archivo no es un formato de audio soportado
+var ErrUnknownFormat = errors.New("formato de audio no reconocido")
+
+// Metadata es lo que sabemos de un archivo por sus etiquetas
+type Metadata struct {
+	Format      string // "mp3", "flac", "vorbis", "opus" o "mp4"
+	Title       string
+	Artists     []string // El primero es el principal
+	Album       string
+	AlbumArtist string
+	TrackNumber int
+	DiscNumber  int
+	ISRC        string
+	DurationMs  int
+	Cover       *Picture
+
+	coverIsFront bool
+}
+
+// Picture es una imagen incrustada (la portada)
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// Read abre y lee un archivo de audio
+func Read(path string) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadFrom(f)
+}
+
+// ReadFrom detecta el formato por los primeros bytes y lee sus etiquetas
+func ReadFrom(r io.ReadSeeker) (*Metadata, error) {
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, ErrUnknownFormat
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")), head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		return readMP3(r)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return readFLAC(r)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return readOgg(r)
+	case bytes.Equal(head[4:8], []byte("ftyp")):
+		return readMP4(r)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// addArtists agrega artistas sin repetir y sin vacíos
+func (m *Metadata) addArtists(names ...string) {
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		dup := false
+		for _, a := range m.Artists {
+			dup = dup || strings.EqualFold(a, name)
+		}
+		if !dup {
+			m.Artists = append(m.Artists, name)
+		}
+	}
+}
+
+// setCover se queda con la primera portada frontal (o con la primera imagen si no hay)
+func (m *Metadata) setCover(p *Picture, front bool) {
+	if p == nil || len(p.Data) == 0 {
+		return
+	}
+	if m.Cover != nil && (m.coverIsFront || !front) {
+		return
+	}
+	m.Cover, m.coverIsFront = p, front
+}
+
+// parseNumber entiende "3", "3/12" y " 03 "
+func parseNumber(s string) int {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+// sniffMIME deduce el tipo de imagen si la etiqueta no lo dice
+func sniffMIME(data []byte, declared string) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG")):
+		return "image/png"
+	}
+	declared = strings.ToLower(declared)
+	switch declared {
+	case "jpg", "jpeg", "image/jpg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	}
+	return declared
+}
@@ -0,0 +1,354 @@
+// Package transcode convierte un master de audio en renditions HLS (AAC en
+// varios bitrates y FLAC) usando el ffmpeg instalado en el servidor.
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rendition es una calidad de audio que generamos
+type Rendition struct {
+	Quality string   // Igual que en tracks.available_qualities: "AAC_64", "FLAC"...
+	Codecs  string   // Atributo CODECS del master playlist (RFC 6381)
+	Args    []string // Códec y bitrate para ffmpeg
+}
+
+// Renditions son las calidades que produce el pipeline, de menor a mayor
+var Renditions = []Rendition{
+	{"AAC_64", "mp4a.40.2", []string{"-c:a", "aac", "-b:a", "64k", "-ar", "44100", "-ac", "2"}},
+	{"AAC_160", "mp4a.40.2", []string{"-c:a", "aac", "-b:a", "160k", "-ar", "44100", "-ac", "2"}},
+	{"AAC_320", "mp4a.40.2", []string{"-c:a", "aac", "-b:a", "320k", "-ar", "44100", "-ac", "2"}},
+	// FLAC en fMP4 necesita -strict en versiones de ffmpeg anteriores a la 6
+	{"FLAC", "fLaC", []string{"-c:a", "flac", "-strict", "experimental"}},
+}
+
+// PreviewQuality es la rendition con el fragmento de vista previa
+const PreviewQuality = "PREVIEW"
+
+// Variant es una rendition ya generada, con el bitrate medido en sus segmentos
+type Variant struct {
+	Quality          string
+	Codecs           string
+	Playlist         string // Ruta relativa a la carpeta de salida: "AAC_64/index.m3u8"
+	Bandwidth        int    // Pico por segmento (bits/s), lo que exige BANDWIDTH
+	AverageBandwidth int
+}
+
+// Output es el resultado de codificar un master
+type Output struct {
+	Dir        string
+	Variants   []Variant
+	DurationMs int
+}
+
+// Encryption cifra los segmentos con AES-128 (METHOD=AES-128 de HLS)
+type Encryption struct {
+	KeyURI string // Lo que se escribe en el URI de #EXT-X-KEY
+	Key    []byte // 16 bytes
+}
+
+// GenerateKey crea una clave de contenido AES-128 aleatoria
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// Encoder llama a ffmpeg
+type Encoder struct {
+	FFmpeg         string
+	SegmentSeconds int
+	// Ventana de la vista previa por defecto y duración de los fundidos
+	PreviewStart  time.Duration
+	PreviewLength time.Duration
+	PreviewFade   time.Duration
+}
+
+// NewEncoder usa FFMPEG_PATH o el ffmpeg del PATH, con segmentos de 6 segundos
+// y vistas previas de 30 s desde el segundo 30 (PREVIEW_START, PREVIEW_LENGTH)
+func NewEncoder() *Encoder {
+	bin := os.Getenv("FFMPEG_PATH")
+	if bin == "" {
+		bin = "ffmpeg"
+	}
+	e := &Encoder{FFmpeg: bin, SegmentSeconds: 6,
+		PreviewStart: 30 * time.Second, PreviewLength: 30 * time.Second, PreviewFade: 2 * time.Second}
+	if d, err := time.ParseDuration(os.Getenv("PREVIEW_START")); err == nil && d >= 0 {
+		e.PreviewStart = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("PREVIEW_LENGTH")); err == nil && d > 0 {
+		e.PreviewLength = d
+	}
+	return e
+}
+
+// Available comprueba que ffmpeg esté instalado
+func (e *Encoder) Available() error {
+	if _, err := exec.LookPath(e.FFmpeg); err != nil {
+		return fmt.Errorf("no se encontró ffmpeg (%s): %w", e.FFmpeg, err)
+	}
+	return nil
+}
+
+// Encode genera todas las renditions del master en outDir y escribe master.m3u8.
+// Cada rendition con clave en keys (por calidad) se cifra con la suya: así una
+// clave entregada para AAC_64 no sirve para descifrar los segmentos FLAC.
+func (e *Encoder) Encode(ctx context.Context, master, outDir string, keys map[string]*Encryption) (*Output, error) {
+	if err := e.Available(); err != nil {
+		return nil, err
+	}
+
+	out := &Output{Dir: outDir}
+	for _, r := range Renditions {
+		dir := filepath.Join(outDir, r.Quality)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := e.runEncrypted(ctx, master, dir, r, keys[r.Quality]); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Quality, err)
+		}
+
+		playlist := filepath.Join(dir, "index.m3u8")
+		peak, avg, durationMs, err := measure(playlist)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Quality, err)
+		}
+		out.Variants = append(out.Variants, Variant{
+			Quality:          r.Quality,
+			Codecs:           r.Codecs,
+			Playlist:         r.Quality + "/index.m3u8",
+			Bandwidth:        peak,
+			AverageBandwidth: avg,
+		})
+		out.DurationMs = durationMs
+	}
+
+	master3u8 := MasterPlaylist(out.Variants, func(v Variant) string { return v.Playlist })
+	if err := os.WriteFile(filepath.Join(outDir, "master.m3u8"), []byte(master3u8), 0o644); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EncodePreview corta la ventana de vista previa (con fundido de entrada y de
+// salida) en su propia rendition AAC sin cifrar, en outDir/PREVIEW. start < 0
+// usa PreviewStart; la ventana se ajusta para no pasarse del final del tema.
+func (e *Encoder) EncodePreview(ctx context.Context, master, outDir string, start time.Duration, durationMs int) (*Variant, error) {
+	if err := e.Available(); err != nil {
+		return nil, err
+	}
+	start, length := e.previewWindow(start, time.Duration(durationMs)*time.Millisecond)
+	fade := min(e.PreviewFade, length/4)
+	seconds := func(d time.Duration) string { return strconv.FormatFloat(d.Seconds(), 'f', 3, 64) }
+
+	r := Rendition{Quality: PreviewQuality, Codecs: "mp4a.40.2", Args: []string{
+		"-ss", seconds(start), "-t", seconds(length),
+		"-af", fmt.Sprintf("afade=t=in:st=0:d=%s,afade=t=out:st=%s:d=%s", seconds(fade), seconds(length-fade), seconds(fade)),
+		"-c:a", "aac", "-b:a", "160k", "-ar", "44100", "-ac", "2",
+	}}
+	dir := filepath.Join(outDir, r.Quality)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := e.run(ctx, master, dir, r, ""); err != nil {
+		return nil, fmt.Errorf("%s: %w", r.Quality, err)
+	}
+	peak, avg, _, err := measure(filepath.Join(dir, "index.m3u8"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", r.Quality, err)
+	}
+	return &Variant{Quality: r.Quality, Codecs: r.Codecs, Playlist: r.Quality + "/index.m3u8", Bandwidth: peak, AverageBandwidth: avg}, nil
+}
+
+// previewWindow ajusta la ventana a la duración del tema (si se conoce)
+func (e *Encoder) previewWindow(start, duration time.Duration) (time.Duration, time.Duration) {
+	if start < 0 {
+		start = e.PreviewStart
+	}
+	length := e.PreviewLength
+	if duration > 0 {
+		length = min(length, duration)
+		start = max(0, min(start, duration-length))
+	}
+	return start, length
+}
+
+// DecodePCM decodifica el audio de input a float32 little-endian intercalado,
+// a la frecuencia y canales pedidos, y lo escribe en w (p. ej. un medidor)
+func (e *Encoder) DecodePCM(ctx context.Context, input string, sampleRate, channels int, w io.Writer) error {
+	if err := e.Available(); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.FFmpeg, "-hide_banner", "-loglevel", "error", "-nostdin",
+		"-i", input, "-map", "0:a:0", "-vn",
+		"-ac", strconv.Itoa(channels), "-ar", strconv.Itoa(sampleRate), "-f", "f32le", "-")
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// lastLine recorta la salida de error de ffmpeg a algo que quepa en un log
+func lastLine(stderr string) string {
+	msg := strings.TrimSpace(stderr)
+	if len(msg) > 500 {
+		msg = msg[len(msg)-500:]
+	}
+	return msg
+}
+
+// writeKeyInfo escribe la clave y el "key info file" de ffmpeg (URI y ruta de
+// la clave; sin IV, así se usa el número de segmento como manda HLS) fuera de
+// la carpeta de salida, para que la clave nunca se suba con los segmentos
+func writeKeyInfo(enc *Encryption) (string, error) {
+	if len(enc.Key) != 16 {
+		return "", fmt.Errorf("la clave AES-128 debe tener 16 bytes, tiene %d", len(enc.Key))
+	}
+	dir, err := os.MkdirTemp("", "hls-key-")
+	if err != nil {
+		return "", err
+	}
+	keyFile := filepath.Join(dir, "content.key")
+	if err := os.WriteFile(keyFile, enc.Key, 0o600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	keyInfo := filepath.Join(dir, "keyinfo")
+	if err := os.WriteFile(keyInfo, []byte(enc.KeyURI+"\n"+keyFile+"\n"), 0o600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return keyInfo, nil
+}
+
+// runEncrypted es run con la clave de la rendition (sin cifrar si enc es nil)
+func (e *Encoder) runEncrypted(ctx context.Context, master, dir string, r Rendition, enc *Encryption) error {
+	if enc == nil {
+		return e.run(ctx, master, dir, r, "")
+	}
+	keyInfo, err := writeKeyInfo(enc)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(filepath.Dir(keyInfo))
+	return e.run(ctx, master, dir, r, keyInfo)
+}
+
+// run produce una rendition en segmentos fMP4 (init.mp4 + seg_00000.m4s...)
+func (e *Encoder) run(ctx context.Context, master, dir string, r Rendition, keyInfo string) error {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin", "-y",
+		"-i", master, "-map", "0:a:0", "-vn"}
+	args = append(args, r.Args...)
+	if keyInfo != "" {
+		args = append(args, "-hls_key_info_file", keyInfo)
+	}
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(e.SegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", "init.mp4",
+		"-hls_segment_filename", filepath.Join(dir, "seg_%05d.m4s"),
+		filepath.Join(dir, "index.m3u8"),
+	)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.FFmpeg, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// measure lee una media playlist y calcula el bitrate pico y medio de sus segmentos
+func measure(playlist string) (peak, avg, durationMs int, err error) {
+	f, err := os.Open(playlist)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(playlist)
+	var totalBytes int64
+	var totalSeconds, segSeconds float64
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			segSeconds, _ = strconv.ParseFloat(value, 64)
+		case line != "" && !strings.HasPrefix(line, "#"):
+			info, err := os.Stat(filepath.Join(dir, line))
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			totalBytes += info.Size()
+			totalSeconds += segSeconds
+			if segSeconds > 0 {
+				peak = max(peak, int(float64(info.Size())*8/segSeconds))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, 0, err
+	}
+	if totalSeconds == 0 {
+		return 0, 0, 0, fmt.Errorf("playlist sin segmentos: %s", playlist)
+	}
+	return peak, int(float64(totalBytes) * 8 / totalSeconds), int(totalSeconds * 1000), nil
+}
+
+// MasterPlaylist escribe el master .m3u8 con las variantes dadas; uri decide a
+// dónde apunta cada una (ruta relativa al generar, URL absoluta al servirlo)
+func MasterPlaylist(variants []Variant, uri func(Variant) string) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, v := range variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,CODECS=\"%s\"\n%s\n",
+			v.Bandwidth, v.AverageBandwidth, v.Codecs, uri(v))
+	}
+	return b.String()
+}
+
+// RewriteURIs cambia cada URI de una media playlist por lo que devuelva fn; tag
+// es "" para los segmentos y "#EXT-X-MAP" o "#EXT-X-KEY" para el atributo URI
+// de esas etiquetas. El resto de líneas queda igual.
+func RewriteURIs(playlist string, fn func(tag, uri string) string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(playlist, "\n") {
+		text := strings.TrimRight(line, "\r\n")
+		eol := line[len(text):]
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, "#EXT-X-MAP:"), strings.HasPrefix(text, "#EXT-X-KEY:"):
+			tag, _, _ := strings.Cut(text, ":")
+			if start := strings.Index(text, `URI="`); start >= 0 {
+				start += len(`URI="`)
+				if end := strings.IndexByte(text[start:], '"'); end >= 0 {
+					text = text[:start] + fn(tag, text[start:start+end]) + text[start+end:]
+				}
+			}
+		case !strings.HasPrefix(text, "#"):
+			text = fn("", strings.TrimSpace(text))
+		}
+		b.WriteString(text + eol)
+	}
+	return b.String()
+}
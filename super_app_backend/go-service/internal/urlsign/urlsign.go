@@ -0,0 +1,150 @@
+// Package urlsign firma con HMAC-SHA256 las URLs de streaming para que solo
+// sirvan al usuario que las pidió, para una canción y hasta una hora dada.
+//
+// La firma viaja en la query (uid, exp, ip, r, kid, sig) y cubre la canción, así
+// que la misma firma vale para el master y las media playlists de esa canción.
+// r ata además la firma a una rendition: es la que llevan los segmentos, para
+// que nadie cambie AAC_64 por FLAC en la ruta. kid indica con qué clave se firmó: se puede rotar el secreto
+// dejando las claves viejas solo para verificar hasta que caduquen sus URLs.
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissing   = errors.New("la URL no está firmada")
+	ErrUnknown   = errors.New("clave de firma desconocida")
+	ErrSignature = errors.New("firma inválida")
+	ErrExpired   = errors.New("la URL expiró")
+	ErrIP        = errors.New("la URL se firmó para otra IP")
+)
+
+// Claims es lo que garantiza una URL firmada
+type Claims struct {
+	UserID  string // "" para anónimos
+	TrackID string
+	Expires time.Time
+	IP      string // "" si no está atada a una IP
+	// Rendition ("AAC_64", "FLAC"...) a la que se limita la URL; "" = toda la canción
+	Rendition string
+}
+
+// Keyring guarda las claves de firma; la primera es la que firma
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyring arma un keyring desde "kid:secreto,kid:secreto"; la primera firma
+// y las demás solo verifican (rotación)
+func NewKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{keys: map[string][]byte{}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || len(secret) < 16 {
+			return nil, fmt.Errorf("clave de firma inválida %q: se espera kid:secreto (mínimo 16 caracteres)", kid)
+		}
+		if _, dup := k.keys[kid]; dup {
+			return nil, fmt.Errorf("clave de firma repetida: %s", kid)
+		}
+		if k.current == "" {
+			k.current = kid
+		}
+		k.keys[kid] = []byte(secret)
+	}
+	if k.current == "" {
+		return nil, errors.New("no hay claves de firma")
+	}
+	return k, nil
+}
+
+// FromEnv lee STREAM_SIGNING_KEYS. Sin configurar genera una clave aleatoria:
+// funciona, pero las URLs firmadas dejan de valer al reiniciar el servidor.
+func FromEnv() (*Keyring, error) {
+	spec := os.Getenv("STREAM_SIGNING_KEYS")
+	if spec == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		log.Println("⚠️  STREAM_SIGNING_KEYS no configurado: se usa una clave temporal")
+		spec = "dev:" + base64.RawURLEncoding.EncodeToString(secret)
+	}
+	return NewKeyring(spec)
+}
+
+// Sign devuelve los parámetros de query que firman las URLs de una canción
+func (k *Keyring) Sign(cl Claims) url.Values {
+	exp := strconv.FormatInt(cl.Expires.Unix(), 10)
+	q := url.Values{}
+	if cl.UserID != "" {
+		q.Set("uid", cl.UserID)
+	}
+	q.Set("exp", exp)
+	if cl.IP != "" {
+		q.Set("ip", cl.IP)
+	}
+	if cl.Rendition != "" {
+		q.Set("r", cl.Rendition)
+	}
+	q.Set("kid", k.current)
+	q.Set("sig", k.mac(k.keys[k.current], cl.TrackID, cl.UserID, exp, cl.IP, cl.Rendition))
+	return q
+}
+
+// Verify comprueba la firma de una URL de la canción trackID pedida desde clientIP
+func (k *Keyring) Verify(trackID string, q url.Values, clientIP string, now time.Time) (Claims, error) {
+	sig, kid, exp := q.Get("sig"), q.Get("kid"), q.Get("exp")
+	if sig == "" || exp == "" {
+		return Claims{}, ErrMissing
+	}
+	secret, ok := k.keys[kid]
+	if !ok {
+		return Claims{}, ErrUnknown
+	}
+
+	cl := Claims{UserID: q.Get("uid"), TrackID: trackID, IP: q.Get("ip"), Rendition: q.Get("r")}
+	if !hmac.Equal([]byte(sig), []byte(k.mac(secret, trackID, cl.UserID, exp, cl.IP, cl.Rendition))) {
+		return Claims{}, ErrSignature
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return Claims{}, ErrSignature
+	}
+	cl.Expires = time.Unix(unix, 0)
+	if now.After(cl.Expires) {
+		return Claims{}, ErrExpired
+	}
+	if cl.IP != "" && cl.IP != clientIP {
+		return Claims{}, ErrIP
+	}
+	return cl, nil
+}
+
+func (k *Keyring) mac(secret []byte, trackID, userID, exp, ip, rendition string) string {
+	h := hmac.New(sha256.New, secret)
+	// Separadores que no pueden aparecer en los valores: nada de ambigüedades.
+	// Sin rendition se mantiene v1, así siguen valiendo las URLs ya emitidas.
+	if rendition == "" {
+		fmt.Fprintf(h, "v1\n%s\n%s\n%s\n%s", trackID, userID, exp, ip)
+	} else {
+		fmt.Fprintf(h, "v2\n%s\n%s\n%s\n%s\n%s", trackID, userID, exp, ip, rendition)
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
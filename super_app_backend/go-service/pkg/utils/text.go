@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeText pasa a minúsculas, quita tildes y colapsa espacios.
+// "  Rosalía " y "rosalia" producen la misma clave.
+func NormalizeText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.Join(strings.Fields(strings.ToLower(folded)), " ")
+}
+
+// NameKey es la clave con la que se reconoce a un artista aunque llegue
+// escrito distinto: además de NormalizeText, "&" equivale a "and".
+// "Simon & Garfunkel" y "simon and garfunkel " producen la misma clave.
+func NameKey(s string) string {
+	s = strings.ReplaceAll(NormalizeText(s), "&", " and ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// SearchText es la forma con la que se buscan letras: NormalizeText, sin
+// apóstrofos ("don't" = "dont") y con cualquier signo que no sea letra o
+// número convertido en espacio. Se guarda en lyrics.search_text y se aplica
+// igual a la búsqueda y a cada palabra al resaltar, así coinciden siempre.
+func SearchText(s string) string {
+	s = strings.NewReplacer("'", "", "’", "", "‘", "", "ʼ", "", "`", "").Replace(NormalizeText(s))
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,12 @@
+package utils
+
+import "regexp"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IsUUID indica si s tiene forma de UUID (8-4-4-4-12 hexadecimal). Sirve para
+// responder 400 antes de comparar con una columna uuid, que con otro texto
+// fallaría en Postgres.
+func IsUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
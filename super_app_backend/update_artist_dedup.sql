@@ -0,0 +1,19 @@
+-- ACTUALIZACIÓN: Deduplicación de artistas
+-- name_key es el nombre normalizado (minúsculas, sin tildes, espacios
+-- colapsados, "&" = "and") con el que SyncTrack reconoce al artista. Lo
+-- calcula la API (utils.NameKey) al arrancar, antes de atender peticiones, y
+-- al crear artistas; no es único hasta que se fusionen los duplicados que ya
+-- existen (después se corre update_artist_name_key_unique.sql).
+ALTER TABLE artists ADD COLUMN IF NOT EXISTS name_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_artists_name_key ON artists (name_key);
+
+-- Artistas fusionados: los IDs viejos siguen resolviendo al que quedó
+CREATE TABLE IF NOT EXISTS artist_redirects (
+    old_id UUID PRIMARY KEY,
+    artist_id UUID NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+    merged_by UUID REFERENCES users(id),
+    merged_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_artist_redirects_artist ON artist_redirects (artist_id);
@@ -0,0 +1,25 @@
+-- ACTUALIZACIÓN: name_key único
+-- SyncTrack crea artistas con INSERT ... ON CONFLICT (name_key), así que dos
+-- nombres que solo difieren en mayúsculas o tildes ya no pueden duplicarse.
+-- Requiere update_artist_dedup.sql y que la API haya calculado name_key al
+-- arrancar (o "catalogctl artist-duplicates", que también la calcula).
+
+-- Si quedan duplicados el índice no se puede crear: hay que fusionarlos
+-- (catalogctl artist-duplicates los lista) antes de volver a correr esta migración.
+DO $$
+DECLARE
+    dup_keys INT;
+BEGIN
+    SELECT COUNT(*) INTO dup_keys FROM (
+        SELECT name_key FROM artists WHERE name_key IS NOT NULL GROUP BY name_key HAVING COUNT(*) > 1
+    ) d;
+
+    IF dup_keys > 0 THEN
+        RAISE EXCEPTION 'Hay % nombres de artista con duplicados sin fusionar. Fusiónalos antes de migrar.', dup_keys;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_artists_name_key ON artists (name_key);
+
+-- El índice único ya sirve para las búsquedas por name_key
+DROP INDEX IF EXISTS idx_artists_name_key;
@@ -0,0 +1,15 @@
+-- ACTUALIZACIÓN 1.3: Características de audio para recomendaciones y playlists inteligentes
+CREATE TABLE IF NOT EXISTS track_audio_features (
+    track_id UUID PRIMARY KEY REFERENCES tracks(id) ON DELETE CASCADE,
+    tempo_bpm REAL NOT NULL,
+    musical_key SMALLINT NOT NULL CHECK (musical_key BETWEEN 0 AND 11), -- 0 = C ... 11 = B
+    mode VARCHAR(5) NOT NULL CHECK (mode IN ('major', 'minor')),
+    key_confidence REAL NOT NULL,
+    energy REAL NOT NULL CHECK (energy BETWEEN 0 AND 1),
+    danceability REAL NOT NULL CHECK (danceability BETWEEN 0 AND 1),
+    analyzer_version INT NOT NULL,   -- Para reanalizar cuando cambie el algoritmo
+    analyzed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_track_audio_features_tempo ON track_audio_features (tempo_bpm);
+CREATE INDEX IF NOT EXISTS idx_track_audio_features_energy ON track_audio_features (energy, danceability);
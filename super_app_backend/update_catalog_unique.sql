@@ -0,0 +1,26 @@
+-- ACTUALIZACIÓN: Claves únicas del catálogo para que la sincronización
+-- pueda hacer upserts (INSERT ... ON CONFLICT) sin crear duplicados.
+-- Son las mismas claves con las que SyncTrack reconocía entidades existentes:
+--   artista = nombre, álbum = (artista, título), canción = (álbum, título)
+
+-- Si ya hay duplicados el índice no se puede crear: avisamos cuáles son
+-- para fusionarlos a mano antes de volver a correr esta migración.
+DO $$
+DECLARE
+    dup_artists INT;
+    dup_albums INT;
+    dup_tracks INT;
+BEGIN
+    SELECT COUNT(*) INTO dup_artists FROM (SELECT name FROM artists GROUP BY name HAVING COUNT(*) > 1) d;
+    SELECT COUNT(*) INTO dup_albums FROM (SELECT artist_id, title FROM albums GROUP BY artist_id, title HAVING COUNT(*) > 1) d;
+    SELECT COUNT(*) INTO dup_tracks FROM (SELECT album_id, title FROM tracks GROUP BY album_id, title HAVING COUNT(*) > 1) d;
+
+    IF dup_artists + dup_albums + dup_tracks > 0 THEN
+        RAISE EXCEPTION 'Catálogo con duplicados: % artistas, % álbumes, % canciones. Fusiónalos antes de migrar.',
+            dup_artists, dup_albums, dup_tracks;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_artists_name ON artists (name);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_albums_artist_title ON albums (artist_id, title);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_tracks_album_title ON tracks (album_id, title);
@@ -0,0 +1,57 @@
+-- ACTUALIZACIÓN: Roles de usuario (los curadores pueden editar el catálogo)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'listener'
+    CHECK (role IN ('listener', 'curator', 'admin'));
+
+-- ACTUALIZACIÓN 3.4: Contribuidores como entidades propias
+-- Una persona que produjo, escribió o mezcló una canción (opcionalmente vinculada a un artista)
+CREATE TABLE IF NOT EXISTS contributors (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(150) NOT NULL,
+    artist_id UUID REFERENCES artists(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- El nombre no es único (dos personas pueden llamarse igual): se identifican por
+-- id y, si están vinculados, por su artista
+DROP INDEX IF EXISTS idx_contributors_name;
+CREATE INDEX IF NOT EXISTS idx_contributors_name ON contributors (LOWER(name));
+CREATE INDEX IF NOT EXISTS idx_contributors_artist ON contributors (artist_id) WHERE artist_id IS NOT NULL;
+
+-- Créditos tipados: quién hizo qué en cada canción
+CREATE TABLE IF NOT EXISTS track_contributors (
+    track_id UUID REFERENCES tracks(id) ON DELETE CASCADE,
+    contributor_id UUID REFERENCES contributors(id) ON DELETE CASCADE,
+    role VARCHAR(30) NOT NULL CHECK (role IN ('producer', 'writer', 'composer', 'mixing_engineer', 'featured_performer')),
+    position INT DEFAULT 0, -- Orden de aparición en el modal de créditos
+    PRIMARY KEY (track_id, contributor_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS idx_track_contributors_contributor ON track_contributors (contributor_id);
+
+-- Migramos los nombres que ya estaban en track_credits: ahí solo hay nombres,
+-- así que cada nombre distinto pasa a ser un contribuidor (un curador puede
+-- separarlos después)
+INSERT INTO contributors (name)
+SELECT DISTINCT ON (LOWER(name)) name FROM (
+    SELECT UNNEST(producers) AS name FROM track_credits UNION
+    SELECT UNNEST(writers) FROM track_credits UNION
+    SELECT UNNEST(engineers) FROM track_credits
+) n
+WHERE name IS NOT NULL AND name <> ''
+  AND NOT EXISTS (SELECT 1 FROM contributors c WHERE LOWER(c.name) = LOWER(n.name))
+ORDER BY LOWER(name), name;
+
+INSERT INTO track_contributors (track_id, contributor_id, role, position)
+SELECT tc.track_id, c.id, x.role, x.pos
+FROM track_credits tc
+CROSS JOIN LATERAL (
+    SELECT p.name, 'producer' AS role, p.ord::int AS pos FROM UNNEST(tc.producers) WITH ORDINALITY AS p(name, ord)
+    UNION ALL
+    SELECT w.name, 'writer', w.ord::int FROM UNNEST(tc.writers) WITH ORDINALITY AS w(name, ord)
+    UNION ALL
+    SELECT e.name, 'mixing_engineer', e.ord::int FROM UNNEST(tc.engineers) WITH ORDINALITY AS e(name, ord)
+) x
+JOIN LATERAL (
+    SELECT id FROM contributors WHERE LOWER(name) = LOWER(x.name) ORDER BY created_at LIMIT 1
+) c ON TRUE
+ON CONFLICT DO NOTHING;
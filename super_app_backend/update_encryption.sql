@@ -0,0 +1,31 @@
+-- ACTUALIZACIÓN 2.2: Cifrado AES-128 de los segmentos HLS
+-- Una clave por rendition de cada trabajo: la de AAC_64 no descifra los segmentos FLAC
+CREATE TABLE IF NOT EXISTS content_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    job_id UUID REFERENCES transcode_jobs(id) ON DELETE SET NULL,
+    quality VARCHAR(20),  -- Rendition que cifra
+    key_bytes BYTEA NOT NULL CHECK (octet_length(key_bytes) = 16),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Bases donde ya existía la tabla con una clave por trabajo (quality NULL = todas)
+ALTER TABLE content_keys ADD COLUMN IF NOT EXISTS quality VARCHAR(20);
+
+CREATE INDEX IF NOT EXISTS idx_content_keys_track ON content_keys (track_id);
+
+ALTER TABLE track_renditions ADD COLUMN IF NOT EXISTS key_id UUID REFERENCES content_keys(id);
+
+-- Registro de cada entrega (o rechazo) de una clave
+CREATE TABLE IF NOT EXISTS content_key_access (
+    id BIGSERIAL PRIMARY KEY,
+    key_id UUID REFERENCES content_keys(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    ip VARCHAR(45),
+    granted BOOLEAN NOT NULL,
+    reason VARCHAR(50),   -- Motivo del rechazo ('expired', 'no_plan'...)
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_key_access_key ON content_key_access (key_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_content_key_access_user ON content_key_access (user_id, created_at DESC);
@@ -0,0 +1,14 @@
+-- ACTUALIZACIÓN: Identificadores externos (ISRC, UPC, IDs de Deezer)
+-- Permiten reconocer una canción/álbum/artista aunque cambie su título,
+-- así la sincronización no crea duplicados.
+CREATE TABLE IF NOT EXISTS external_ids (
+    entity_type VARCHAR(10) NOT NULL CHECK (entity_type IN ('track', 'album', 'artist')),
+    namespace VARCHAR(20) NOT NULL, -- 'isrc', 'upc', 'deezer'
+    value VARCHAR(64) NOT NULL,     -- Normalizado (ISRC en mayúsculas sin guiones, UPC a 13 dígitos)
+    entity_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    -- Un mismo identificador apunta a una sola entidad
+    PRIMARY KEY (entity_type, namespace, value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_external_ids_entity ON external_ids (entity_type, entity_id);
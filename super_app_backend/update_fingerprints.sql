@@ -0,0 +1,31 @@
+-- ACTUALIZACIÓN 1.4: Huellas acústicas para detectar grabaciones duplicadas
+-- La misma grabación llega de fuentes distintas con títulos distintos; la
+-- huella (los primeros 120 s) la reconoce aunque cambien título o compresión.
+CREATE TABLE IF NOT EXISTS track_fingerprints (
+    track_id UUID PRIMARY KEY REFERENCES tracks(id) ON DELETE CASCADE,
+    fingerprint BYTEA NOT NULL,      -- Sub-huellas de 32 bits little-endian
+    duration_ms INT NOT NULL,        -- Audio usado para la huella
+    version INT NOT NULL,            -- Huellas de versiones distintas no se comparan
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Índice de similitud: términos de 20 bits de cada huella. Dos grabaciones
+-- iguales comparten muchos; solo esas se comparan completas.
+CREATE TABLE IF NOT EXISTS fingerprint_terms (
+    term INT NOT NULL,
+    track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    PRIMARY KEY (term, track_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fingerprint_terms_track ON fingerprint_terms (track_id);
+
+-- Canciones fusionadas: los IDs viejos (favoritos, enlaces compartidos,
+-- cachés de la app) siguen resolviendo a la canción que quedó
+CREATE TABLE IF NOT EXISTS track_redirects (
+    old_id UUID PRIMARY KEY,
+    track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    merged_by UUID REFERENCES users(id),
+    merged_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_track_redirects_track ON track_redirects (track_id);
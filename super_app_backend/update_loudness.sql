@@ -0,0 +1,10 @@
+-- ACTUALIZACIÓN 2.2: Normalización de volumen (EBU R128, ganancias estilo ReplayGain 2.0 a -18 LUFS)
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_lufs REAL;      -- Sonoridad integrada
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS true_peak_dbtp REAL;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS gain_db REAL;            -- Ganancia para llegar a -18 LUFS
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_analyzed_at TIMESTAMP WITH TIME ZONE;
+
+-- Valores de álbum: el gating se hace sobre todas sus canciones juntas
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS loudness_lufs REAL;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS true_peak_dbtp REAL;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS gain_db REAL;
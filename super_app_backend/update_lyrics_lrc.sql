@@ -0,0 +1,32 @@
+-- ACTUALIZACIÓN 3.3: Importación/exportación LRC
+-- Cada canción tiene un "set" de letras con sus metadatos LRC ([ar:], [ti:], [offset:]...)
+CREATE TABLE IF NOT EXISTS lyric_sets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    track_id UUID REFERENCES tracks(id) ON DELETE CASCADE UNIQUE,
+    synced BOOLEAN DEFAULT TRUE,   -- FALSE = texto plano sin tiempos
+    tags JSONB DEFAULT '{}',       -- Metadatos LRC originales
+    offset_ms INT DEFAULT 0,       -- [offset:] original (ya aplicado en lyrics.time_ms)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE lyrics ADD COLUMN IF NOT EXISTS lyric_set_id UUID REFERENCES lyric_sets(id) ON DELETE CASCADE;
+ALTER TABLE lyrics ADD COLUMN IF NOT EXISTS line_no INT NOT NULL DEFAULT 0; -- Orden para letras sin tiempos
+
+-- Migramos las letras escritas a mano (update_v1.sql)
+INSERT INTO lyric_sets (track_id)
+SELECT DISTINCT track_id FROM lyrics WHERE track_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+UPDATE lyrics l SET lyric_set_id = s.id
+FROM lyric_sets s
+WHERE s.track_id = l.track_id AND l.lyric_set_id IS NULL;
+
+UPDATE lyrics l SET line_no = n.rn
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY track_id ORDER BY time_ms) - 1 AS rn FROM lyrics) n
+WHERE n.id = l.id;
+
+CREATE INDEX IF NOT EXISTS idx_lyrics_track ON lyrics (track_id, time_ms, line_no);
+
+-- has_lyrics ahora refleja si de verdad hay letra
+UPDATE tracks t SET has_lyrics = EXISTS (SELECT 1 FROM lyrics l WHERE l.track_id = t.id);
@@ -0,0 +1,27 @@
+-- ACTUALIZACIÓN 3.3: Letras desde proveedores externos (LRCLIB)
+-- Procedencia de cada set: 'curator' (importada a mano), 'lrclib', ...
+ALTER TABLE lyric_sets ADD COLUMN IF NOT EXISTS source VARCHAR(30) NOT NULL DEFAULT 'manual';
+ALTER TABLE lyric_sets ADD COLUMN IF NOT EXISTS source_id TEXT;       -- ID en el proveedor
+ALTER TABLE lyric_sets ADD COLUMN IF NOT EXISTS fetched_at TIMESTAMP; -- Cuándo la descargamos
+
+-- Caché negativa: canciones para las que el proveedor no tenía letra.
+-- No volvemos a preguntar hasta retry_after.
+CREATE TABLE IF NOT EXISTS lyrics_fetch_misses (
+    track_id UUID REFERENCES tracks(id) ON DELETE CASCADE PRIMARY KEY,
+    provider VARCHAR(30) NOT NULL,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('not_found', 'instrumental', 'error')),
+    attempts INT NOT NULL DEFAULT 1,
+    last_checked_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    retry_after TIMESTAMPTZ NOT NULL -- Se compara con NOW(): con zona para no depender de la sesión
+);
+
+-- Tablas creadas con TIMESTAMP: retry_after guardaba la hora UTC del proceso y
+-- last_checked_at el NOW() de la sesión (solo se convierte una vez)
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'lyrics_fetch_misses' AND column_name = 'retry_after') = 'timestamp without time zone' THEN
+        ALTER TABLE lyrics_fetch_misses ALTER COLUMN retry_after TYPE TIMESTAMPTZ USING retry_after AT TIME ZONE 'UTC';
+        ALTER TABLE lyrics_fetch_misses ALTER COLUMN last_checked_at TYPE TIMESTAMPTZ;
+    END IF;
+END $$;
@@ -0,0 +1,43 @@
+-- ACTUALIZACIÓN 3.3: Letras de la comunidad con cola de revisión
+-- Cada propuesta (o importación de un curador) es una revisión. Solo las aprobadas
+-- llegan a la tabla lyrics; el resto queda como historial.
+CREATE TABLE IF NOT EXISTS lyric_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    track_id UUID REFERENCES tracks(id) ON DELETE CASCADE NOT NULL,
+    kind VARCHAR(20) NOT NULL DEFAULT 'original' CHECK (kind IN ('original', 'translation', 'romanization')),
+    language VARCHAR(20) NOT NULL DEFAULT '',
+    content TEXT NOT NULL,                 -- LRC mejorado o texto plano (forma canónica)
+    format VARCHAR(10) NOT NULL DEFAULT 'lrc' CHECK (format IN ('lrc', 'text')),
+    diff TEXT NOT NULL DEFAULT '',         -- Diferencias contra la versión vigente al enviarla
+    note TEXT,                             -- Comentario de quien la propone
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    source VARCHAR(30) NOT NULL DEFAULT 'community', -- 'community', 'curator', 'lrclib'...
+    submitted_by UUID REFERENCES users(id),
+    submitted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    reviewed_by UUID REFERENCES users(id),
+    reviewed_at TIMESTAMP,
+    review_note TEXT,
+    rollback_of UUID REFERENCES lyric_revisions(id) -- Si es una vuelta atrás, a qué revisión
+);
+
+CREATE INDEX IF NOT EXISTS idx_lyric_revisions_queue ON lyric_revisions (status, submitted_at);
+CREATE INDEX IF NOT EXISTS idx_lyric_revisions_track ON lyric_revisions (track_id, submitted_at DESC);
+
+-- Qué revisión está publicada en cada set y quién la aportó
+ALTER TABLE lyric_sets ADD COLUMN IF NOT EXISTS revision_id UUID REFERENCES lyric_revisions(id);
+ALTER TABLE lyric_sets ADD COLUMN IF NOT EXISTS contributed_by UUID REFERENCES users(id);
+
+-- Revisión publicada cuando se envió la propuesta: si al aprobarla ya es otra,
+-- la propuesta quedó vieja. Las pendientes de antes se toman como hechas sobre
+-- la versión actual (solo la primera vez, al crear la columna).
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'lyric_revisions' AND column_name = 'base_revision_id') THEN
+        ALTER TABLE lyric_revisions ADD COLUMN base_revision_id UUID REFERENCES lyric_revisions(id);
+        UPDATE lyric_revisions r SET base_revision_id = s.revision_id
+        FROM lyric_sets s
+        WHERE r.status = 'pending' AND s.track_id = r.track_id AND s.kind = r.kind
+          AND (s.kind = 'original' OR s.language = r.language);
+    END IF;
+END $$;
@@ -0,0 +1,15 @@
+-- ACTUALIZACIÓN: Buscar canciones por un fragmento de la letra
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Texto de búsqueda de cada línea: lo calcula la API con utils.SearchText
+-- (minúsculas, sin tildes, sin apóstrofos, signos como espacios), la misma
+-- normalización que se aplica a la consulta y al resaltar. Las líneas que ya
+-- existían se completan con: catalogctl reindex-lyrics
+ALTER TABLE lyrics ADD COLUMN IF NOT EXISTS search_text TEXT;
+ALTER TABLE lyric_variant_lines ADD COLUMN IF NOT EXISTS search_text TEXT;
+
+-- Índices de trigramas (sirven para LIKE y para <%)
+DROP INDEX IF EXISTS idx_lyrics_text_trgm;
+DROP INDEX IF EXISTS idx_lyric_variant_lines_text_trgm;
+CREATE INDEX IF NOT EXISTS idx_lyrics_search_trgm ON lyrics USING gin (search_text gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_lyric_variant_lines_search_trgm ON lyric_variant_lines USING gin (search_text gin_trgm_ops);
@@ -0,0 +1,33 @@
+-- ACTUALIZACIÓN 3.3: Variantes de letra (traducciones y romanizaciones)
+-- language usa etiquetas BCP 47: 'es', 'en', 'pt-BR'; las romanizaciones llevan
+-- el script latino, p. ej. 'ja-Latn' o 'ko-Latn'.
+ALTER TABLE lyric_sets ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'original'
+    CHECK (kind IN ('original', 'translation', 'romanization'));
+ALTER TABLE lyric_sets ADD COLUMN IF NOT EXISTS language VARCHAR(20) NOT NULL DEFAULT '';
+
+-- Ahora una canción puede tener varios sets (uno por tipo e idioma)
+ALTER TABLE lyric_sets DROP CONSTRAINT IF EXISTS lyric_sets_track_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_lyric_sets_variant ON lyric_sets (track_id, kind, language);
+-- Solo un original por canción, sea cual sea su idioma
+CREATE UNIQUE INDEX IF NOT EXISTS idx_lyric_sets_original ON lyric_sets (track_id) WHERE kind = 'original';
+
+CREATE INDEX IF NOT EXISTS idx_lyrics_set_line ON lyrics (lyric_set_id, line_no);
+
+-- Las líneas de las variantes van en su propia tabla: lyrics queda solo con el
+-- original, que es lo que leen las consultas por canción. Cada línea apunta al
+-- line_no de la línea original que traduce (una por línea) y toma sus tiempos.
+CREATE TABLE IF NOT EXISTS lyric_variant_lines (
+    lyric_set_id UUID REFERENCES lyric_sets(id) ON DELETE CASCADE NOT NULL,
+    line_no INT NOT NULL,
+    text TEXT NOT NULL,
+    PRIMARY KEY (lyric_set_id, line_no)
+);
+
+-- Variantes que se guardaron en lyrics antes de separarlas
+INSERT INTO lyric_variant_lines (lyric_set_id, line_no, text)
+SELECT l.lyric_set_id, l.line_no, l.text
+FROM lyrics l JOIN lyric_sets s ON s.id = l.lyric_set_id
+WHERE s.kind <> 'original'
+ON CONFLICT DO NOTHING;
+
+DELETE FROM lyrics l USING lyric_sets s WHERE s.id = l.lyric_set_id AND s.kind <> 'original';
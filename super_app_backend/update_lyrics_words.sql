@@ -0,0 +1,22 @@
+-- ACTUALIZACIÓN 3.3: Letras sincronizadas por palabra (modo karaoke)
+ALTER TABLE lyrics ADD COLUMN IF NOT EXISTS end_ms INT; -- NULL = no sabemos cuándo termina la línea
+
+-- Cada palabra (o sílaba) de una línea con su propio tiempo
+CREATE TABLE IF NOT EXISTS lyric_words (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    lyric_id UUID REFERENCES lyrics(id) ON DELETE CASCADE NOT NULL,
+    position INT NOT NULL,
+    start_ms INT NOT NULL,
+    end_ms INT,
+    text TEXT NOT NULL -- Conserva espacios para unir sílabas
+);
+
+CREATE INDEX IF NOT EXISTS idx_lyric_words_line ON lyric_words (lyric_id, position);
+
+-- Completamos end_ms de las letras existentes con el inicio de la siguiente línea
+UPDATE lyrics l SET end_ms = n.next_ms
+FROM (
+    SELECT id, LEAD(time_ms) OVER (PARTITION BY track_id ORDER BY time_ms, line_no) AS next_ms
+    FROM lyrics
+) n
+WHERE n.id = l.id AND l.end_ms IS NULL;
@@ -0,0 +1,3 @@
+-- ACTUALIZACIÓN 2.2: Planes de suscripción (deciden qué calidades puede escuchar cada usuario)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS plan VARCHAR(20) NOT NULL DEFAULT 'free'
+    CHECK (plan IN ('free', 'premium'));
@@ -0,0 +1,8 @@
+-- ACTUALIZACIÓN 2.2: Vistas previas de 30 segundos
+-- premium_only: canciones que los usuarios free solo pueden escuchar en vista previa.
+-- preview_start_ms: inicio del fragmento (NULL = PREVIEW_START del servidor).
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS premium_only BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS preview_start_ms INT CHECK (preview_start_ms >= 0);
+
+-- La vista previa se guarda como una rendition más ('PREVIEW'), sin cifrar
+COMMENT ON COLUMN track_renditions.quality IS 'AAC_64, AAC_160, AAC_320, FLAC o PREVIEW';
@@ -0,0 +1,9 @@
+-- ACTUALIZACIÓN: Historial de búsquedas (para las sugerencias "recientes" del autocompletado)
+CREATE TABLE IF NOT EXISTS search_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) NOT NULL,
+    query TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_history_user ON search_history (user_id, created_at DESC);
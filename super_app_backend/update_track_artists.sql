@@ -0,0 +1,30 @@
+-- ACTUALIZACIÓN: Colaboraciones (varios artistas por canción y por álbum)
+-- tracks.artist_id y albums.artist_id se mantienen como "artista principal"
+-- para los clientes antiguos; la lista completa vive en estas tablas.
+CREATE TABLE IF NOT EXISTS track_artists (
+    track_id UUID REFERENCES tracks(id) ON DELETE CASCADE,
+    artist_id UUID REFERENCES artists(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'primary' CHECK (role IN ('primary', 'featured', 'remixer')),
+    position INT NOT NULL DEFAULT 0, -- Orden en el que se muestran
+    PRIMARY KEY (track_id, artist_id, role)
+);
+
+CREATE TABLE IF NOT EXISTS album_artists (
+    album_id UUID REFERENCES albums(id) ON DELETE CASCADE,
+    artist_id UUID REFERENCES artists(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'primary' CHECK (role IN ('primary', 'featured', 'remixer')),
+    position INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (album_id, artist_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS idx_track_artists_artist ON track_artists (artist_id);
+CREATE INDEX IF NOT EXISTS idx_album_artists_artist ON album_artists (artist_id);
+
+-- Migramos el artista único que ya tenían
+INSERT INTO track_artists (track_id, artist_id, role, position)
+SELECT id, artist_id, 'primary', 0 FROM tracks WHERE artist_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+INSERT INTO album_artists (album_id, artist_id, role, position)
+SELECT id, artist_id, 'primary', 0 FROM albums WHERE artist_id IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+-- ACTUALIZACIÓN: Número de pista y de disco (vienen en las etiquetas de los masters)
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS track_number INT;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS disc_number INT;
+
+CREATE INDEX IF NOT EXISTS idx_tracks_album_order ON tracks (album_id, disc_number, track_number);
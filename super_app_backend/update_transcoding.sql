@@ -0,0 +1,30 @@
+-- ACTUALIZACIÓN 2.2: Transcodificación propia a HLS
+-- Un trabajo por cada master subido; el worker genera las renditions y,
+-- al terminar, actualiza tracks.stream_url y tracks.available_qualities.
+CREATE TABLE IF NOT EXISTS transcode_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'failed')),
+    master_key TEXT NOT NULL,  -- Clave del master en el almacenamiento
+    output_prefix TEXT,        -- Carpeta con master.m3u8 y las renditions
+    error TEXT,
+    requested_by UUID REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_transcode_jobs_track ON transcode_jobs (track_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_transcode_jobs_pending ON transcode_jobs (created_at) WHERE status IN ('queued', 'running');
+
+-- Renditions publicadas de cada canción (las del último trabajo terminado)
+CREATE TABLE IF NOT EXISTS track_renditions (
+    track_id UUID REFERENCES tracks(id) ON DELETE CASCADE,
+    quality VARCHAR(20) NOT NULL,      -- 'AAC_64', 'AAC_160', 'AAC_320', 'FLAC'
+    codecs VARCHAR(50) NOT NULL,       -- Atributo CODECS del master playlist
+    bandwidth INT NOT NULL,            -- Pico en bits/s
+    average_bandwidth INT NOT NULL,
+    playlist_key TEXT NOT NULL,        -- Clave de la media playlist en el almacenamiento
+    job_id UUID REFERENCES transcode_jobs(id) ON DELETE SET NULL,
+    PRIMARY KEY (track_id, quality)
+);